@@ -126,6 +126,124 @@ func (x *StreamAck) GetReceived() uint64 {
 	return 0
 }
 
+// SequencedTelemetry is a reading tagged with a sequence number assigned by the node.
+// Sequence numbers increase within a stream. A node that sets node_id keeps its
+// sequence increasing across streams and restarts, and the sink drops replays.
+type SequencedTelemetry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Telemetry     *Telemetry             `protobuf:"bytes,2,opt,name=telemetry,proto3" json:"telemetry,omitempty"`
+	NodeId        string                 `protobuf:"bytes,3,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SequencedTelemetry) Reset() {
+	*x = SequencedTelemetry{}
+	mi := &file_api_telemetry_v1_telemetry_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SequencedTelemetry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SequencedTelemetry) ProtoMessage() {}
+
+func (x *SequencedTelemetry) ProtoReflect() protoreflect.Message {
+	mi := &file_api_telemetry_v1_telemetry_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SequencedTelemetry.ProtoReflect.Descriptor instead.
+func (*SequencedTelemetry) Descriptor() ([]byte, []int) {
+	return file_api_telemetry_v1_telemetry_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SequencedTelemetry) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *SequencedTelemetry) GetTelemetry() *Telemetry {
+	if x != nil {
+		return x.Telemetry
+	}
+	return nil
+}
+
+func (x *SequencedTelemetry) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+// TelemetryAck acknowledges every message up to and including seq.
+// Accepted messages are acked only once they are durable in the sink's log;
+// rejected lists the acked messages that were refused and must not be resent.
+type TelemetryAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	Rejected      []uint64               `protobuf:"varint,2,rep,packed,name=rejected,proto3" json:"rejected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TelemetryAck) Reset() {
+	*x = TelemetryAck{}
+	mi := &file_api_telemetry_v1_telemetry_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TelemetryAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TelemetryAck) ProtoMessage() {}
+
+func (x *TelemetryAck) ProtoReflect() protoreflect.Message {
+	mi := &file_api_telemetry_v1_telemetry_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TelemetryAck.ProtoReflect.Descriptor instead.
+func (*TelemetryAck) Descriptor() ([]byte, []int) {
+	return file_api_telemetry_v1_telemetry_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *TelemetryAck) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *TelemetryAck) GetRejected() []uint64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return nil
+}
+
 var File_api_telemetry_v1_telemetry_proto protoreflect.FileDescriptor
 
 const file_api_telemetry_v1_telemetry_proto_rawDesc = "" +
@@ -136,9 +254,17 @@ const file_api_telemetry_v1_telemetry_proto_rawDesc = "" +
 	"\x05value\x18\x02 \x01(\x01R\x05value\x128\n" +
 	"\ttimestamp\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"'\n" +
 	"\tStreamAck\x12\x1a\n" +
-	"\breceived\x18\x01 \x01(\x04R\breceived2V\n" +
+	"\breceived\x18\x01 \x01(\x04R\breceived\"v\n" +
+	"\x12SequencedTelemetry\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x125\n" +
+	"\ttelemetry\x18\x02 \x01(\v2\x17.telemetry.v1.TelemetryR\ttelemetry\x12\x17\n" +
+	"\anode_id\x18\x03 \x01(\tR\x06nodeId\"<\n" +
+	"\fTelemetryAck\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x1a\n" +
+	"\brejected\x18\x02 \x03(\x04R\brejected2\xa9\x01\n" +
 	"\rTelemetrySink\x12E\n" +
-	"\x0fStreamTelemetry\x12\x17.telemetry.v1.Telemetry\x1a\x17.telemetry.v1.StreamAck(\x01B<Z:github.com/kvoloboi/telemetry/api/telemetry/v1;telemetrypbb\x06proto3"
+	"\x0fStreamTelemetry\x12\x17.telemetry.v1.Telemetry\x1a\x17.telemetry.v1.StreamAck(\x01\x12Q\n" +
+	"\rSyncTelemetry\x12 .telemetry.v1.SequencedTelemetry\x1a\x1a.telemetry.v1.TelemetryAck(\x010\x01B<Z:github.com/kvoloboi/telemetry/api/telemetry/v1;telemetrypbb\x06proto3"
 
 var (
 	file_api_telemetry_v1_telemetry_proto_rawDescOnce sync.Once
@@ -152,21 +278,26 @@ func file_api_telemetry_v1_telemetry_proto_rawDescGZIP() []byte {
 	return file_api_telemetry_v1_telemetry_proto_rawDescData
 }
 
-var file_api_telemetry_v1_telemetry_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_api_telemetry_v1_telemetry_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_api_telemetry_v1_telemetry_proto_goTypes = []any{
 	(*Telemetry)(nil),             // 0: telemetry.v1.Telemetry
 	(*StreamAck)(nil),             // 1: telemetry.v1.StreamAck
-	(*timestamppb.Timestamp)(nil), // 2: google.protobuf.Timestamp
+	(*SequencedTelemetry)(nil),    // 2: telemetry.v1.SequencedTelemetry
+	(*TelemetryAck)(nil),          // 3: telemetry.v1.TelemetryAck
+	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
 }
 var file_api_telemetry_v1_telemetry_proto_depIdxs = []int32{
-	2, // 0: telemetry.v1.Telemetry.timestamp:type_name -> google.protobuf.Timestamp
-	0, // 1: telemetry.v1.TelemetrySink.StreamTelemetry:input_type -> telemetry.v1.Telemetry
-	1, // 2: telemetry.v1.TelemetrySink.StreamTelemetry:output_type -> telemetry.v1.StreamAck
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	4, // 0: telemetry.v1.Telemetry.timestamp:type_name -> google.protobuf.Timestamp
+	0, // 1: telemetry.v1.SequencedTelemetry.telemetry:type_name -> telemetry.v1.Telemetry
+	0, // 2: telemetry.v1.TelemetrySink.StreamTelemetry:input_type -> telemetry.v1.Telemetry
+	2, // 3: telemetry.v1.TelemetrySink.SyncTelemetry:input_type -> telemetry.v1.SequencedTelemetry
+	1, // 4: telemetry.v1.TelemetrySink.StreamTelemetry:output_type -> telemetry.v1.StreamAck
+	3, // 5: telemetry.v1.TelemetrySink.SyncTelemetry:output_type -> telemetry.v1.TelemetryAck
+	4, // [4:6] is the sub-list for method output_type
+	2, // [2:4] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_api_telemetry_v1_telemetry_proto_init() }
@@ -180,7 +311,7 @@ func file_api_telemetry_v1_telemetry_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_telemetry_v1_telemetry_proto_rawDesc), len(file_api_telemetry_v1_telemetry_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
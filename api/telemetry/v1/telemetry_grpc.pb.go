@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	TelemetrySink_StreamTelemetry_FullMethodName = "/telemetry.v1.TelemetrySink/StreamTelemetry"
+	TelemetrySink_SyncTelemetry_FullMethodName   = "/telemetry.v1.TelemetrySink/SyncTelemetry"
 )
 
 // TelemetrySinkClient is the client API for TelemetrySink service.
@@ -27,6 +28,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type TelemetrySinkClient interface {
 	StreamTelemetry(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Telemetry, StreamAck], error)
+	SyncTelemetry(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SequencedTelemetry, TelemetryAck], error)
 }
 
 type telemetrySinkClient struct {
@@ -50,11 +52,25 @@ func (c *telemetrySinkClient) StreamTelemetry(ctx context.Context, opts ...grpc.
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type TelemetrySink_StreamTelemetryClient = grpc.ClientStreamingClient[Telemetry, StreamAck]
 
+func (c *telemetrySinkClient) SyncTelemetry(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SequencedTelemetry, TelemetryAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TelemetrySink_ServiceDesc.Streams[1], TelemetrySink_SyncTelemetry_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SequencedTelemetry, TelemetryAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetrySink_SyncTelemetryClient = grpc.BidiStreamingClient[SequencedTelemetry, TelemetryAck]
+
 // TelemetrySinkServer is the server API for TelemetrySink service.
 // All implementations must embed UnimplementedTelemetrySinkServer
 // for forward compatibility.
 type TelemetrySinkServer interface {
 	StreamTelemetry(grpc.ClientStreamingServer[Telemetry, StreamAck]) error
+	SyncTelemetry(grpc.BidiStreamingServer[SequencedTelemetry, TelemetryAck]) error
 	mustEmbedUnimplementedTelemetrySinkServer()
 }
 
@@ -68,6 +84,9 @@ type UnimplementedTelemetrySinkServer struct{}
 func (UnimplementedTelemetrySinkServer) StreamTelemetry(grpc.ClientStreamingServer[Telemetry, StreamAck]) error {
 	return status.Error(codes.Unimplemented, "method StreamTelemetry not implemented")
 }
+func (UnimplementedTelemetrySinkServer) SyncTelemetry(grpc.BidiStreamingServer[SequencedTelemetry, TelemetryAck]) error {
+	return status.Error(codes.Unimplemented, "method SyncTelemetry not implemented")
+}
 func (UnimplementedTelemetrySinkServer) mustEmbedUnimplementedTelemetrySinkServer() {}
 func (UnimplementedTelemetrySinkServer) testEmbeddedByValue()                       {}
 
@@ -96,6 +115,13 @@ func _TelemetrySink_StreamTelemetry_Handler(srv interface{}, stream grpc.ServerS
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type TelemetrySink_StreamTelemetryServer = grpc.ClientStreamingServer[Telemetry, StreamAck]
 
+func _TelemetrySink_SyncTelemetry_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TelemetrySinkServer).SyncTelemetry(&grpc.GenericServerStream[SequencedTelemetry, TelemetryAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TelemetrySink_SyncTelemetryServer = grpc.BidiStreamingServer[SequencedTelemetry, TelemetryAck]
+
 // TelemetrySink_ServiceDesc is the grpc.ServiceDesc for TelemetrySink service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -109,6 +135,12 @@ var TelemetrySink_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _TelemetrySink_StreamTelemetry_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "SyncTelemetry",
+			Handler:       _TelemetrySink_SyncTelemetry_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "api/telemetry/v1/telemetry.proto",
 }
@@ -5,26 +5,51 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/kvoloboi/telemetry/internal/application/node"
+	"github.com/kvoloboi/telemetry/internal/domain"
 	"github.com/kvoloboi/telemetry/internal/infrastructure/tlsconfig"
 )
 
 type Config struct {
 	Node struct {
-		Sensor    string
-		Rate      int
-		QueueSize int
+		Sensors      StringSliceFlag
+		ConfigPath   string
+		Rate         int
+		QueueSize    int
+		Overflow     string
+		BlockTimeout time.Duration
+		ID           string
+		StatePath    string
 	}
 	Transport struct {
 		Type        string
 		SinkAddress string
 		Timeout     time.Duration
 		TLS         tlsconfig.Config
+		HTTP        struct {
+			BatchCount int
+			BatchBytes int
+			Linger     time.Duration
+			Gzip       bool
+		}
 	}
 	Retry struct {
 		MaxRetries int
 		BaseDelay  time.Duration
 		MaxDelay   time.Duration
 	}
+	Dispatch struct {
+		Workers int
+	}
+	Metrics struct {
+		Address string
+	}
+	Spill struct {
+		Dir      string
+		MaxBytes int64
+		Evict    string
+		Timeout  time.Duration
+	}
 }
 
 func (c Config) Validate() error {
@@ -36,6 +61,14 @@ func (c Config) Validate() error {
 		return errors.New("node.queue-size must be > 0")
 	}
 
+	if err := validateOverflow(c.Node.Overflow, c.Node.BlockTimeout); err != nil {
+		return fmt.Errorf("node.overflow: %w", err)
+	}
+
+	if len(c.Node.ID) > domain.MaxNodeIDLen {
+		return fmt.Errorf("node.id must be at most %d bytes", domain.MaxNodeIDLen)
+	}
+
 	switch c.Transport.Type {
 	case "http", "grpc":
 	default:
@@ -46,6 +79,18 @@ func (c Config) Validate() error {
 		return errors.New("transport.timeout must be > 0")
 	}
 
+	if c.Transport.HTTP.BatchCount <= 0 {
+		return errors.New("transport.http.batch-count must be > 0")
+	}
+
+	if c.Transport.HTTP.BatchBytes <= 0 {
+		return errors.New("transport.http.batch-bytes must be > 0")
+	}
+
+	if c.Transport.HTTP.Linger < 0 {
+		return errors.New("transport.http.linger must be >= 0")
+	}
+
 	if err := c.Transport.TLS.Validate(); err != nil {
 		return err
 	}
@@ -66,5 +111,39 @@ func (c Config) Validate() error {
 		return errors.New("retry.base-delay must be <= retry.max-delay")
 	}
 
+	if c.Dispatch.Workers <= 0 {
+		return errors.New("dispatch.workers must be > 0")
+	}
+
+	if c.Spill.Dir != "" {
+		if c.Spill.MaxBytes <= 0 {
+			return errors.New("spill.max-bytes must be > 0")
+		}
+
+		switch node.SpillEvict(c.Spill.Evict) {
+		case node.EvictOldest, node.EvictNewest:
+		default:
+			return fmt.Errorf("unsupported spill.evict: %q", c.Spill.Evict)
+		}
+
+		if c.Spill.Timeout <= 0 {
+			return errors.New("spill.timeout must be > 0")
+		}
+	}
+
+	return nil
+}
+
+// validateOverflow checks a queue overflow policy and, for block, its timeout.
+func validateOverflow(policy string, blockTimeout time.Duration) error {
+	switch node.OverflowPolicy(policy) {
+	case node.OverflowDrop, node.OverflowDropOldest, node.OverflowCoalesce:
+	case node.OverflowBlock:
+		if blockTimeout <= 0 {
+			return errors.New("block timeout must be > 0")
+		}
+	default:
+		return fmt.Errorf("unsupported policy %q", policy)
+	}
 	return nil
 }
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"strings"
 	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/node"
 )
 
 type StringSliceFlag []string
@@ -13,7 +15,7 @@ func (s *StringSliceFlag) String() string {
 }
 
 func (s *StringSliceFlag) Set(value string) error {
-	*s = append(*s, ",")
+	*s = append(*s, value)
 	return nil
 }
 
@@ -24,14 +26,20 @@ func ParseConfig() Config {
 		&cfg.Node.Rate,
 		"node.rate",
 		100,
-		"telemetry messages per second",
+		"telemetry messages per second of sensors declared without a rate",
 	)
 
-	flag.StringVar(
-		&cfg.Node.Sensor,
+	flag.Var(
+		&cfg.Node.Sensors,
 		"node.sensor",
-		"default",
-		"sensor name to send telemetry from",
+		"sensor to send telemetry from, a name or name=...,rate=...,source=...,... (repeatable, default \"default\")",
+	)
+
+	flag.StringVar(
+		&cfg.Node.ConfigPath,
+		"node.config",
+		"",
+		"JSON file declaring the sensors, used together with -node.sensor",
 	)
 
 	flag.IntVar(
@@ -41,6 +49,34 @@ func ParseConfig() Config {
 		"telemetry queue buffer size",
 	)
 
+	flag.StringVar(
+		&cfg.Node.Overflow,
+		"node.overflow",
+		string(node.OverflowDrop),
+		"what a sensor does with a reading when the queue is full: drop, block, drop-oldest or coalesce",
+	)
+
+	flag.DurationVar(
+		&cfg.Node.BlockTimeout,
+		"node.block-timeout",
+		time.Second,
+		"max time a sensor waits for queue space with -node.overflow=block",
+	)
+
+	flag.StringVar(
+		&cfg.Node.ID,
+		"node.id",
+		"",
+		"node identity for exactly-once delivery (empty = keep the stored or a generated id)",
+	)
+
+	flag.StringVar(
+		&cfg.Node.StatePath,
+		"node.state-path",
+		"node-state.json",
+		"file persisting the node id and sequence (empty = no identity, at-least-once delivery)",
+	)
+
 	flag.StringVar(
 		&cfg.Transport.Type,
 		"transport.type",
@@ -62,6 +98,35 @@ func ParseConfig() Config {
 		"transport request timeout",
 	)
 
+	// ---- HTTP batching flags ----
+	flag.IntVar(
+		&cfg.Transport.HTTP.BatchCount,
+		"transport.http.batch-count",
+		100,
+		"max readings per HTTP request",
+	)
+
+	flag.IntVar(
+		&cfg.Transport.HTTP.BatchBytes,
+		"transport.http.batch-bytes",
+		64*1024,
+		"max uncompressed JSON bytes per HTTP request",
+	)
+
+	flag.DurationVar(
+		&cfg.Transport.HTTP.Linger,
+		"transport.http.linger",
+		100*time.Millisecond,
+		"max time a reading waits for its HTTP batch to fill",
+	)
+
+	flag.BoolVar(
+		&cfg.Transport.HTTP.Gzip,
+		"transport.http.gzip",
+		false,
+		"gzip HTTP request bodies",
+	)
+
 	// ---- TLS flags ----
 	flag.BoolVar(
 		&cfg.Transport.TLS.Enabled,
@@ -105,6 +170,49 @@ func ParseConfig() Config {
 		"skip TLS verification (DEV ONLY)",
 	)
 
+	flag.StringVar(
+		&cfg.Metrics.Address,
+		"metrics.address",
+		"",
+		"address to serve Prometheus metrics on (empty = disabled)",
+	)
+
+	// ---- Spill flags ----
+	flag.StringVar(
+		&cfg.Spill.Dir,
+		"spill.dir",
+		"",
+		"directory spilling readings to disk while the sink is unreachable (empty = disabled)",
+	)
+
+	flag.Int64Var(
+		&cfg.Spill.MaxBytes,
+		"spill.max-bytes",
+		256<<20,
+		"max size of the spill on disk",
+	)
+
+	flag.StringVar(
+		&cfg.Spill.Evict,
+		"spill.evict",
+		string(node.EvictOldest),
+		"readings a full spill gives up: oldest or newest",
+	)
+
+	flag.DurationVar(
+		&cfg.Spill.Timeout,
+		"spill.timeout",
+		time.Second,
+		"how long a reading may wait for the sender before it is spilled",
+	)
+
+	flag.IntVar(
+		&cfg.Dispatch.Workers,
+		"dispatch.workers",
+		1,
+		"readings dispatched at once, each worker delivering a share of the sensors in order through its own sender",
+	)
+
 	flag.IntVar(
 		&cfg.Retry.MaxRetries,
 		"retry.max",
@@ -4,15 +4,21 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/kvoloboi/telemetry/internal/application/common"
 	"github.com/kvoloboi/telemetry/internal/application/node"
+	"github.com/kvoloboi/telemetry/internal/infrastructure/admin"
 	"github.com/kvoloboi/telemetry/internal/infrastructure/tlsconfig"
 	"github.com/kvoloboi/telemetry/internal/infrastructure/transport/grpc"
 	"github.com/kvoloboi/telemetry/internal/infrastructure/transport/http"
+	"github.com/kvoloboi/telemetry/internal/metrics"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -32,37 +38,149 @@ func main() {
 		return
 	}
 
+	sensors, aggregates, err := cfg.LoadSensors()
+	if err != nil {
+		logger.Error("invalid sensor config", "error", err)
+		return
+	}
+
 	queue := make(chan domain.Telemetry, cfg.Node.QueueSize)
 
-	producer := node.NewProducer(cfg.Node.Sensor, cfg.Node.Rate, queue, logger, counters)
+	// with aggregation the producers fill a queue of their own, drained by the aggregator
+	produced := queue
+	var aggregator *node.Aggregator
+	if len(aggregates) > 0 {
+		produced = make(chan domain.Telemetry, cfg.Node.QueueSize)
+		aggregator, err = node.NewAggregator(produced, queue, aggregates, logger, counters)
+		if err != nil {
+			logger.Error("invalid sensor config", "error", err)
+			return
+		}
+	}
+
+	producers := make([]*node.TelemetryProducer, 0, len(sensors))
+	for _, s := range sensors {
+		producers = append(producers, node.NewProducer(s, produced, logger, counters))
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	sender, err := createSenderFrom(cfg, logger)
-	if err != nil {
-		logger.Error("failed to create sender", "error", err)
-		return
+	var seq *node.Sequence
+	var nodeID string
+	if cfg.Node.StatePath != "" {
+		seq, err = node.OpenSequence(cfg.Node.StatePath, cfg.Node.ID)
+		if err != nil {
+			logger.Error("failed to load node state", "error", err)
+			return
+		}
+		nodeID = seq.ID().String()
+		logger.Info("node identity loaded", "id", nodeID)
+	}
+
+	// every dispatch worker delivers through its own sender, so one retrying holds up only its sensors
+	senders := make([]node.TelemetrySender, 0, cfg.Dispatch.Workers)
+	for range cfg.Dispatch.Workers {
+		sender, err := createSenderFrom(cfg, nodeID, logger)
+		if err != nil {
+			logger.Error("failed to create sender", "error", err)
+			for _, s := range senders {
+				s.Close()
+			}
+			return
+		}
+		senders = append(senders, sender)
 	}
 
+	var spill *node.Spill
+	if cfg.Spill.Dir != "" {
+		spill, err = node.OpenSpill(node.SpillConfig{
+			Dir:      cfg.Spill.Dir,
+			MaxBytes: cfg.Spill.MaxBytes,
+			Evict:    node.SpillEvict(cfg.Spill.Evict),
+		})
+		if err != nil {
+			logger.Error("failed to open spill", "error", err)
+			return
+		}
+		logger.Info("spill opened", "dir", cfg.Spill.Dir, "pending", spill.Len())
+	}
+
+	reg := metrics.NewRegistry()
+	counters.RegisterMetrics(reg)
+	reg.Register("telemetry_node_queue_depth", "Readings waiting in the node queue.",
+		metrics.GaugeFunc(func() float64 { return float64(len(queue)) }))
+	reg.Register("telemetry_node_queue_capacity", "Capacity of the node queue.",
+		metrics.GaugeFunc(func() float64 { return float64(cap(queue)) }))
+	for i, sender := range senders {
+		if s, ok := sender.(interface {
+			RegisterMetrics(*metrics.Registry, ...string)
+		}); ok {
+			s.RegisterMetrics(reg, "worker", strconv.Itoa(i))
+		}
+	}
+	if spill != nil {
+		spill.RegisterMetrics(reg)
+	}
+
+	var metricsServer *admin.Server
+	if cfg.Metrics.Address != "" {
+		metricsServer, err = admin.NewServer(cfg.Metrics.Address, logger)
+		if err != nil {
+			logger.Error("failed to start metrics server", "error", err)
+			return
+		}
+		metricsServer.Handle("GET /metrics", reg.Handler())
+
+		go func() {
+			if err := metricsServer.Run(); err != nil {
+				logger.Error("metrics server failed", "error", err)
+			}
+		}()
+	}
+
+	// the dispatcher stops once everything produced is queued, see below
+	dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+	defer stopDispatch()
+
 	dispatcher := node.NewTelemetryDispatcher(
 		queue,
-		sender,
+		senders,
 		node.DispatcherConfig{
-			MaxRetries: cfg.Retry.MaxRetries,
-			Backoff:    common.NewBackoff(cfg.Retry.BaseDelay, cfg.Retry.MaxDelay),
+			MaxRetries:   cfg.Retry.MaxRetries,
+			Backoff:      common.NewBackoff(cfg.Retry.BaseDelay, cfg.Retry.MaxDelay),
+			Sequence:     seq,
+			Spill:        spill,
+			SpillTimeout: cfg.Spill.Timeout,
 		},
 		logger,
 		counters,
 		cancel,
 	)
 
-	go producer.Run(ctx)
+	var producing sync.WaitGroup
+	for _, p := range producers {
+		producing.Add(1)
+		go func() {
+			defer producing.Done()
+			p.Run(ctx)
+		}()
+	}
+
+	aggregatorDone := make(chan struct{})
+	if aggregator != nil {
+		go func() {
+			aggregator.Run()
+			close(aggregatorDone)
+		}()
+	} else {
+		close(aggregatorDone)
+	}
 
 	dispatcherDone := make(chan struct{})
 
 	go func() {
-		dispatcher.Run(ctx)
+		dispatcher.Run(dispatchCtx)
 		close(dispatcherDone)
 	}()
 
@@ -70,25 +188,76 @@ func main() {
 	<-ctx.Done()
 	logger.Info("shutdown signal received")
 
-	// ---- Stop producer & dispatcher ----
+	// ---- Stop producers & dispatcher ----
+	producing.Wait() // no producer may send on the closed queue
+	if aggregator != nil {
+		close(produced) // the aggregator emits its open windows and stops
+	}
+	<-aggregatorDone
+	stopDispatch()   // the dispatcher drains the queue and flushes the senders
 	close(queue)     // signals dispatcher no more metrics
 	<-dispatcherDone // wait until all metrics are delivered
 
+	for _, name := range counters.Sensors() {
+		sc := counters.Sensor(name)
+		logger.Info("final sensor metrics",
+			"sensor", name,
+			"produced", sc.GetProduced(),
+			"dropped", sc.GetDropped(),
+			"sent", sc.GetSent(),
+			"failed", sc.GetFailed(),
+			"blocked", sc.GetBlocked(),
+			"evicted", sc.GetEvicted(),
+			"coalesced", sc.GetCoalesced(),
+			"aggregated", sc.GetAggregated(),
+			"filtered", sc.GetFiltered(),
+		)
+	}
+
+	if metricsServer != nil {
+		metricsServer.Shutdown(5 * time.Second)
+	}
+
 	logger.Info("telemetry node shutdown complete")
 }
 
-func createSenderFrom(cfg Config, logger *slog.Logger) (node.TelemetrySender, error) {
+// createSenderFrom creates the sender of cfg.Transport, sending nodeID with numbered readings.
+func createSenderFrom(cfg Config, nodeID string, logger *slog.Logger) (node.TelemetrySender, error) {
 	switch cfg.Transport.Type {
 	case "http":
-		return transporthttp.NewTelemetryHttpSender(cfg.Transport.SinkAddress, logger, transporthttp.WithTimeout(cfg.Transport.Timeout))
+		return createHttpSender(cfg, nodeID, logger)
 	case "grpc":
-		return createGrpcSender(cfg, logger)
+		return createGrpcSender(cfg, nodeID, logger)
 	default:
 		return nil, fmt.Errorf("unknown transport type: %s", cfg.Transport.Type)
 	}
 }
 
-func createGrpcSender(cfg Config, logger *slog.Logger) (node.TelemetrySender, error) {
+func createHttpSender(cfg Config, nodeID string, logger *slog.Logger) (node.TelemetrySender, error) {
+	tls, err := tlsconfig.ClientTLSConfig(cfg.Transport.TLS)
+	if err != nil {
+		logger.Error("failed to setup tls config", "err", err)
+		return nil, err
+	}
+
+	return transporthttp.NewTelemetryHttpSender(
+		cfg.Transport.SinkAddress,
+		logger,
+		&transporthttp.SenderConfig{
+			MaxBatchCount: cfg.Transport.HTTP.BatchCount,
+			MaxBatchBytes: cfg.Transport.HTTP.BatchBytes,
+			Linger:        cfg.Transport.HTTP.Linger,
+			Gzip:          cfg.Transport.HTTP.Gzip,
+			MaxRetries:    cfg.Retry.MaxRetries,
+			Backoff:       common.NewBackoff(cfg.Retry.BaseDelay, cfg.Retry.MaxDelay),
+			NodeID:        nodeID,
+		},
+		transporthttp.WithTimeout(cfg.Transport.Timeout),
+		transporthttp.WithTLSConfig(tls),
+	)
+}
+
+func createGrpcSender(cfg Config, nodeID string, logger *slog.Logger) (node.TelemetrySender, error) {
 	tls, err := tlsconfig.ClientTLSConfig(cfg.Transport.TLS)
 	if err != nil {
 		logger.Error("failed to setup tls config", "err", err)
@@ -101,9 +270,16 @@ func createGrpcSender(cfg Config, logger *slog.Logger) (node.TelemetrySender, er
 		opts = grpc.WithTransportCredentials(insecure.NewCredentials())
 	}
 
+	senderCfg := transportgrpc.DefaultSenderConfig()
+	senderCfg.NodeID = nodeID
+	if cfg.Spill.Dir != "" {
+		// readings wait in the spill while the sink is away, so reconnect for as long as it takes
+		senderCfg.MaxReconnectAttempts = math.MaxInt
+	}
+
 	conn, err := grpc.NewClient(cfg.Transport.SinkAddress, opts)
 	if err != nil {
 		return nil, err
 	}
-	return transportgrpc.NewTelemetryGrpcSender(conn, logger, nil)
+	return transportgrpc.NewTelemetryGrpcSender(conn, logger, &senderCfg)
 }
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/node"
+	"github.com/kvoloboi/telemetry/internal/application/node/source"
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// SensorConfig declares one sensor of the node and where its values come from.
+// Rate defaults to -node.rate, Overflow and BlockTimeout to -node.overflow and
+// -node.block-timeout, Source to random, Min and Max to 0 and 1.
+// Window, Aggregate and Deadband configure the aggregator (see node.AggregateConfig);
+// the other fields parameterize the source (see source.Config).
+type SensorConfig struct {
+	Name         string   `json:"name"`
+	Rate         int      `json:"rate,omitempty"`
+	Overflow     string   `json:"overflow,omitempty"`
+	BlockTimeout string   `json:"block_timeout,omitempty"`
+	Window       string   `json:"window,omitempty"`
+	Aggregate    string   `json:"aggregate,omitempty"`
+	Deadband     *float64 `json:"deadband,omitempty"`
+	Source       string   `json:"source,omitempty"`
+	Min          *float64 `json:"min,omitempty"`
+	Max          *float64 `json:"max,omitempty"`
+	Value        float64  `json:"value,omitempty"`
+	Period       string   `json:"period,omitempty"`
+	Noise        float64  `json:"noise,omitempty"`
+	Step         float64  `json:"step,omitempty"`
+	Path         string   `json:"path,omitempty"`
+	Column       int      `json:"column,omitempty"`
+	Command      string   `json:"command,omitempty"`
+	Scale        float64  `json:"scale,omitempty"`
+	Timeout      string   `json:"timeout,omitempty"`
+}
+
+// sensorsFile is the layout of the -node.config file.
+type sensorsFile struct {
+	Sensors []SensorConfig `json:"sensors"`
+}
+
+// LoadSensors collects the sensors of the -node.config file followed by
+// those of the -node.sensor flags, falling back to a single "default" sensor.
+// The sensors with a window or a deadband are returned with their aggregation.
+func (c Config) LoadSensors() ([]node.ProducerConfig, map[string]node.AggregateConfig, error) {
+	var sensors []SensorConfig
+
+	if c.Node.ConfigPath != "" {
+		data, err := os.ReadFile(c.Node.ConfigPath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var file sensorsFile
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %w", c.Node.ConfigPath, err)
+		}
+		sensors = append(sensors, file.Sensors...)
+	}
+
+	for _, spec := range c.Node.Sensors {
+		s, err := parseSensorSpec(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("node.sensor %q: %w", spec, err)
+		}
+		sensors = append(sensors, s)
+	}
+
+	if len(sensors) == 0 {
+		sensors = append(sensors, SensorConfig{Name: "default"})
+	}
+
+	seen := make(map[string]struct{}, len(sensors))
+	out := make([]node.ProducerConfig, 0, len(sensors))
+	aggregates := make(map[string]node.AggregateConfig)
+
+	for _, s := range sensors {
+		if _, err := domain.NewSensorName(s.Name); err != nil {
+			return nil, nil, fmt.Errorf("sensor %q: %w", s.Name, err)
+		}
+		if _, dup := seen[s.Name]; dup {
+			return nil, nil, fmt.Errorf("sensor %q declared twice", s.Name)
+		}
+		seen[s.Name] = struct{}{}
+
+		rate := s.Rate
+		if rate == 0 {
+			rate = c.Node.Rate
+		}
+		if rate <= 0 {
+			return nil, nil, fmt.Errorf("sensor %q: rate must be > 0", s.Name)
+		}
+
+		overflow := s.Overflow
+		if overflow == "" {
+			overflow = c.Node.Overflow
+		}
+		blockTimeout := c.Node.BlockTimeout
+		if s.BlockTimeout != "" {
+			var err error
+			if blockTimeout, err = time.ParseDuration(s.BlockTimeout); err != nil {
+				return nil, nil, fmt.Errorf("sensor %q: invalid block_timeout: %w", s.Name, err)
+			}
+		}
+		if err := validateOverflow(overflow, blockTimeout); err != nil {
+			return nil, nil, fmt.Errorf("sensor %q: overflow: %w", s.Name, err)
+		}
+
+		agg, err := s.aggregateConfig()
+		if err != nil {
+			return nil, nil, fmt.Errorf("sensor %q: %w", s.Name, err)
+		}
+		if agg.Window > 0 || agg.Deadband != nil {
+			aggregates[s.Name] = agg
+		}
+
+		cfg, err := s.sourceConfig()
+		if err != nil {
+			return nil, nil, fmt.Errorf("sensor %q: %w", s.Name, err)
+		}
+		src, err := source.New(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sensor %q: %w", s.Name, err)
+		}
+
+		out = append(out, node.ProducerConfig{
+			Sensor:       s.Name,
+			Rate:         rate,
+			Source:       src,
+			Overflow:     node.OverflowPolicy(overflow),
+			BlockTimeout: blockTimeout,
+		})
+	}
+
+	// readings emitted by the aggregator must not pass for another sensor's
+	emitted := make(map[string]string, len(out))
+	for _, p := range out {
+		names := []string{p.Sensor}
+		if agg, ok := aggregates[p.Sensor]; ok {
+			names = agg.Names(p.Sensor)
+		}
+		for _, name := range names {
+			if other, dup := emitted[name]; dup {
+				return nil, nil, fmt.Errorf("sensors %q and %q both send as %q", other, p.Sensor, name)
+			}
+			emitted[name] = p.Sensor
+		}
+	}
+
+	return out, aggregates, nil
+}
+
+func (s SensorConfig) sourceConfig() (source.Config, error) {
+	cfg := source.Config{
+		Kind:    s.Source,
+		Min:     0,
+		Max:     1,
+		Value:   s.Value,
+		Noise:   s.Noise,
+		Step:    s.Step,
+		Path:    s.Path,
+		Column:  s.Column,
+		Command: s.Command,
+		Scale:   s.Scale,
+	}
+	if s.Min != nil {
+		cfg.Min = *s.Min
+	}
+	if s.Max != nil {
+		cfg.Max = *s.Max
+	}
+
+	var err error
+	if s.Period != "" {
+		if cfg.Period, err = time.ParseDuration(s.Period); err != nil {
+			return cfg, fmt.Errorf("invalid period: %w", err)
+		}
+	}
+	if s.Timeout != "" {
+		if cfg.Timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return cfg, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (s SensorConfig) aggregateConfig() (node.AggregateConfig, error) {
+	cfg := node.AggregateConfig{Deadband: s.Deadband}
+
+	if s.Window != "" {
+		var err error
+		if cfg.Window, err = time.ParseDuration(s.Window); err != nil {
+			return cfg, fmt.Errorf("invalid window: %w", err)
+		}
+	}
+	if s.Aggregate != "" {
+		for _, stat := range strings.Split(s.Aggregate, "+") {
+			cfg.Stats = append(cfg.Stats, node.AggregateStat(stat))
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// parseSensorSpec parses a -node.sensor value: either a bare sensor name,
+// or comma-separated key=value pairs such as name=temp,rate=10,source=sine,min=15,max=25.
+// The keys are the JSON field names of SensorConfig. A command may contain commas,
+// so command= takes the rest of the spec and must come last.
+func parseSensorSpec(spec string) (SensorConfig, error) {
+	if !strings.Contains(spec, "=") {
+		return SensorConfig{Name: spec}, nil
+	}
+
+	var s SensorConfig
+	for rest := spec; rest != ""; {
+		var pair string
+		if strings.HasPrefix(rest, "command=") {
+			pair, rest = rest, ""
+		} else {
+			pair, rest, _ = strings.Cut(rest, ",")
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return s, fmt.Errorf("expected key=value, got %q", pair)
+		}
+
+		if err := s.set(key, value); err != nil {
+			return s, err
+		}
+	}
+
+	if s.Name == "" {
+		return s, errors.New("missing name")
+	}
+	return s, nil
+}
+
+func (s *SensorConfig) set(key, value string) error {
+	float := func(dst *float64) error {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		*dst = v
+		return nil
+	}
+	integer := func(dst *int) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		*dst = v
+		return nil
+	}
+
+	switch key {
+	case "name":
+		s.Name = value
+	case "rate":
+		return integer(&s.Rate)
+	case "overflow":
+		s.Overflow = value
+	case "block_timeout":
+		s.BlockTimeout = value
+	case "window":
+		s.Window = value
+	case "aggregate":
+		s.Aggregate = value
+	case "deadband":
+		s.Deadband = new(float64)
+		return float(s.Deadband)
+	case "source":
+		s.Source = value
+	case "min":
+		s.Min = new(float64)
+		return float(s.Min)
+	case "max":
+		s.Max = new(float64)
+		return float(s.Max)
+	case "value":
+		return float(&s.Value)
+	case "period":
+		s.Period = value
+	case "noise":
+		return float(&s.Noise)
+	case "step":
+		return float(&s.Step)
+	case "path":
+		s.Path = value
+	case "column":
+		return integer(&s.Column)
+	case "command":
+		s.Command = value
+	case "scale":
+		return float(&s.Scale)
+	case "timeout":
+		s.Timeout = value
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
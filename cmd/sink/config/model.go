@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/kvoloboi/telemetry/internal/infrastructure/tlsconfig"
@@ -9,6 +10,11 @@ import (
 type Config struct {
 	Sink      SinkConfig
 	Batch     BatchConfig
+	Overload  OverloadConfig
+	Retention RetentionConfig
+	Export    ExportConfig
+	Registry  RegistryConfig
+	Admin     AdminConfig
 	RateLimit RateLimitConfig
 	Transport TransportConfig
 }
@@ -17,6 +23,15 @@ type SinkConfig struct {
 	LogPath         string
 	QueueSize       int
 	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	SegmentMaxBytes int64
+	SegmentMaxAge   time.Duration
+	Fsync           string
+	FsyncInterval   time.Duration
+	Compression     string
+	FormatVersion   int
+	StrictRecovery  bool
+	Dedup           bool
 }
 
 type BatchConfig struct {
@@ -25,6 +40,47 @@ type BatchConfig struct {
 	FlushInterval time.Duration
 }
 
+type OverloadConfig struct {
+	Policy       string
+	BlockTimeout time.Duration
+	RetryAfter   time.Duration
+}
+
+type RetentionConfig struct {
+	MaxBytes      int64
+	MaxAge        time.Duration
+	CheckInterval time.Duration
+	PruneExported bool // delete segments once the exporter acked all their batches
+}
+
+type ExportConfig struct {
+	PostgresDSN      string
+	Name             string
+	UnknownSensors   string
+	CreateRoomID     int64
+	CreateSensorType string
+}
+
+// String keeps the DSN, which may hold a password, out of the startup log.
+func (c ExportConfig) String() string {
+	dsn := ""
+	if c.PostgresDSN != "" {
+		dsn = "<redacted>"
+	}
+	return fmt.Sprintf("{PostgresDSN:%s Name:%s UnknownSensors:%s CreateRoomID:%d CreateSensorType:%s}",
+		dsn, c.Name, c.UnknownSensors, c.CreateRoomID, c.CreateSensorType)
+}
+
+type RegistryConfig struct {
+	Path           string
+	ReloadInterval time.Duration
+}
+
+type AdminConfig struct {
+	Address        string
+	RegistryWrites bool
+}
+
 type RateLimitConfig struct {
 	Messages RateRuleConfig
 	Bytes    RateRuleConfig
@@ -37,5 +93,6 @@ type RateRuleConfig struct {
 
 type TransportConfig struct {
 	SinkAddress string
+	HTTPAddress string
 	TLS         tlsconfig.Config
 }
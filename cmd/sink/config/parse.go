@@ -13,7 +13,7 @@ func Parse() Config {
 		&cfg.Sink.LogPath,
 		"sink.log-path",
 		"./telemetry.wal",
-		"path to telemetry WAL file",
+		"path to telemetry WAL directory",
 	)
 
 	flag.IntVar(
@@ -30,6 +30,69 @@ func Parse() Config {
 		"server shutdown timeout",
 	)
 
+	flag.DurationVar(
+		&cfg.Sink.DrainDelay,
+		"sink.drain-delay",
+		0,
+		"time to report not ready before the servers stop on shutdown",
+	)
+
+	flag.Int64Var(
+		&cfg.Sink.SegmentMaxBytes,
+		"sink.segment-max-bytes",
+		64*1024*1024,
+		"max WAL segment size in bytes before rollover (0 = unlimited)",
+	)
+
+	flag.DurationVar(
+		&cfg.Sink.SegmentMaxAge,
+		"sink.segment-max-age",
+		0,
+		"max WAL segment age before rollover (0 = unlimited)",
+	)
+
+	flag.StringVar(
+		&cfg.Sink.Fsync,
+		"sink.fsync",
+		"always",
+		"WAL fsync mode: always, interval or none",
+	)
+
+	flag.DurationVar(
+		&cfg.Sink.FsyncInterval,
+		"sink.fsync-interval",
+		100*time.Millisecond,
+		"WAL group commit interval for -sink.fsync=interval",
+	)
+
+	flag.StringVar(
+		&cfg.Sink.Compression,
+		"sink.compression",
+		"none",
+		"WAL payload compression codec: none or flate",
+	)
+
+	flag.IntVar(
+		&cfg.Sink.FormatVersion,
+		"sink.format",
+		1,
+		"WAL payload format for new records: 1 (row) or 2 (columnar, not readable by older sinks)",
+	)
+
+	flag.BoolVar(
+		&cfg.Sink.StrictRecovery,
+		"sink.strict-recovery",
+		false,
+		"fail startup instead of truncating when intact WAL records follow a corrupt one",
+	)
+
+	flag.BoolVar(
+		&cfg.Sink.Dedup,
+		"sink.dedup",
+		true,
+		"drop sequenced telemetry a node already delivered, using high-water marks recovered from the WAL",
+	)
+
 	// Batch
 	flag.IntVar(
 		&cfg.Batch.MaxCount,
@@ -52,6 +115,123 @@ func Parse() Config {
 		"max time before batch is flushed",
 	)
 
+	// Overload
+	flag.StringVar(
+		&cfg.Overload.Policy,
+		"overload.policy",
+		"drop",
+		"what to do when the ingest queue is full: drop, block or reject",
+	)
+
+	flag.DurationVar(
+		&cfg.Overload.BlockTimeout,
+		"overload.block-timeout",
+		time.Second,
+		"max wait for queue space with -overload.policy=block",
+	)
+
+	flag.DurationVar(
+		&cfg.Overload.RetryAfter,
+		"overload.retry-after",
+		time.Second,
+		"retry hint sent to clients with -overload.policy=reject",
+	)
+
+	// Retention
+	flag.Int64Var(
+		&cfg.Retention.MaxBytes,
+		"retention.max-bytes",
+		0,
+		"max total WAL size in bytes (0 = unlimited)",
+	)
+
+	flag.DurationVar(
+		&cfg.Retention.MaxAge,
+		"retention.max-age",
+		0,
+		"max age of WAL data (0 = unlimited)",
+	)
+
+	flag.DurationVar(
+		&cfg.Retention.CheckInterval,
+		"retention.check-interval",
+		time.Minute,
+		"interval between retention runs",
+	)
+
+	flag.BoolVar(
+		&cfg.Retention.PruneExported,
+		"retention.prune-exported",
+		false,
+		"delete WAL segments once all their batches are exported to postgres",
+	)
+
+	// Export
+	flag.StringVar(
+		&cfg.Export.PostgresDSN,
+		"export.postgres-dsn",
+		"",
+		"postgres connection string to export telemetry into (empty = disabled)",
+	)
+
+	flag.StringVar(
+		&cfg.Export.Name,
+		"export.name",
+		"sink",
+		"name of the export checkpoint in postgres",
+	)
+
+	flag.StringVar(
+		&cfg.Export.UnknownSensors,
+		"export.unknown-sensors",
+		"reject",
+		"handling of sensors missing in postgres: reject or create",
+	)
+
+	flag.Int64Var(
+		&cfg.Export.CreateRoomID,
+		"export.create-room-id",
+		0,
+		"room id for sensors created with -export.unknown-sensors=create",
+	)
+
+	flag.StringVar(
+		&cfg.Export.CreateSensorType,
+		"export.create-sensor-type",
+		"V",
+		"type of sensors created with -export.unknown-sensors=create: V or R",
+	)
+
+	// Registry
+	flag.StringVar(
+		&cfg.Registry.Path,
+		"registry.path",
+		"",
+		"path to sensor registry JSON file (empty = accept all sensors)",
+	)
+
+	flag.DurationVar(
+		&cfg.Registry.ReloadInterval,
+		"registry.reload-interval",
+		5*time.Second,
+		"interval between checks of the registry file for changes (0 = disabled)",
+	)
+
+	// Admin
+	flag.StringVar(
+		&cfg.Admin.Address,
+		"admin.address",
+		"127.0.0.1:9100",
+		"admin HTTP API address (empty = disabled)",
+	)
+
+	flag.BoolVar(
+		&cfg.Admin.RegistryWrites,
+		"admin.registry-writes",
+		false,
+		"allow changing the sensor registry through the unauthenticated admin API",
+	)
+
 	// Rate limit — messages
 	flag.IntVar(
 		&cfg.RateLimit.Messages.PerSecond,
@@ -90,6 +270,13 @@ func Parse() Config {
 		"address to listen on",
 	)
 
+	flag.StringVar(
+		&cfg.Transport.HTTPAddress,
+		"transport.http-address",
+		"",
+		"address to accept HTTP telemetry on (empty = disabled)",
+	)
+
 	// ---- TLS flags ----
 	flag.BoolVar(
 		&cfg.Transport.TLS.Enabled,
@@ -1,6 +1,9 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 func (c Config) Validate() error {
 	if c.Sink.LogPath == "" {
@@ -13,6 +16,35 @@ func (c Config) Validate() error {
 	if c.Sink.ShutdownTimeout <= 0 {
 		return errors.New("sink.shutdown-timeout must be > 0")
 	}
+	if c.Sink.DrainDelay < 0 {
+		return errors.New("sink.drain-delay must be >= 0")
+	}
+	if c.Sink.SegmentMaxBytes < 0 {
+		return errors.New("sink.segment-max-bytes must be >= 0")
+	}
+	if c.Sink.SegmentMaxAge < 0 {
+		return errors.New("sink.segment-max-age must be >= 0")
+	}
+
+	switch c.Sink.Fsync {
+	case "always", "none":
+	case "interval":
+		if c.Sink.FsyncInterval <= 0 {
+			return errors.New("sink.fsync-interval must be > 0")
+		}
+	default:
+		return fmt.Errorf("unsupported sink.fsync: %q", c.Sink.Fsync)
+	}
+
+	switch c.Sink.Compression {
+	case "none", "flate":
+	default:
+		return fmt.Errorf("unsupported sink.compression: %q", c.Sink.Compression)
+	}
+
+	if c.Sink.FormatVersion != 1 && c.Sink.FormatVersion != 2 {
+		return fmt.Errorf("unsupported sink.format: %d", c.Sink.FormatVersion)
+	}
 
 	if c.Batch.MaxCount <= 0 {
 		return errors.New("batch.max-count must be > 0")
@@ -24,6 +56,53 @@ func (c Config) Validate() error {
 		return errors.New("batch.flush-interval must be > 0")
 	}
 
+	switch c.Overload.Policy {
+	case "drop":
+	case "block":
+		if c.Overload.BlockTimeout <= 0 {
+			return errors.New("overload.block-timeout must be > 0")
+		}
+	case "reject":
+		if c.Overload.RetryAfter <= 0 {
+			return errors.New("overload.retry-after must be > 0")
+		}
+	default:
+		return fmt.Errorf("unsupported overload.policy: %q", c.Overload.Policy)
+	}
+
+	if c.Retention.MaxBytes < 0 {
+		return errors.New("retention.max-bytes must be >= 0")
+	}
+	if c.Retention.MaxAge < 0 {
+		return errors.New("retention.max-age must be >= 0")
+	}
+	if c.Retention.CheckInterval <= 0 {
+		return errors.New("retention.check-interval must be > 0")
+	}
+
+	if c.Export.PostgresDSN != "" {
+		if c.Export.Name == "" {
+			return errors.New("export.name must not be empty")
+		}
+
+		switch c.Export.UnknownSensors {
+		case "reject":
+		case "create":
+			if c.Export.CreateRoomID <= 0 {
+				return errors.New("export.create-room-id must be > 0")
+			}
+			if c.Export.CreateSensorType != "V" && c.Export.CreateSensorType != "R" {
+				return fmt.Errorf("unsupported export.create-sensor-type: %q", c.Export.CreateSensorType)
+			}
+		default:
+			return fmt.Errorf("unsupported export.unknown-sensors: %q", c.Export.UnknownSensors)
+		}
+	}
+
+	if c.Registry.ReloadInterval < 0 {
+		return errors.New("registry.reload-interval must be >= 0")
+	}
+
 	validateRule := func(name string, r RateRuleConfig) error {
 		if r.PerSecond < 0 {
 			return errors.New(name + ".per-second must be >= 0")
@@ -2,17 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/kvoloboi/telemetry/cmd/sink/config"
 	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/application/sink/dedup"
+	"github.com/kvoloboi/telemetry/internal/application/sink/exporter"
 	"github.com/kvoloboi/telemetry/internal/application/sink/ratelimit"
-	"github.com/kvoloboi/telemetry/internal/application/sink/telemetrylog"
+	"github.com/kvoloboi/telemetry/internal/application/sink/registry"
+	"github.com/kvoloboi/telemetry/internal/infrastructure/admin"
+	"github.com/kvoloboi/telemetry/internal/infrastructure/postgres"
 	"github.com/kvoloboi/telemetry/internal/infrastructure/tlsconfig"
 	transportgrpc "github.com/kvoloboi/telemetry/internal/infrastructure/transport/grpc"
+	transporthttp "github.com/kvoloboi/telemetry/internal/infrastructure/transport/http"
+	"github.com/kvoloboi/telemetry/internal/metrics"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 )
@@ -35,16 +45,64 @@ func main() {
 	)
 	defer cancel()
 
-	wal, err := telemetrylog.Open(cfg.Sink.LogPath)
+	// the admin server starts first, so /readyz reports the sink as starting
+	// while the WAL is recovered
+	var started atomic.Bool
+	health := admin.NewHealth()
+	health.Add("startup", func() error {
+		if !started.Load() {
+			return errors.New("starting")
+		}
+		return nil
+	})
+	health.Add("shutdown", func() error {
+		if ctx.Err() != nil {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
+
+	var adminServer *admin.Server
+	if cfg.Admin.Address != "" {
+		var err error
+		adminServer, err = admin.NewServer(cfg.Admin.Address, logger)
+		if err != nil {
+			logger.Error("failed to start admin server", "err", err)
+			return
+		}
+		admin.RegisterHealth(adminServer, health)
+
+		go func() {
+			if err := adminServer.Run(); err != nil {
+				logger.Error("admin server failed", "err", err)
+				cancel()
+			}
+		}()
+	}
+
+	wal, err := telemetrylog.Open(cfg.Sink.LogPath, &telemetrylog.Config{
+		SegmentMaxBytes: cfg.Sink.SegmentMaxBytes,
+		SegmentMaxAge:   cfg.Sink.SegmentMaxAge,
+		SyncMode:        telemetrylog.SyncMode(cfg.Sink.Fsync),
+		SyncInterval:    cfg.Sink.FsyncInterval,
+		Compression:     telemetrylog.Codec(cfg.Sink.Compression),
+		FormatVersion:   uint8(cfg.Sink.FormatVersion),
+		StrictRecovery:  cfg.Sink.StrictRecovery,
+	})
 	if err != nil {
 		logger.Error("failed to open telemetry log", "err", err)
 		return
 	}
 	defer wal.Close()
+	health.Add("wal", wal.Err)
+
+	reg := metrics.NewRegistry()
+	wal.RegisterMetrics(reg)
 
 	ch := make(chan sink.TelemetryItem, cfg.Sink.QueueSize)
 
-	baseIngestor := sink.NewChannelIngestor(ch, logger)
+	baseIngestor := sink.NewChannelIngestor(ch, cfg.Overload, logger)
+	baseIngestor.RegisterMetrics(reg)
 
 	var ingestor sink.TelemetryIngestor = baseIngestor
 
@@ -67,11 +125,66 @@ func main() {
 	}
 
 	if len(rules) > 0 {
-		ingestor = ratelimit.NewRateLimitedIngestor(baseIngestor, *ratelimit.NewIngestRatePolicy(rules...))
+		limited := ratelimit.NewRateLimitedIngestor(baseIngestor, *ratelimit.NewIngestRatePolicy(rules...))
+		limited.RegisterMetrics(reg)
+		ingestor = limited
+	}
+
+	var (
+		sensors    *registry.Registry
+		registered *registry.RegisteredIngestor
+	)
+	if cfg.Registry.Path != "" {
+		sensors, err = registry.Open(cfg.Registry.Path, logger)
+		if err != nil {
+			logger.Error("failed to load sensor registry", "err", err)
+			return
+		}
+		if cfg.Registry.ReloadInterval > 0 {
+			go sensors.Watch(ctx, cfg.Registry.ReloadInterval)
+		}
+
+		registered = registry.NewRegisteredIngestor(ingestor, sensors, logger)
+		registered.RegisterMetrics(reg)
+		ingestor = registered
+	}
+
+	// outermost, so duplicates do not count against rate limits
+	var deduped *dedup.DedupIngestor
+	if cfg.Sink.Dedup {
+		marks := wal.Marks()
+		logger.Info("recovered node high-water marks", "sensors", len(marks))
+
+		deduped = dedup.NewDedupIngestor(ingestor, marks, logger)
+		deduped.RegisterMetrics(reg)
+		ingestor = deduped
 	}
 
 	worker := sink.NewTelemetryWorker(ch, wal, cfg.Batch, logger)
+	worker.RegisterMetrics(reg)
 	worker.Start(ctx)
+	health.Add("worker", func() error {
+		if !worker.Running() {
+			return errors.New("worker stopped")
+		}
+		return nil
+	})
+
+	retention := sink.NewRetentionWorker(wal.Dir(), cfg.Retention, logger)
+	retention.Start(ctx)
+
+	if cfg.Export.PostgresDSN != "" {
+		store, err := postgres.NewMeasurementStore(ctx, cfg.Export.PostgresDSN, cfg.Export.Name)
+		if err != nil {
+			logger.Error("failed to connect export store", "err", err)
+			return
+		}
+		defer store.Close()
+
+		exp := exporter.NewExporter(wal, store, cfg.Export, retention, logger)
+		exp.RegisterMetrics(reg)
+		exp.Start(ctx)
+	}
 
 	tls, err := tlsconfig.ServerTLSConfig(cfg.Transport.TLS)
 
@@ -88,11 +201,20 @@ func main() {
 		)
 	}
 
+	if adminServer != nil {
+		admin.RegisterIngest(adminServer, baseIngestor)
+		adminServer.Handle("GET /metrics", reg.Handler())
+		if sensors != nil {
+			admin.RegisterRegistry(adminServer, sensors, registered, cfg.Admin.RegistryWrites)
+		}
+	}
+
 	// Transport
 	server, err := transportgrpc.NewGRPCServer(
 		ctx,
 		cfg.Transport.SinkAddress,
 		ingestor,
+		wal,
 		logger,
 		opts...,
 	)
@@ -101,6 +223,7 @@ func main() {
 		logger.Error("failed to start grpc server", "err", err)
 		return
 	}
+	server.RegisterMetrics(reg)
 
 	go func() {
 		if err := server.Run(); err != nil {
@@ -109,13 +232,62 @@ func main() {
 		}
 	}()
 
+	var httpServer *transporthttp.HTTPServer
+	if cfg.Transport.HTTPAddress != "" {
+		httpServer, err = transporthttp.NewHTTPServer(
+			ctx,
+			cfg.Transport.HTTPAddress,
+			ingestor,
+			wal,
+			logger,
+			tls,
+		)
+		if err != nil {
+			logger.Error("failed to start http server", "err", err)
+			return
+		}
+
+		go func() {
+			if err := httpServer.Run(); err != nil {
+				logger.Error("HTTP server failed", "err", err)
+				cancel()
+			}
+		}()
+	}
+
+	started.Store(true)
+	logger.Info("sink ready")
+
 	// ---- Wait for shutdown signal ----
 	<-ctx.Done()
 	logger.Info("shutdown signal received")
 
+	// /readyz fails from here on; give load balancers time to notice
+	server.Drain()
+	if cfg.Sink.DrainDelay > 0 {
+		logger.Info("draining before shutdown", "delay", cfg.Sink.DrainDelay)
+		time.Sleep(cfg.Sink.DrainDelay)
+	}
+
 	server.Shutdown(cfg.Sink.ShutdownTimeout)
 
+	if httpServer != nil {
+		httpServer.Shutdown(cfg.Sink.ShutdownTimeout)
+	}
+
+	if adminServer != nil {
+		adminServer.Shutdown(cfg.Sink.ShutdownTimeout)
+	}
+
 	ingestor.Close()
 
+	// the worker appends whatever is still queued before the log is closed
+	<-worker.Done()
+
+	if deduped != nil {
+		logger.Info("dropped duplicate telemetry", "count", deduped.Duplicates())
+	}
+	logger.Info("refused telemetry on overload", "count", baseIngestor.Stats().Dropped)
+
 	logger.Info("sink shutdown complete")
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+func runDump(args []string) error {
+	var filter eventFilter
+
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	filter.register(fs)
+	fs.Parse(args)
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	return filter.each(func(seq uint64, e domain.Telemetry) error {
+		_, err := fmt.Fprintf(w, "seq=%-8d %s  %-24s %g\n",
+			seq,
+			e.Timestamp.Time().UTC().Format(time.RFC3339Nano),
+			e.Sensor.String(),
+			e.Value.Float64(),
+		)
+		return err
+	})
+}
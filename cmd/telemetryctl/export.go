@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+type eventJSON struct {
+	Seq       uint64  `json:"seq"`
+	Sensor    string  `json:"sensor"`
+	Value     float64 `json:"value"`
+	Timestamp string  `json:"timestamp"`
+}
+
+func runExport(args []string) error {
+	var filter eventFilter
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	filter.register(fs)
+	format := fs.String("format", "csv", "output format: csv or jsonl")
+	out := fs.String("out", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	var dst io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dst = f
+	}
+
+	w := bufio.NewWriter(dst)
+
+	var err error
+	switch *format {
+	case "csv":
+		err = exportCSV(w, &filter)
+	case "jsonl":
+		err = exportJSONL(w, &filter)
+	default:
+		return fmt.Errorf("unsupported format: %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func exportCSV(w io.Writer, filter *eventFilter) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"seq", "sensor", "timestamp", "value"}); err != nil {
+		return err
+	}
+
+	err := filter.each(func(seq uint64, e domain.Telemetry) error {
+		return cw.Write([]string{
+			strconv.FormatUint(seq, 10),
+			e.Sensor.String(),
+			e.Timestamp.Time().UTC().Format(time.RFC3339Nano),
+			strconv.FormatFloat(e.Value.Float64(), 'g', -1, 64),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportJSONL(w io.Writer, filter *eventFilter) error {
+	enc := json.NewEncoder(w)
+
+	return filter.each(func(seq uint64, e domain.Telemetry) error {
+		return enc.Encode(eventJSON{
+			Seq:       seq,
+			Sensor:    e.Sensor.String(),
+			Value:     e.Value.Float64(),
+			Timestamp: e.Timestamp.Time().UTC().Format(time.RFC3339Nano),
+		})
+	})
+}
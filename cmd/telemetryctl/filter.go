@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// timeFlag is an optional RFC 3339 timestamp flag.
+type timeFlag struct {
+	t time.Time
+}
+
+func (f *timeFlag) String() string {
+	if f.t.IsZero() {
+		return ""
+	}
+	return f.t.Format(time.RFC3339Nano)
+}
+
+func (f *timeFlag) Set(value string) error {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return fmt.Errorf("expected RFC 3339 time: %w", err)
+	}
+	f.t = t
+	return nil
+}
+
+// eventFilter selects events by sensor and time range [from, to).
+type eventFilter struct {
+	dir     string
+	sensors string
+	from    timeFlag
+	to      timeFlag
+	limit   int
+}
+
+func (f *eventFilter) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.dir, "dir", "./telemetry.wal", "path to telemetry WAL directory")
+	fs.StringVar(&f.sensors, "sensor", "", "comma-separated sensor names to include (default all)")
+	fs.Var(&f.from, "from", "include events at or after this RFC 3339 time")
+	fs.Var(&f.to, "to", "include events before this RFC 3339 time")
+	fs.IntVar(&f.limit, "limit", 0, "stop after this many events (0 = unlimited)")
+}
+
+func (f *eventFilter) sensorSet() map[string]bool {
+	if f.sensors == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, s := range strings.Split(f.sensors, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			set[s] = true
+		}
+	}
+	return set
+}
+
+func (f *eventFilter) match(sensors map[string]bool, e domain.Telemetry) bool {
+	if sensors != nil && !sensors[e.Sensor.String()] {
+		return false
+	}
+	ts := e.Timestamp.Time()
+	if !f.from.t.IsZero() && ts.Before(f.from.t) {
+		return false
+	}
+	if !f.to.t.IsZero() && !ts.Before(f.to.t) {
+		return false
+	}
+	return true
+}
+
+// each calls fn for every matching event, in log order.
+// When -from is set the sparse index is used to skip older batches.
+func (f *eventFilter) each(fn func(seq uint64, e domain.Telemetry) error) error {
+	var (
+		r   *telemetrylog.BatchReader
+		err error
+	)
+	if f.from.t.IsZero() {
+		r, err = telemetrylog.NewBatchReader(f.dir)
+	} else {
+		r, err = telemetrylog.NewBatchReaderFromTime(f.dir, f.from.t)
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	sensors := f.sensorSet()
+	var n int
+
+	for {
+		batch, err := r.ReadBatch()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, telemetrylog.ErrPartialBatch) {
+			// a running sink may be in the middle of an append
+			fmt.Fprintln(os.Stderr, "warning: stopped at incomplete record")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, e := range batch.Events {
+			if !f.match(sensors, e) {
+				continue
+			}
+			if err := fn(batch.Seq, e); err != nil {
+				return err
+			}
+			n++
+			if f.limit > 0 && n >= f.limit {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	dir := fs.String("dir", "./telemetry.wal", "path to telemetry WAL directory")
+	fs.Parse(args)
+
+	summaries, err := telemetrylog.InspectSegments(*dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SEGMENT\tBYTES\tBATCHES\tEVENTS\tSEQ\tEVENT TIME\tFORMAT\tCOMPRESSED\tSTATUS")
+
+	var (
+		totalBytes   int64
+		totalBatches int
+		totalEvents  int
+	)
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%d\t%s\n",
+			s.Path,
+			s.Size,
+			s.Batches,
+			s.Events,
+			seqRange(s),
+			timeRange(s.MinEventTime, s.MaxEventTime),
+			versions(s.Versions),
+			s.Compressed,
+			status(s),
+		)
+		totalBytes += s.Size
+		totalBatches += s.Batches
+		totalEvents += s.Events
+	}
+	w.Flush()
+
+	fmt.Printf("\nsegments=%d bytes=%d batches=%d events=%d", len(summaries), totalBytes, totalBatches, totalEvents)
+	if len(summaries) > 0 {
+		fmt.Printf(" seq=[%d, %d)", summaries[0].FirstSeq, summaries[len(summaries)-1].NextSeq)
+	}
+	fmt.Println()
+
+	return nil
+}
+
+func seqRange(s telemetrylog.SegmentSummary) string {
+	if s.Batches == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d-%d", s.FirstSeq, s.NextSeq-1)
+}
+
+func timeRange(from, to time.Time) string {
+	if from.IsZero() {
+		return "-"
+	}
+	return from.UTC().Format(time.RFC3339) + " .. " + to.UTC().Format(time.RFC3339)
+}
+
+func versions(v map[uint8]int) string {
+	var out string
+	for _, ver := range []uint8{1, 2} {
+		if v[ver] == 0 {
+			continue
+		}
+		if out != "" {
+			out += ","
+		}
+		out += fmt.Sprintf("v%d", ver)
+	}
+	if out == "" {
+		return "-"
+	}
+	return out
+}
+
+func status(s telemetrylog.SegmentSummary) string {
+	switch {
+	case s.Intact():
+		return "ok"
+	case s.PartialTail():
+		return fmt.Sprintf("partial record at %d", s.ValidBytes)
+	default:
+		return fmt.Sprintf("corrupt at %d: %v", s.ValidBytes, s.Err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `telemetryctl inspects telemetry WAL directories written by the sink.
+
+Usage:
+  telemetryctl <command> [flags]
+
+Commands:
+  inspect   per-segment stats: seq range, batch and event counts, event time range
+  verify    CRC and payload check of every record, reports the first corruption
+  dump      print events in human-readable form
+  export    write events as CSV or JSON Lines
+  salvage   copy all intact batches into a new log, skipping corrupt regions
+  report    per-room, per-second V/R/I report, as sql/report.sql computes it
+
+All commands only read the log and are safe to run against a live sink.
+Run "telemetryctl <command> -h" for command flags.
+`
+
+type command func(args []string) error
+
+func main() {
+	commands := map[string]command{
+		"inspect": runInspect,
+		"verify":  runVerify,
+		"dump":    runDump,
+		"export":  runExport,
+		"salvage": runSalvage,
+		"report":  runReport,
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink/report"
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// roomsFile maps room names to their sensors by type:
+//
+//	{"room_A": {"V": ["A_V1"], "R": ["A_R1", "A_R2"]}}
+type roomsFile map[string]map[string][]string
+
+func loadSensors(path string) ([]report.Sensor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rooms roomsFile
+	if err := json.Unmarshal(data, &rooms); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	var sensors []report.Sensor
+	seen := make(map[string]string)
+
+	for room, types := range rooms {
+		for typ, names := range types {
+			sensorType, err := domain.NewSensorType(typ)
+			if err != nil {
+				return nil, fmt.Errorf("room %s: %w: %q", room, err, typ)
+			}
+			for _, name := range names {
+				if other, ok := seen[name]; ok {
+					return nil, fmt.Errorf("sensor %s is mapped to rooms %s and %s", name, other, room)
+				}
+				seen[name] = room
+				sensors = append(sensors, report.Sensor{Name: name, Room: room, Type: sensorType})
+			}
+		}
+	}
+
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].Name < sensors[j].Name })
+	return sensors, nil
+}
+
+func runReport(args []string) error {
+	var from, to timeFlag
+
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	dir := fs.String("dir", "./telemetry.wal", "path to telemetry WAL directory")
+	rooms := fs.String("rooms", "", "JSON file mapping rooms to their V and R sensors")
+	fs.Var(&from, "from", "report seconds at or after this RFC 3339 time (required)")
+	fs.Var(&to, "to", "report seconds before this RFC 3339 time (required)")
+	lookback := fs.Duration("lookback", time.Hour, "how far before -from to look for R values to carry forward")
+	format := fs.String("format", "table", "output format: table or csv")
+	fs.Parse(args)
+
+	if *rooms == "" {
+		return errors.New("-rooms is required")
+	}
+	if from.t.IsZero() || to.t.IsZero() {
+		return errors.New("-from and -to are required")
+	}
+	if *lookback < 0 {
+		return errors.New("-lookback must be >= 0")
+	}
+
+	sensors, err := loadSensors(*rooms)
+	if err != nil {
+		return err
+	}
+
+	rows, err := report.Build(*dir, sensors, report.Params{
+		From:     from.t,
+		To:       to.t,
+		Lookback: *lookback,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+
+	switch *format {
+	case "table":
+		err = reportTable(w, rows)
+	case "csv":
+		err = reportCSV(w, rows)
+	default:
+		return fmt.Errorf("unsupported format: %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// the values are rounded by report.Rows already
+func formatRow(r report.Row) []string {
+	return []string{
+		r.Room,
+		r.Timestamp.UTC().Format(time.RFC3339),
+		strconv.FormatFloat(r.V, 'f', 2, 64),
+		strconv.FormatFloat(r.R, 'f', 2, 64),
+		strconv.FormatFloat(r.I, 'f', 3, 64),
+	}
+}
+
+func reportTable(w io.Writer, rows []report.Row) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROOM\tTIMESTAMP\tV\tR\tI")
+
+	for _, r := range rows {
+		f := formatRow(r)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", f[0], f[1], f[2], f[3], f[4])
+	}
+
+	return tw.Flush()
+}
+
+func reportCSV(w io.Writer, rows []report.Row) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"room", "timestamp", "v", "r", "i"}); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := cw.Write(formatRow(r)); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// runSalvage copies every intact batch into a new log, skipping corrupt regions.
+// The source log is left untouched.
+func runSalvage(args []string) error {
+	fs := flag.NewFlagSet("salvage", flag.ExitOnError)
+	dir := fs.String("dir", "./telemetry.wal", "path to the damaged telemetry WAL directory")
+	out := fs.String("out", "", "path to the new WAL directory (must not contain a log)")
+	fs.Parse(args)
+
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	report, err := telemetrylog.Salvage(*dir, *out)
+	if err != nil {
+		return err
+	}
+
+	for _, l := range report.Lost {
+		fmt.Printf("lost %s bytes [%d, %d) (%d bytes)\n", l.Path, l.Offset, l.End, l.End-l.Offset)
+	}
+	for _, g := range report.SeqGaps {
+		fmt.Printf("seq gap [%d, %d) (%d batches)\n", g.From, g.To, g.To-g.From)
+	}
+	if report.Duplicates > 0 {
+		fmt.Printf("skipped %d batches with an already salvaged seq\n", report.Duplicates)
+	}
+
+	fmt.Printf("salvaged %d batches from %d segments into %s, lost %d bytes\n",
+		report.Batches, report.Segments, *out, report.LostBytes())
+	return nil
+}
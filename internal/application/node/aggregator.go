@@ -0,0 +1,254 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// AggregateStat is a statistic the Aggregator emits per window.
+type AggregateStat string
+
+const (
+	StatMin   AggregateStat = "min"
+	StatMax   AggregateStat = "max"
+	StatAvg   AggregateStat = "avg"
+	StatCount AggregateStat = "count"
+	StatLast  AggregateStat = "last"
+)
+
+// aggregateGrace is how long a window stays open after its end for readings
+// still on their way through the queue, and how often windows are checked.
+const aggregateGrace = 100 * time.Millisecond
+
+// AggregateConfig selects how the Aggregator reduces the readings of one sensor:
+// either to statistics per window or to the readings that moved past a deadband.
+type AggregateConfig struct {
+	Window   time.Duration   // > 0 emits Stats per window instead of the readings
+	Stats    []AggregateStat // with Window, default avg
+	Deadband *float64        // forwards only readings that moved by more than this, nil = all
+}
+
+func (c AggregateConfig) Validate() error {
+	if c.Window < 0 {
+		return errors.New("window must be >= 0")
+	}
+	if c.Window == 0 && len(c.Stats) > 0 {
+		return errors.New("aggregate needs a window")
+	}
+	if c.Window > 0 && c.Deadband != nil {
+		return errors.New("window and deadband cannot be combined")
+	}
+	if c.Deadband != nil && *c.Deadband < 0 {
+		return errors.New("deadband must be >= 0")
+	}
+
+	seen := make(map[AggregateStat]bool, len(c.Stats))
+	for _, stat := range c.Stats {
+		switch stat {
+		case StatMin, StatMax, StatAvg, StatCount, StatLast:
+		default:
+			return fmt.Errorf("unsupported aggregate %q", stat)
+		}
+		if seen[stat] {
+			return fmt.Errorf("aggregate %q listed twice", stat)
+		}
+		seen[stat] = true
+	}
+	return nil
+}
+
+func (c AggregateConfig) stats() []AggregateStat {
+	if len(c.Stats) == 0 {
+		return []AggregateStat{StatAvg}
+	}
+	return c.Stats
+}
+
+// Names returns the sensors the windows of sensor are emitted as: sensor itself
+// for a single statistic, sensor.stat for each of several. Without a window it is sensor.
+func (c AggregateConfig) Names(sensor string) []string {
+	stats := c.stats()
+	if c.Window == 0 || len(stats) == 1 {
+		return []string{sensor}
+	}
+
+	names := make([]string, len(stats))
+	for i, stat := range stats {
+		names[i] = sensor + "." + string(stat)
+	}
+	return names
+}
+
+// aggregateState is the open window or the deadband of one sensor.
+type aggregateState struct {
+	cfg      AggregateConfig
+	stats    []AggregateStat
+	names    []string
+	counters *SensorCounters
+
+	start, end time.Time // of the open window, zero if none
+	count      int
+	min, max   float64
+	sum, last  float64
+
+	forwarded bool // a reading passed the deadband
+	reference float64
+}
+
+// Aggregator sits between the producers and the dispatcher and reduces the
+// readings of the sensors it is configured for. Windows are aligned to the
+// clock, and the readings emitted for a window carry the time it started.
+// Readings of other sensors pass through unchanged.
+type Aggregator struct {
+	in     <-chan domain.Telemetry
+	out    chan<- domain.Telemetry
+	logger *slog.Logger
+	states map[string]*aggregateState
+}
+
+func NewAggregator(
+	in <-chan domain.Telemetry,
+	out chan<- domain.Telemetry,
+	sensors map[string]AggregateConfig,
+	logger *slog.Logger,
+	counters *Counters,
+) (*Aggregator, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if counters == nil {
+		counters = NewCounters()
+	}
+
+	states := make(map[string]*aggregateState, len(sensors))
+	for sensor, cfg := range sensors {
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("sensor %q: %w", sensor, err)
+		}
+
+		names := cfg.Names(sensor)
+		for _, name := range names {
+			if _, err := domain.NewSensorName(name); err != nil {
+				return nil, fmt.Errorf("sensor %q: %w", name, err)
+			}
+			// emitted readings are counted as sent under these names
+			counters.Sensor(name)
+		}
+
+		states[sensor] = &aggregateState{
+			cfg:      cfg,
+			stats:    cfg.stats(),
+			names:    names,
+			counters: counters.Sensor(sensor),
+		}
+	}
+
+	return &Aggregator{
+		in:     in,
+		out:    out,
+		logger: logger,
+		states: states,
+	}, nil
+}
+
+// Run reduces readings until in is closed, then emits the open windows and returns.
+// It waits for room in out, so a stalled dispatcher backs up into in.
+func (a *Aggregator) Run() {
+	ticker := time.NewTicker(aggregateGrace)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m, ok := <-a.in:
+			if !ok {
+				for _, s := range a.states {
+					a.flush(s)
+				}
+				a.logger.Info("aggregator stopped")
+				return
+			}
+			a.add(m)
+		case now := <-ticker.C:
+			for _, s := range a.states {
+				if !s.end.IsZero() && now.After(s.end.Add(aggregateGrace)) {
+					a.flush(s)
+				}
+			}
+		}
+	}
+}
+
+func (a *Aggregator) add(m domain.Telemetry) {
+	s, ok := a.states[m.Sensor.String()]
+	if !ok {
+		a.out <- m
+		return
+	}
+
+	v := m.Value.Float64()
+
+	if s.cfg.Window == 0 {
+		if s.cfg.Deadband != nil && s.forwarded && math.Abs(v-s.reference) <= *s.cfg.Deadband {
+			s.counters.IncFiltered()
+			return
+		}
+		s.forwarded, s.reference = true, v
+		a.out <- m
+		return
+	}
+
+	ts := m.Timestamp.Time()
+	if !s.end.IsZero() && !ts.Before(s.end) {
+		a.flush(s)
+	}
+	if s.end.IsZero() {
+		s.start = ts.Truncate(s.cfg.Window)
+		s.end = s.start.Add(s.cfg.Window)
+		s.count, s.min, s.max, s.sum = 0, v, v, 0
+	}
+
+	// a reading older than the open window, whose own was emitted already, joins the open one
+	s.count++
+	s.min = min(s.min, v)
+	s.max = max(s.max, v)
+	s.sum += v
+	s.last = v
+	s.counters.IncAggregated()
+}
+
+// flush emits the statistics of the open window of s, if any, and closes it.
+func (a *Aggregator) flush(s *aggregateState) {
+	if s.end.IsZero() {
+		return
+	}
+
+	for i, stat := range s.stats {
+		var v float64
+		switch stat {
+		case StatMin:
+			v = s.min
+		case StatMax:
+			v = s.max
+		case StatAvg:
+			v = s.sum / float64(s.count)
+		case StatCount:
+			v = float64(s.count)
+		case StatLast:
+			v = s.last
+		}
+
+		m, err := domain.NewTelemetry(s.names[i], v, s.start)
+		if err != nil {
+			a.logger.Error("cannot emit aggregate", "sensor", s.names[i], "err", err)
+			continue
+		}
+		a.out <- m
+	}
+
+	s.start, s.end = time.Time{}, time.Time{}
+}
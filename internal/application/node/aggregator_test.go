@@ -0,0 +1,221 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+var aggregateBase = time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+
+// reading is a reading of sensor at offset from aggregateBase.
+type reading struct {
+	sensor string
+	offset time.Duration
+	value  float64
+}
+
+func (r reading) telemetry(t *testing.T) domain.Telemetry {
+	t.Helper()
+
+	m, err := domain.NewTelemetry(r.sensor, r.value, aggregateBase.Add(r.offset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// aggregate runs an Aggregator over readings until its input is closed
+// and returns what it emitted.
+func aggregate(t *testing.T, sensors map[string]AggregateConfig, counters *Counters, readings ...reading) []reading {
+	t.Helper()
+
+	in := make(chan domain.Telemetry, len(readings))
+	out := make(chan domain.Telemetry, 100)
+	a, err := NewAggregator(in, out, sensors, nil, counters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range readings {
+		in <- r.telemetry(t)
+	}
+	close(in)
+	a.Run()
+	close(out)
+
+	var got []reading
+	for m := range out {
+		got = append(got, reading{m.Sensor.String(), m.Timestamp.Time().Sub(aggregateBase), m.Value.Float64()})
+	}
+	return got
+}
+
+func assertReadings(t *testing.T, got []reading, want ...reading) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("emitted %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("emitted %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestAggregatorWindows(t *testing.T) {
+	window := map[string]AggregateConfig{"temp": {Window: time.Second}}
+
+	for _, tc := range []struct {
+		name     string
+		readings []reading
+		want     []reading
+	}{
+		{
+			name: "aligned to the clock",
+			readings: []reading{
+				{"temp", 300 * time.Millisecond, 1},
+				{"temp", 900 * time.Millisecond, 3},
+				{"temp", 1200 * time.Millisecond, 10},
+			},
+			// the second window is emitted once the input is closed
+			want: []reading{{"temp", 0, 2}, {"temp", time.Second, 10}},
+		},
+		{
+			name: "late reading joins the open window",
+			readings: []reading{
+				{"temp", 500 * time.Millisecond, 1},
+				{"temp", 2200 * time.Millisecond, 4},
+				{"temp", 800 * time.Millisecond, 2},
+			},
+			want: []reading{{"temp", 0, 1}, {"temp", 2 * time.Second, 3}},
+		},
+		{
+			name: "other sensors pass through",
+			readings: []reading{
+				{"temp", 100 * time.Millisecond, 1},
+				{"hum", 200 * time.Millisecond, 40},
+				{"temp", 300 * time.Millisecond, 3},
+			},
+			want: []reading{{"hum", 200 * time.Millisecond, 40}, {"temp", 0, 2}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assertReadings(t, aggregate(t, window, nil, tc.readings...), tc.want...)
+		})
+	}
+}
+
+func TestAggregatorStatNames(t *testing.T) {
+	cfg := AggregateConfig{
+		Window: time.Minute,
+		Stats:  []AggregateStat{StatMin, StatMax, StatAvg, StatCount, StatLast},
+	}
+	counters := NewCounters()
+
+	got := aggregate(t, map[string]AggregateConfig{"temp": cfg}, counters,
+		reading{"temp", 10 * time.Second, 4},
+		reading{"temp", 20 * time.Second, 1},
+		reading{"temp", 30 * time.Second, 7},
+	)
+
+	assertReadings(t, got,
+		reading{"temp.min", 0, 1},
+		reading{"temp.max", 0, 7},
+		reading{"temp.avg", 0, 4},
+		reading{"temp.count", 0, 3},
+		reading{"temp.last", 0, 7},
+	)
+	if got := counters.Sensor("temp").GetAggregated(); got != 3 {
+		t.Fatalf("aggregated %d readings, want 3", got)
+	}
+	// a single statistic keeps the sensor name
+	if names := (AggregateConfig{Window: time.Minute, Stats: []AggregateStat{StatMax}}).Names("temp"); len(names) != 1 || names[0] != "temp" {
+		t.Fatalf("names = %v, want [temp]", names)
+	}
+}
+
+func TestAggregatorDeadband(t *testing.T) {
+	band := 0.5
+	counters := NewCounters()
+
+	got := aggregate(t, map[string]AggregateConfig{"temp": {Deadband: &band}}, counters,
+		reading{"temp", 0, 10},
+		reading{"temp", 1 * time.Second, 10.3},
+		reading{"temp", 2 * time.Second, 10.6},
+		// within the band of 10.6, the last reading forwarded
+		reading{"temp", 3 * time.Second, 10.2},
+		reading{"temp", 4 * time.Second, 9.9},
+	)
+
+	assertReadings(t, got,
+		reading{"temp", 0, 10},
+		reading{"temp", 2 * time.Second, 10.6},
+		reading{"temp", 4 * time.Second, 9.9},
+	)
+	if got := counters.Sensor("temp").GetFiltered(); got != 2 {
+		t.Fatalf("filtered %d readings, want 2", got)
+	}
+}
+
+func TestAggregatorFlushesAfterGrace(t *testing.T) {
+	in := make(chan domain.Telemetry, 1)
+	out := make(chan domain.Telemetry, 1)
+	a, err := NewAggregator(in, out, map[string]AggregateConfig{"temp": {Window: time.Second}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		a.Run()
+	}()
+	defer func() {
+		close(in)
+		<-stopped
+	}()
+
+	// the window ended long ago, so it is emitted without a newer reading
+	m, err := domain.NewTelemetry("temp", 5, aggregateBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in <- m
+
+	select {
+	case got := <-out:
+		if got.Value.Float64() != 5 || !got.Timestamp.Time().Equal(aggregateBase) {
+			t.Fatalf("emitted %v at %v, want 5 at %v", got.Value.Float64(), got.Timestamp.Time(), aggregateBase)
+		}
+	case <-time.After(10 * aggregateGrace):
+		t.Fatal("window not emitted after its grace period")
+	}
+}
+
+func TestAggregateConfigValidate(t *testing.T) {
+	band, negative := 1.0, -1.0
+
+	for _, tc := range []struct {
+		name string
+		cfg  AggregateConfig
+		ok   bool
+	}{
+		{name: "window", cfg: AggregateConfig{Window: time.Second, Stats: []AggregateStat{StatMin, StatMax}}, ok: true},
+		{name: "deadband", cfg: AggregateConfig{Deadband: &band}, ok: true},
+		{name: "negative window", cfg: AggregateConfig{Window: -time.Second}},
+		{name: "stats without window", cfg: AggregateConfig{Stats: []AggregateStat{StatAvg}}},
+		{name: "window and deadband", cfg: AggregateConfig{Window: time.Second, Deadband: &band}},
+		{name: "negative deadband", cfg: AggregateConfig{Deadband: &negative}},
+		{name: "unknown stat", cfg: AggregateConfig{Window: time.Second, Stats: []AggregateStat{"median"}}},
+		{name: "stat twice", cfg: AggregateConfig{Window: time.Second, Stats: []AggregateStat{StatMin, StatMin}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+				t.Fatalf("Validate() = %v", err)
+			}
+		})
+	}
+}
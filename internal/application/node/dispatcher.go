@@ -3,34 +3,67 @@ package node
 import (
 	"context"
 	"errors"
+	"hash/fnv"
 	"io"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/kvoloboi/telemetry/internal/application/common"
 	"github.com/kvoloboi/telemetry/internal/domain"
 )
 
+// TelemetryDispatcher delivers the queued readings through one worker per sender.
+// Each worker takes the readings of its share of the sensors in order and delivers
+// them through its own sender, so a reading waiting for a retry, whether in the
+// dispatcher or in place in a BatchSender, holds up only the sensors of its worker.
+// A single sender is served from a single loop.
 type TelemetryDispatcher struct {
 	queue      <-chan domain.Telemetry
-	sender     TelemetrySender
+	senders    []TelemetrySender
 	maxRetries int
 	backoff    common.Backoff
 	logger     *slog.Logger
 	counters   *Counters
+	sequence   *Sequence
 	cancel     context.CancelFunc
 	stopOnce   sync.Once
+
+	spill        *Spill
+	spillTimeout time.Duration
+	spillFull    atomic.Bool   // to log only when the spill fills up or has room again
+	committed    chan struct{} // closed once commitSpill returned
 }
 
 type DispatcherConfig struct {
 	MaxRetries int
 	Backoff    common.Backoff
+
+	// Sequence, if set, numbers every reading as it is taken from the queue, before
+	// its first attempt. The reading keeps its number through retries and the spill,
+	// so the sink recognises every resend of it. nil leaves readings unnumbered.
+	Sequence *Sequence
+
+	// Spill takes the readings the sender fails or stalls on, and new readings too
+	// until the spilled ones are handed back to the sender in order. nil counts them failed.
+	Spill *Spill
+	// SpillTimeout is how long a reading may wait for the sender to take it before it is spilled.
+	SpillTimeout time.Duration
 }
 
+const (
+	// spillChunkSize is about how many spilled readings are handed to the sender at once.
+	spillChunkSize = 1000
+	// spillChunks is how many handed chunks may wait for their outcomes.
+	spillChunks = 4
+	// maxSpillAttempt caps the backoff attempt of spill delivery, which retries indefinitely.
+	maxSpillAttempt = 16
+)
+
 func NewTelemetryDispatcher(
 	queue <-chan domain.Telemetry,
-	sender TelemetrySender,
+	senders []TelemetrySender,
 	cfg DispatcherConfig,
 	logger *slog.Logger,
 	counters *Counters,
@@ -45,42 +78,78 @@ func NewTelemetryDispatcher(
 
 	return &TelemetryDispatcher{
 		queue:      queue,
-		sender:     sender,
+		senders:    senders,
 		logger:     logger,
 		counters:   counters,
 		maxRetries: cfg.MaxRetries,
 		backoff:    cfg.Backoff,
+		sequence:   cfg.Sequence,
 		cancel:     cancel,
+
+		spill:        cfg.Spill,
+		spillTimeout: cfg.SpillTimeout,
 	}
 }
 
 func (d *TelemetryDispatcher) Run(ctx context.Context) {
 	defer d.close()
 
+	if d.spill != nil {
+		spillCtx, stopSpill := context.WithCancel(ctx)
+		spillDone := make(chan struct{})
+		go func() {
+			defer close(spillDone)
+			d.runSpill(spillCtx)
+		}()
+		defer func() {
+			stopSpill()
+			<-spillDone
+		}()
+	}
+
+	if len(d.senders) > 1 {
+		d.runWorkers(ctx)
+		return
+	}
+
+	sender := d.senders[0]
+	if bs, ok := sender.(BatchSender); ok {
+		d.runBatched(ctx, bs)
+		return
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			d.drain()
+			d.drain(sender)
 			return
 		case m, ok := <-d.queue:
 			if !ok {
 				d.logger.Info("input channel closed")
 				return
 			}
-			d.dispatch(ctx, m)
+			if !d.number(&m) {
+				continue
+			}
+			if d.spilling() {
+				d.spillQueued(m, d.queue)
+				continue
+			}
+			d.dispatch(ctx, sender, m)
 		}
 	}
 }
 
 func (d *TelemetryDispatcher) dispatch(
 	ctx context.Context,
+	sender TelemetrySender,
 	msg domain.Telemetry,
 ) {
 	for attempt := 1; attempt <= d.maxRetries; attempt++ {
-		err := d.sender.Send(ctx, msg)
+		err := sender.Send(ctx, msg)
 
 		if err == nil {
-			d.counters.IncSent()
+			d.counters.Sensor(msg.Sensor.String()).IncSent()
 			return
 		}
 		// isNotRetriable := errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe)
@@ -88,11 +157,15 @@ func (d *TelemetryDispatcher) dispatch(
 			d.stopOnce.Do(func() {
 				d.cancel() // 🔥 propagates to producers
 			})
+			d.spillReadings([]domain.Telemetry{msg})
 			return
 		}
 
 		if attempt == d.maxRetries {
-			d.counters.IncFailed()
+			if !errors.Is(err, ErrRejected) && d.spillReadings([]domain.Telemetry{msg}) {
+				return
+			}
+			d.counters.Sensor(msg.Sensor.String()).IncFailed()
 			d.logger.Error(
 				"failed to send metric",
 				"sensor", msg.Sensor,
@@ -114,7 +187,7 @@ func (d *TelemetryDispatcher) dispatch(
 	}
 }
 
-func (d *TelemetryDispatcher) drain() {
+func (d *TelemetryDispatcher) drain(sender TelemetrySender) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -125,7 +198,14 @@ func (d *TelemetryDispatcher) drain() {
 				d.logger.Info("all telemetry drained")
 				return
 			}
-			d.dispatch(ctx, m)
+			if !d.number(&m) {
+				continue
+			}
+			if d.spilling() {
+				d.spillQueued(m, d.queue)
+				continue
+			}
+			d.dispatch(ctx, sender, m)
 		default:
 			d.logger.Info("queue empty, drain complete")
 			return
@@ -133,16 +213,514 @@ func (d *TelemetryDispatcher) drain() {
 	}
 }
 
+// runBatched hands readings to a BatchSender without waiting for their delivery,
+// so one request carries many readings. The sender retries readings in order
+// itself; those it gives up on are spilled.
+func (d *TelemetryDispatcher) runBatched(ctx context.Context, bs BatchSender) {
+	var inflight sync.WaitGroup
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.drainBatched(bs, &inflight)
+			d.awaitDelivery(&inflight, bs)
+			return
+		case m, ok := <-d.queue:
+			if !ok {
+				d.logger.Info("input channel closed")
+				d.awaitDelivery(&inflight, bs)
+				return
+			}
+			if !d.number(&m) {
+				continue
+			}
+			if d.spilling() {
+				d.spillQueued(m, d.queue)
+				continue
+			}
+			d.enqueue(ctx, bs, &inflight, m)
+		}
+	}
+}
+
+// drainBatched hands the queued readings to the sender, giving up
+// once the sender stops taking them for as long as drain would wait.
+func (d *TelemetryDispatcher) drainBatched(bs BatchSender, inflight *sync.WaitGroup) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for {
+		select {
+		case m, ok := <-d.queue:
+			if !ok {
+				return
+			}
+			if !d.number(&m) {
+				continue
+			}
+			if d.spilling() {
+				d.spillQueued(m, d.queue)
+				continue
+			}
+			d.enqueue(ctx, bs, inflight, m)
+		default:
+			return
+		}
+	}
+}
+
+func (d *TelemetryDispatcher) enqueue(
+	ctx context.Context,
+	bs BatchSender,
+	inflight *sync.WaitGroup,
+	msg domain.Telemetry,
+) {
+	inflight.Add(1)
+
+	// a sender that cannot take the reading in time is failing; spill rather than wait
+	if d.spill != nil && d.spillTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.spillTimeout)
+		defer cancel()
+	}
+
+	err := bs.Enqueue(ctx, msg, func(err error) {
+		d.delivered(inflight, msg, err)
+	})
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, io.ErrClosedPipe) {
+		d.stopOnce.Do(func() {
+			d.cancel()
+		})
+	}
+	if d.spillReadings([]domain.Telemetry{msg}) {
+		inflight.Done()
+		return
+	}
+	d.counters.Sensor(msg.Sensor.String()).IncFailed()
+	d.logger.Error("failed to send metric", "sensor", msg.Sensor, "error", err)
+	inflight.Done()
+}
+
+// delivered is called by the sender with the outcome of one reading.
+// The sender already retried it, so a reading that failed is spilled.
+func (d *TelemetryDispatcher) delivered(
+	inflight *sync.WaitGroup,
+	msg domain.Telemetry,
+	err error,
+) {
+	defer inflight.Done()
+
+	if err == nil {
+		d.counters.Sensor(msg.Sensor.String()).IncSent()
+		return
+	}
+	if !errors.Is(err, ErrRejected) && d.spillReadings([]domain.Telemetry{msg}) {
+		return
+	}
+	d.counters.Sensor(msg.Sensor.String()).IncFailed()
+	d.logger.Error(
+		"failed to send metric",
+		"sensor", msg.Sensor,
+		"error", err,
+	)
+}
+
+// awaitDelivery sends what the senders buffered and waits for all outcomes.
+// The senders flush at once, so one that cannot deliver does not hold up the others.
+func (d *TelemetryDispatcher) awaitDelivery(inflight *sync.WaitGroup, senders ...BatchSender) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+
+	var flushing sync.WaitGroup
+	for _, bs := range senders {
+		flushing.Add(1)
+		go func() {
+			defer flushing.Done()
+			if err := bs.Flush(ctx); err != nil {
+				d.logger.Warn("sender flush failed", "err", err)
+			}
+		}()
+	}
+	flushing.Wait()
+
+	select {
+	case <-done:
+		d.logger.Info("all telemetry delivered")
+	case <-ctx.Done():
+		d.logger.Warn("gave up waiting for telemetry delivery")
+	}
+}
+
+// spilling reports whether spilled readings are still to be handed to the sender,
+// so new ones must queue behind them in the spill.
+func (d *TelemetryDispatcher) spilling() bool {
+	return d.spill != nil && d.spill.Unhanded() > 0
+}
+
+// spillQueued spills m together with the readings queued behind it, as one batch.
+func (d *TelemetryDispatcher) spillQueued(m domain.Telemetry, queue <-chan domain.Telemetry) {
+	batch := []domain.Telemetry{m}
+
+collect:
+	for len(batch) < cap(queue) {
+		select {
+		case m, ok := <-queue:
+			if !ok {
+				break collect
+			}
+			if d.number(&m) {
+				batch = append(batch, m)
+			}
+		default:
+			break collect
+		}
+	}
+
+	if d.spillReadings(batch) {
+		return
+	}
+	for _, m := range batch {
+		d.counters.Sensor(m.Sensor.String()).IncFailed()
+	}
+}
+
+// runWorkers spreads the readings by sensor over one worker per sender. The workers deliver
+// them as the single loop would, dispatching or enqueueing one reading after the other.
+// A worker that falls behind, e.g. while it or its sender waits out a retry, holds up
+// the others only once its own queue, as large as the dispatcher's, is full.
+func (d *TelemetryDispatcher) runWorkers(ctx context.Context) {
+	var inflight sync.WaitGroup
+
+	// what is still queued once ctx is done gets as long to be delivered as drain gives it
+	drainCtx, cancelDrain := context.WithCancel(context.Background())
+	defer cancelDrain()
+	stopDrain := context.AfterFunc(ctx, func() {
+		time.AfterFunc(10*time.Second, cancelDrain)
+	})
+	defer stopDrain()
+
+	shards := make([]chan domain.Telemetry, len(d.senders))
+	var batched []BatchSender
+	var working sync.WaitGroup
+	for i, sender := range d.senders {
+		shards[i] = make(chan domain.Telemetry, cap(d.queue))
+		bs, ok := sender.(BatchSender)
+		if ok {
+			batched = append(batched, bs)
+		}
+
+		working.Add(1)
+		go func() {
+			defer working.Done()
+
+			for m := range shards[i] {
+				// spilled readings of the sensors of this worker are older than m
+				if d.spilling() {
+					d.spillQueued(m, shards[i])
+					continue
+				}
+
+				sendCtx := ctx
+				if ctx.Err() != nil {
+					sendCtx = drainCtx
+				}
+				if ok {
+					d.enqueue(sendCtx, bs, &inflight, m)
+				} else {
+					d.dispatch(sendCtx, sender, m)
+				}
+			}
+		}()
+	}
+
+route:
+	for {
+		select {
+		case <-ctx.Done():
+			// hand over what is queued; the workers deliver it with drainCtx
+			for {
+				select {
+				case m, ok := <-d.queue:
+					if !ok {
+						break route
+					}
+					if d.number(&m) {
+						shards[shardOf(m.Sensor, len(shards))] <- m
+					}
+				default:
+					d.logger.Info("queue empty, drain complete")
+					break route
+				}
+			}
+		case m, ok := <-d.queue:
+			if !ok {
+				d.logger.Info("input channel closed")
+				break route
+			}
+			if d.number(&m) {
+				shards[shardOf(m.Sensor, len(shards))] <- m
+			}
+		}
+	}
+
+	for _, shard := range shards {
+		close(shard)
+	}
+	working.Wait()
+
+	if len(batched) > 0 {
+		d.awaitDelivery(&inflight, batched...)
+	}
+}
+
+// number gives m the next sequence number, unless it has one or there is no
+// sequence. A reading that cannot be numbered is counted as failed.
+func (d *TelemetryDispatcher) number(m *domain.Telemetry) bool {
+	if d.sequence == nil || m.Seq != 0 {
+		return true
+	}
+
+	seq, err := d.sequence.Next()
+	if err != nil {
+		d.counters.Sensor(m.Sensor.String()).IncFailed()
+		d.logger.Error("cannot number reading", "sensor", m.Sensor, "error", err)
+		return false
+	}
+	m.Seq = seq
+	return true
+}
+
+// shardOf returns the worker, out of n, that delivers the readings of sensor.
+func shardOf(sensor domain.SensorName, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(sensor.String()))
+	return int(h.Sum32() % uint32(n))
+}
+
+// spillReadings hands msgs to the spill. It returns false without a spill
+// or if writing failed, leaving the readings to the caller.
+// Readings a full spill refuses are counted as evicted by the spill.
+func (d *TelemetryDispatcher) spillReadings(msgs []domain.Telemetry) bool {
+	if d.spill == nil {
+		return false
+	}
+
+	err := d.spill.Append(msgs)
+	switch {
+	case err == nil:
+		if d.spillFull.Swap(false) {
+			d.logger.Info("spill has room again")
+		}
+		return true
+	case errors.Is(err, ErrSpillFull):
+		if !d.spillFull.Swap(true) {
+			d.logger.Warn("spill full, dropping new readings until it has room")
+		}
+		return true
+	default:
+		d.logger.Error("cannot spill readings", "count", len(msgs), "error", err)
+		return false
+	}
+}
+
+// spilledChunk is a run of spilled readings handed to the sender, up to the batch with seq.
+type spilledChunk struct {
+	seq      uint64
+	outcomes chan spillOutcome // one per reading the sender took
+	taken    int
+	failed   []domain.Telemetry // readings the sender did not take
+}
+
+type spillOutcome struct {
+	msg domain.Telemetry
+	err error // nil once sent or rejected
+}
+
+// runSpill hands the spilled readings to the sender in order until ctx is done,
+// without waiting for their outcomes, so it keeps up with the sender.
+// commitSpill settles the chunks behind it.
+func (d *TelemetryDispatcher) runSpill(ctx context.Context) {
+	chunks := make(chan spilledChunk, spillChunks)
+	defer close(chunks)
+
+	d.committed = make(chan struct{})
+	go func() {
+		defer close(d.committed)
+		d.commitSpill(ctx, chunks)
+	}()
+
+	for {
+		msgs, seq, err := d.spill.Next(ctx, spillChunkSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.Error("cannot read spill, spilled readings stay undelivered", "error", err)
+			}
+			return
+		}
+
+		chunk := d.handSpilled(ctx, msgs, seq)
+		if len(chunk.failed) == 0 {
+			d.spill.Handed(seq)
+		}
+
+		select {
+		case chunks <- chunk:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// commitSpill waits for the outcomes of each chunk in turn, sends the readings that failed
+// again with backoff, however long it takes, and commits the chunk once all are sent or rejected.
+// Once ctx is done it only collects outcomes, which the sender reports by the time it is closed;
+// a chunk with readings that failed is then not committed and is sent again after a restart.
+func (d *TelemetryDispatcher) commitSpill(ctx context.Context, chunks <-chan spilledChunk) {
+	// failed retries in a row; readings that failed before the sender recovered are retried at once
+	attempt := 0
+	// the cursor only moves past settled chunks, so once one is left unsettled none is committed
+	stopped := false
+
+	for chunk := range chunks {
+		if stopped {
+			continue
+		}
+		failed := d.awaitSpilled(chunk)
+
+		for len(failed) > 0 && ctx.Err() == nil {
+			if attempt > 0 {
+				delay := d.backoff.Next(min(attempt, maxSpillAttempt))
+				d.logger.Warn("cannot deliver spilled readings, retrying",
+					"count", len(failed),
+					"attempt", attempt,
+					"delay", delay,
+				)
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					continue
+				case <-timer.C:
+				}
+			}
+
+			retry := d.handSpilled(ctx, failed, chunk.seq)
+			if len(retry.failed) == 0 {
+				d.spill.Handed(chunk.seq)
+			}
+			if failed = d.awaitSpilled(retry); len(failed) > 0 {
+				attempt++
+			} else {
+				attempt = 0
+			}
+		}
+
+		if len(failed) > 0 {
+			stopped = true
+			continue
+		}
+
+		if err := d.spill.Commit(chunk.seq); err != nil {
+			d.logger.Error("cannot commit spill, delivered readings may be sent again", "error", err)
+		}
+	}
+}
+
+// handSpilled hands msgs to the senders of their workers. Sent and rejected readings are counted as their
+// outcomes arrive, so readings delivered after ctx is done count too.
+func (d *TelemetryDispatcher) handSpilled(ctx context.Context, msgs []domain.Telemetry, seq uint64) spilledChunk {
+	chunk := spilledChunk{
+		seq:      seq,
+		outcomes: make(chan spillOutcome, len(msgs)),
+	}
+
+	settle := func(msg domain.Telemetry, err error) {
+		switch {
+		case err == nil:
+			d.counters.Sensor(msg.Sensor.String()).IncSent()
+		case errors.Is(err, ErrRejected):
+			d.counters.Sensor(msg.Sensor.String()).IncFailed()
+			d.logger.Error("failed to send metric", "sensor", msg.Sensor, "error", err)
+			err = nil
+		}
+		chunk.outcomes <- spillOutcome{msg: msg, err: err}
+	}
+
+	for i, msg := range msgs {
+		sender := d.senders[shardOf(msg.Sensor, len(d.senders))]
+		var err error
+		if bs, ok := sender.(BatchSender); ok {
+			err = bs.Enqueue(ctx, msg, func(err error) { settle(msg, err) })
+		} else if err = ctx.Err(); err == nil {
+			settle(msg, sender.Send(ctx, msg))
+		}
+		if err != nil {
+			chunk.failed = msgs[i:]
+			break
+		}
+		chunk.taken++
+	}
+	return chunk
+}
+
+// awaitSpilled waits for the outcomes of a chunk and returns the readings worth sending again.
+func (d *TelemetryDispatcher) awaitSpilled(chunk spilledChunk) []domain.Telemetry {
+	failed := chunk.failed
+	for range chunk.taken {
+		if o := <-chunk.outcomes; o.err != nil {
+			failed = append(failed, o.msg)
+		}
+	}
+	return failed
+}
+
 // close releases sender resources and logs final metrics.
 func (d *TelemetryDispatcher) close() {
 	d.logger.Info("dispatcher stopping")
 
-	if err := d.sender.Close(); err != nil {
-		d.logger.Warn("sender close failed", "err", err)
+	// readings the senders still held fail on close and are spilled, so the spill closes last
+	var closing sync.WaitGroup
+	for _, sender := range d.senders {
+		closing.Add(1)
+		go func() {
+			defer closing.Done()
+			if err := sender.Close(); err != nil {
+				d.logger.Warn("sender close failed", "err", err)
+			}
+		}()
+	}
+	closing.Wait()
+
+	if d.spill == nil {
+		d.logger.Info("final dispatcher metrics",
+			"total_sent", d.counters.GetSent(),
+			"total_failed", d.counters.GetFailed(),
+		)
+		return
+	}
+
+	if d.committed != nil {
+		<-d.committed
+	}
+	if err := d.spill.Close(); err != nil {
+		d.logger.Warn("spill close failed", "err", err)
 	}
 
 	d.logger.Info("final dispatcher metrics",
 		"total_sent", d.counters.GetSent(),
 		"total_failed", d.counters.GetFailed(),
+		"spill_pending", d.spill.Len(),
+		"spill_evicted", d.spill.Evicted(),
 	)
 }
@@ -0,0 +1,266 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/common"
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// flakySender delivers every reading but fails the first attempt of failOnce.
+type flakySender struct {
+	failOnce domain.Telemetry
+
+	mu        sync.Mutex
+	failed    bool
+	delivered map[string][]float64 // values by sensor, in delivery order
+}
+
+func (s *flakySender) Send(_ context.Context, t domain.Telemetry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.failed && t == s.failOnce {
+		s.failed = true
+		return errors.New("connection reset")
+	}
+	sensor := t.Sensor.String()
+	s.delivered[sensor] = append(s.delivered[sensor], t.Value.Float64())
+	return nil
+}
+
+func (s *flakySender) Close() error { return nil }
+
+func TestWorkersKeepSensorOrderAcrossRetries(t *testing.T) {
+	const sensors, readings = 8, 50
+
+	queue := make(chan domain.Telemetry, sensors*readings)
+	for i := range readings {
+		for k := range sensors {
+			m, err := domain.NewTelemetry(fmt.Sprintf("sensor-%d", k), float64(i), time.Unix(int64(i), 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			queue <- m
+		}
+	}
+	close(queue)
+
+	sender := &flakySender{delivered: make(map[string][]float64)}
+	failOnce, err := domain.NewTelemetry("sensor-3", 10, time.Unix(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.failOnce = failOnce
+
+	counters := NewCounters()
+	d := NewTelemetryDispatcher(queue, []TelemetrySender{sender, sender, sender, sender}, DispatcherConfig{
+		MaxRetries: 3,
+		// long enough for newer readings to overtake the failed one if they could
+		Backoff: common.NewBackoff(20*time.Millisecond, 20*time.Millisecond),
+	}, nil, counters, func() {})
+
+	d.Run(context.Background())
+
+	if !sender.failed {
+		t.Fatal("the reading meant to fail was never sent")
+	}
+	for k := range sensors {
+		sensor := fmt.Sprintf("sensor-%d", k)
+		got := sender.delivered[sensor]
+		if len(got) != readings {
+			t.Fatalf("%s: delivered %d readings, want %d", sensor, len(got), readings)
+		}
+		for i, v := range got {
+			if v != float64(i) {
+				t.Fatalf("%s: delivered %v, out of order", sensor, got)
+			}
+		}
+	}
+	if got := counters.GetSent(); got != sensors*readings {
+		t.Fatalf("sent %d readings, want %d", got, sensors*readings)
+	}
+}
+
+// batchSender delivers every reading it is given at once, or, while stuck is open,
+// holds them as a sender retrying in place would.
+type batchSender struct {
+	stuck     <-chan struct{}
+	delivered chan domain.Telemetry
+}
+
+func (s *batchSender) Send(context.Context, domain.Telemetry) error { return nil }
+
+func (s *batchSender) Enqueue(ctx context.Context, t domain.Telemetry, done func(error)) error {
+	select {
+	case <-s.stuck:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.delivered <- t
+	done(nil)
+	return nil
+}
+
+func (s *batchSender) Flush(context.Context) error { return nil }
+
+func (s *batchSender) Close() error { return nil }
+
+func TestFailingBatchSenderHoldsUpOnlyItsWorker(t *testing.T) {
+	const readings = 20
+
+	// a sensor of each of the two workers
+	var stuckSensor, okSensor string
+	for k := 0; stuckSensor == "" || okSensor == ""; k++ {
+		name := fmt.Sprintf("sensor-%d", k)
+		m, err := domain.NewTelemetry(name, 0, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shardOf(m.Sensor, 2) == 0 {
+			stuckSensor = name
+		} else {
+			okSensor = name
+		}
+	}
+
+	queue := make(chan domain.Telemetry, 2*readings)
+	for i := range readings {
+		for _, sensor := range []string{stuckSensor, okSensor} {
+			m, err := domain.NewTelemetry(sensor, float64(i), time.Unix(int64(i), 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			queue <- m
+		}
+	}
+	close(queue)
+
+	release := make(chan struct{})
+	delivered := make(chan domain.Telemetry, 2*readings)
+	released := make(chan struct{})
+	close(released)
+	counters := NewCounters()
+	d := NewTelemetryDispatcher(queue, []TelemetrySender{
+		&batchSender{stuck: release, delivered: delivered},
+		&batchSender{stuck: released, delivered: delivered},
+	}, DispatcherConfig{
+		MaxRetries: 1,
+		Backoff:    common.NewBackoff(time.Millisecond, time.Millisecond),
+	}, nil, counters, func() {})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		d.Run(context.Background())
+	}()
+
+	// the readings of the other worker are delivered while the first one's sender is stuck
+	for i := range readings {
+		select {
+		case m := <-delivered:
+			if m.Sensor.String() != okSensor || m.Value.Float64() != float64(i) {
+				t.Fatalf("delivered %s %v, want %s %d", m.Sensor, m.Value.Float64(), okSensor, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivered %d readings of %s while the other worker was stuck, want %d", i, okSensor, readings)
+		}
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the dispatcher did not stop once its input was delivered")
+	}
+	if got := counters.GetSent(); got != 2*readings {
+		t.Fatalf("sent %d readings, want %d", got, 2*readings)
+	}
+}
+
+// seqSender records the sequence number of every reading it is given and fails them with err.
+type seqSender struct {
+	err  error
+	sent chan uint64
+}
+
+func (s *seqSender) Send(_ context.Context, t domain.Telemetry) error {
+	select {
+	case s.sent <- t.Seq:
+	default:
+	}
+	return s.err
+}
+
+func (s *seqSender) Close() error { return nil }
+
+func TestSpilledReadingKeepsItsSeq(t *testing.T) {
+	dir := t.TempDir()
+	seq, err := OpenSequence(filepath.Join(dir, "node.json"), "node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// run dispatches through sender until it was given n readings and returns their seqs
+	run := func(queue chan domain.Telemetry, sender *seqSender, n int) []uint64 {
+		t.Helper()
+
+		spill, err := OpenSpill(SpillConfig{Dir: filepath.Join(dir, "spill"), MaxBytes: 1 << 30, Evict: EvictOldest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewTelemetryDispatcher(queue, []TelemetrySender{sender}, DispatcherConfig{
+			MaxRetries: 1,
+			Backoff:    common.NewBackoff(time.Millisecond, time.Millisecond),
+			Sequence:   seq,
+			Spill:      spill,
+		}, nil, nil, func() {})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			d.Run(ctx)
+		}()
+		defer func() {
+			cancel()
+			<-stopped
+		}()
+
+		var seqs []uint64
+		for len(seqs) < n {
+			select {
+			case got := <-sender.sent:
+				seqs = append(seqs, got)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("the sender got %d readings, want %d", len(seqs), n)
+			}
+		}
+		return seqs
+	}
+
+	queue := make(chan domain.Telemetry, 1)
+	m, err := domain.NewTelemetry("temp", 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue <- m
+
+	// the sink is down, so the reading is spilled and handed back from the spill
+	first := run(queue, &seqSender{err: errors.New("sink down"), sent: make(chan uint64, 2)}, 2)
+	if first[0] == 0 || first[1] != first[0] {
+		t.Fatalf("reading sent with seqs %v, want one number for every attempt", first)
+	}
+
+	// after a restart the spilled reading is delivered under the same number
+	second := run(make(chan domain.Telemetry), &seqSender{sent: make(chan uint64, 1)}, 1)
+	if second[0] != first[0] {
+		t.Fatalf("reading delivered after a restart with seq %d, want %d", second[0], first[0])
+	}
+}
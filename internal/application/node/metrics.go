@@ -1,25 +1,173 @@
 package node
 
-import "sync/atomic"
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
 
-// Counters holds the telemetry node metrics
+	"github.com/kvoloboi/telemetry/internal/metrics"
+)
+
+// Counters holds the telemetry node metrics, in total and per sensor.
+// The embedded SensorCounters are the totals.
 type Counters struct {
+	SensorCounters
+
+	mu      sync.RWMutex
+	sensors map[string]*SensorCounters
+}
+
+// SensorCounters counts the readings of one sensor.
+// Increments also count towards the node totals.
+type SensorCounters struct {
 	produced atomic.Int64
 	dropped  atomic.Int64
 	sent     atomic.Int64
 	failed   atomic.Int64
+
+	blocked   atomic.Int64 // waited for queue space
+	evicted   atomic.Int64 // held back for queue space and dropped for a newer reading
+	coalesced atomic.Int64 // replaced by a newer reading while waiting for queue space
+
+	aggregated atomic.Int64 // folded into a window by the Aggregator
+	filtered   atomic.Int64 // held back by the deadband of the Aggregator
+
+	total *SensorCounters // nil for the totals themselves
 }
 
 func NewCounters() *Counters {
-	return &Counters{}
+	return &Counters{sensors: make(map[string]*SensorCounters)}
+}
+
+// Sensor returns the counters of a sensor, creating them on first use.
+func (c *Counters) Sensor(name string) *SensorCounters {
+	c.mu.RLock()
+	sc, ok := c.sensors[name]
+	c.mu.RUnlock()
+	if ok {
+		return sc
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if sc, ok := c.sensors[name]; ok {
+		return sc
+	}
+	sc = &SensorCounters{total: &c.SensorCounters}
+	c.sensors[name] = sc
+	return sc
+}
+
+// Sensors returns the names of every sensor with counters, sorted.
+func (c *Counters) Sensors() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.sensors))
+	for name := range c.sensors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (c *SensorCounters) IncProduced() {
+	c.produced.Add(1)
+	if c.total != nil {
+		c.total.produced.Add(1)
+	}
+}
+
+func (c *SensorCounters) IncDropped() {
+	c.dropped.Add(1)
+	if c.total != nil {
+		c.total.dropped.Add(1)
+	}
 }
 
-func (c *Counters) IncProduced() { c.produced.Add(1) }
-func (c *Counters) IncDropped()  { c.dropped.Add(1) }
-func (c *Counters) IncSent()     { c.sent.Add(1) }
-func (c *Counters) IncFailed()   { c.failed.Add(1) }
+func (c *SensorCounters) IncSent() {
+	c.sent.Add(1)
+	if c.total != nil {
+		c.total.sent.Add(1)
+	}
+}
 
-func (c *Counters) GetProduced() int64 { return c.produced.Load() }
-func (c *Counters) GetDropped() int64  { return c.dropped.Load() }
-func (c *Counters) GetSent() int64     { return c.sent.Load() }
-func (c *Counters) GetFailed() int64   { return c.failed.Load() }
+func (c *SensorCounters) IncFailed() {
+	c.failed.Add(1)
+	if c.total != nil {
+		c.total.failed.Add(1)
+	}
+}
+
+func (c *SensorCounters) IncBlocked() {
+	c.blocked.Add(1)
+	if c.total != nil {
+		c.total.blocked.Add(1)
+	}
+}
+
+func (c *SensorCounters) IncEvicted() {
+	c.evicted.Add(1)
+	if c.total != nil {
+		c.total.evicted.Add(1)
+	}
+}
+
+func (c *SensorCounters) IncCoalesced() {
+	c.coalesced.Add(1)
+	if c.total != nil {
+		c.total.coalesced.Add(1)
+	}
+}
+
+func (c *SensorCounters) IncAggregated() {
+	c.aggregated.Add(1)
+	if c.total != nil {
+		c.total.aggregated.Add(1)
+	}
+}
+
+func (c *SensorCounters) IncFiltered() {
+	c.filtered.Add(1)
+	if c.total != nil {
+		c.total.filtered.Add(1)
+	}
+}
+
+func (c *SensorCounters) GetProduced() int64   { return c.produced.Load() }
+func (c *SensorCounters) GetDropped() int64    { return c.dropped.Load() }
+func (c *SensorCounters) GetSent() int64       { return c.sent.Load() }
+func (c *SensorCounters) GetFailed() int64     { return c.failed.Load() }
+func (c *SensorCounters) GetBlocked() int64    { return c.blocked.Load() }
+func (c *SensorCounters) GetEvicted() int64    { return c.evicted.Load() }
+func (c *SensorCounters) GetCoalesced() int64  { return c.coalesced.Load() }
+func (c *SensorCounters) GetAggregated() int64 { return c.aggregated.Load() }
+func (c *SensorCounters) GetFiltered() int64   { return c.filtered.Load() }
+
+// RegisterMetrics exposes the counters per sensor. Sensors first seen after
+// the call are left out, so create the counters of every sensor before.
+func (c *Counters) RegisterMetrics(reg *metrics.Registry) {
+	for _, name := range c.Sensors() {
+		sc := c.Sensor(name)
+
+		reg.Register("telemetry_node_produced_total", "Readings produced and queued for sending.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetProduced()) }), "sensor", name)
+		reg.Register("telemetry_node_dropped_total", "Readings dropped because the queue was full.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetDropped()) }), "sensor", name)
+		reg.Register("telemetry_node_sent_total", "Readings delivered to the sink.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetSent()) }), "sensor", name)
+		reg.Register("telemetry_node_failed_total", "Readings given up on.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetFailed()) }), "sensor", name)
+		reg.Register("telemetry_node_queue_blocked_total", "Readings that waited for queue space.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetBlocked()) }), "sensor", name)
+		reg.Register("telemetry_node_queue_evicted_total", "Readings held back for queue space and dropped for a newer one.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetEvicted()) }), "sensor", name)
+		reg.Register("telemetry_node_coalesced_total", "Readings replaced by a newer one while waiting for queue space.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetCoalesced()) }), "sensor", name)
+		reg.Register("telemetry_node_aggregated_total", "Readings folded into a window by the aggregator.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetAggregated()) }), "sensor", name)
+		reg.Register("telemetry_node_filtered_total", "Readings held back by the deadband of the aggregator.",
+			metrics.CounterFunc(func() float64 { return float64(sc.GetFiltered()) }), "sensor", name)
+	}
+}
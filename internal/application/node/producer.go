@@ -3,26 +3,52 @@ package node
 import (
 	"context"
 	"log/slog"
-	rand "math/rand/v2"
 	"time"
 
+	"github.com/kvoloboi/telemetry/internal/application/node/source"
 	"github.com/kvoloboi/telemetry/internal/domain"
 )
 
+// OverflowPolicy selects what a producer does with a reading when the queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDrop drops the new reading at once.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowBlock waits up to a timeout for queue space, then drops the new reading.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropOldest holds new readings back until the queue has room,
+	// dropping the oldest reading of the sensor once it holds as many as the queue.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowCoalesce holds the new reading back until the queue has room,
+	// replacing it with every newer one of the sensor in the meantime.
+	OverflowCoalesce OverflowPolicy = "coalesce"
+)
+
+// ProducerConfig describes the readings of one sensor.
+type ProducerConfig struct {
+	Sensor       string
+	Rate         int                // readings per second
+	Source       source.ValueSource // nil = uniform values in [0, 1)
+	Overflow     OverflowPolicy     // "" = OverflowDrop
+	BlockTimeout time.Duration      // max wait for queue space with OverflowBlock
+}
+
 // This struct is responsible for telemetry data creation and sending it to a queue at a defined rate.
 type TelemetryProducer struct {
 	sensor          string
 	rate_per_second int
-	out             chan<- domain.Telemetry
-	rand            *rand.Rand
+	source          source.ValueSource
+	overflow        OverflowPolicy
+	blockTimeout    time.Duration
+	queue           chan domain.Telemetry
 	logger          *slog.Logger
-	counters        *Counters
+	counters        *SensorCounters
 }
 
 func NewProducer(
-	sensor string,
-	rate_per_second int,
-	out chan<- domain.Telemetry,
+	cfg ProducerConfig,
+	queue chan domain.Telemetry,
 	logger *slog.Logger,
 	counters *Counters,
 ) *TelemetryProducer {
@@ -33,15 +59,25 @@ func NewProducer(
 		counters = NewCounters()
 	}
 
-	seed := uint64(time.Now().UnixNano())
+	src := cfg.Source
+	if src == nil {
+		src = source.NewUniform(0, 1)
+	}
+
+	overflow := cfg.Overflow
+	if overflow == "" {
+		overflow = OverflowDrop
+	}
 
 	return &TelemetryProducer{
-		sensor:          sensor,
-		out:             out,
-		rand:            rand.New(rand.NewPCG(seed, seed>>1)),
-		rate_per_second: rate_per_second,
+		sensor:          cfg.Sensor,
+		queue:           queue,
+		source:          src,
+		rate_per_second: cfg.Rate,
+		overflow:        overflow,
+		blockTimeout:    cfg.BlockTimeout,
 		logger:          logger,
-		counters:        counters,
+		counters:        counters.Sensor(cfg.Sensor),
 	}
 }
 
@@ -51,6 +87,18 @@ func (p *TelemetryProducer) Run(ctx context.Context) {
 		return
 	}
 
+	switch p.overflow {
+	case OverflowDrop, OverflowDropOldest, OverflowCoalesce:
+	case OverflowBlock:
+		if p.blockTimeout <= 0 {
+			p.logger.Error("invalid block timeout", "sensor", p.sensor, "value", p.blockTimeout)
+			return
+		}
+	default:
+		p.logger.Error("unsupported overflow policy", "sensor", p.sensor, "value", p.overflow)
+		return
+	}
+
 	interval := time.Second / time.Duration(p.rate_per_second)
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -59,30 +107,125 @@ func (p *TelemetryProducer) Run(ctx context.Context) {
 		"sensor", p.sensor,
 		"rate_per_second", p.rate_per_second,
 		"interval", interval,
+		"overflow", p.overflow,
 	)
 
+	var sourceErr error // last read failure, to log only when the outcome changes
+
+	// with OverflowDropOldest and OverflowCoalesce, the readings of the sensor
+	// waiting for queue space, oldest first
+	var held []domain.Telemetry
+
 	for {
+		// the oldest held reading goes in as soon as the queue has room
+		var out chan<- domain.Telemetry
+		var next domain.Telemetry
+		if len(held) > 0 {
+			out, next = p.queue, held[0]
+		}
+
 		select {
 		case <-ctx.Done():
+			for _, metric := range held {
+				select {
+				case p.queue <- metric:
+					p.counters.IncProduced()
+				default:
+					p.counters.IncDropped()
+				}
+			}
+
 			p.logger.Info(
 				"producer stopped",
+				"sensor", p.sensor,
 				"total_produced", p.counters.GetProduced(),
 				"total_dropped", p.counters.GetDropped(),
+				"total_blocked", p.counters.GetBlocked(),
+				"total_evicted", p.counters.GetEvicted(),
+				"total_coalesced", p.counters.GetCoalesced(),
 			)
 			return
+		case out <- next:
+			p.counters.IncProduced()
+			held[0] = domain.Telemetry{}
+			held = held[1:]
 		case <-ticker.C:
-			metric, err := domain.NewTelemetry(p.sensor, p.rand.Float64(), time.Now())
+			now := time.Now()
+
+			value, err := p.source.Next(ctx)
+			if err != nil {
+				if sourceErr == nil || sourceErr.Error() != err.Error() {
+					p.logger.Warn("cannot read sensor value, skipping readings", "sensor", p.sensor, "err", err)
+				}
+				sourceErr = err
+				continue
+			}
+			if sourceErr != nil {
+				p.logger.Info("sensor value readable again", "sensor", p.sensor)
+				sourceErr = nil
+			}
+
+			metric, err := domain.NewTelemetry(p.sensor, value, now)
 			if err != nil {
 				p.logger.Error("producer generates malformed data, exitting...", "err", err)
 				return
 			}
 
+			// held readings are older, so the new one waits behind them rather than overtaking them
+			if len(held) > 0 {
+				held = p.hold(held, metric)
+				continue
+			}
+
 			select {
-			case p.out <- metric:
+			case p.queue <- metric:
 				p.counters.IncProduced()
+				continue
 			default:
+			}
+
+			switch p.overflow {
+			case OverflowDrop:
 				p.counters.IncDropped()
+			case OverflowBlock:
+				p.block(ctx, metric)
+			case OverflowDropOldest, OverflowCoalesce:
+				held = p.hold(held, metric)
 			}
 		}
 	}
 }
+
+// hold adds metric to the held readings. With OverflowCoalesce it replaces the
+// held reading; with OverflowDropOldest the oldest held reading is evicted once
+// the sensor holds as many readings as the queue does.
+func (p *TelemetryProducer) hold(held []domain.Telemetry, metric domain.Telemetry) []domain.Telemetry {
+	switch {
+	case p.overflow == OverflowCoalesce:
+		if len(held) > 0 {
+			p.counters.IncCoalesced()
+		}
+		return append(held[:0], metric)
+	case len(held) >= max(cap(p.queue), 1):
+		p.counters.IncEvicted()
+		held = held[1:]
+	}
+	return append(held, metric)
+}
+
+// block waits up to the block timeout for queue space and drops the reading after it.
+func (p *TelemetryProducer) block(ctx context.Context, metric domain.Telemetry) {
+	p.counters.IncBlocked()
+
+	timer := time.NewTimer(p.blockTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.queue <- metric:
+		p.counters.IncProduced()
+	case <-ctx.Done():
+		p.counters.IncDropped()
+	case <-timer.C:
+		p.counters.IncDropped()
+	}
+}
@@ -0,0 +1,176 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// countingSource returns 1, 2, ... up to last, calling beforeLast before it
+// returns last, and fails once it is exhausted.
+type countingSource struct {
+	n          float64
+	last       float64
+	beforeLast func()
+}
+
+func (s *countingSource) Next(context.Context) (float64, error) {
+	if s.n == s.last {
+		return 0, errors.New("exhausted")
+	}
+	s.n++
+	if s.n == s.last {
+		s.beforeLast()
+	}
+	return s.n, nil
+}
+
+func TestCoalesceDeliversOnlyNewestReading(t *testing.T) {
+	queue := make(chan domain.Telemetry, 1)
+	other, err := domain.NewTelemetry("other", 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue <- other
+
+	// the queue stays full for three ticks and gets room during the fourth
+	drained := make(chan struct{})
+	src := &countingSource{last: 4, beforeLast: func() {
+		<-queue
+		close(drained)
+	}}
+	counters := NewCounters()
+	p := NewProducer(ProducerConfig{
+		Sensor:   "temp",
+		Rate:     1000,
+		Source:   src,
+		Overflow: OverflowCoalesce,
+	}, queue, nil, counters)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		p.Run(ctx)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the producer did not tick four times")
+	}
+	select {
+	case got := <-queue:
+		if got.Value.Float64() != 4 {
+			t.Fatalf("first reading = %v, want the newest, 4", got.Value.Float64())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reading arrived")
+	}
+	select {
+	case got := <-queue:
+		t.Fatalf("reading %v arrived after the newest", got.Value.Float64())
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	<-stopped
+
+	sensor := counters.Sensor("temp")
+	if sensor.GetProduced() != 1 || sensor.GetCoalesced() != 3 {
+		t.Fatalf("produced %d and coalesced %d readings, want 1 and 3", sensor.GetProduced(), sensor.GetCoalesced())
+	}
+}
+
+// run runs p until stop is closed.
+func run(p *TelemetryProducer, stop <-chan struct{}) (stopped <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx)
+	}()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	return done
+}
+
+func TestDropOldestEvictsOnlyItsOwnReadings(t *testing.T) {
+	queue := make(chan domain.Telemetry, 2)
+	counters := NewCounters()
+
+	// a sensor dropping its own new readings fills the queue first
+	full := make(chan struct{})
+	other := NewProducer(ProducerConfig{
+		Sensor:   "other",
+		Rate:     1000,
+		Source:   &countingSource{last: 3, beforeLast: func() { close(full) }},
+		Overflow: OverflowDrop,
+	}, queue, nil, counters)
+	stopOther := make(chan struct{})
+	otherStopped := run(other, stopOther)
+	select {
+	case <-full:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queue did not fill up")
+	}
+	close(stopOther)
+	<-otherStopped
+
+	// five readings wait behind the full queue, which holds two; the sixth
+	// comes once the queue is drained
+	var queued []domain.Telemetry
+	drained := make(chan struct{})
+	src := &countingSource{last: 6, beforeLast: func() {
+		queued = append(queued, <-queue, <-queue)
+		close(drained)
+	}}
+	p := NewProducer(ProducerConfig{
+		Sensor:   "temp",
+		Rate:     1000,
+		Source:   src,
+		Overflow: OverflowDropOldest,
+	}, queue, nil, counters)
+	stop := make(chan struct{})
+	stopped := run(p, stop)
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the producer did not tick six times")
+	}
+	var got []float64
+	for len(got) < 2 {
+		select {
+		case m := <-queue:
+			got = append(got, m.Value.Float64())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got readings %v, want 5 and 6", got)
+		}
+	}
+	close(stop)
+	<-stopped
+
+	for i, m := range queued {
+		if m.Sensor.String() != "other" || m.Value.Float64() != float64(i+1) {
+			t.Fatalf("queued readings = %v, want other's 1 and 2 untouched", queued)
+		}
+	}
+	if got[0] != 5 || got[1] != 6 {
+		t.Fatalf("delivered %v, want the newest readings 5 and 6 in order", got)
+	}
+
+	o, s := counters.Sensor("other"), counters.Sensor("temp")
+	if o.GetProduced() != 2 || o.GetDropped() != 1 || o.GetEvicted() != 0 {
+		t.Fatalf("other: produced %d, dropped %d, evicted %d, want 2, 1 and 0",
+			o.GetProduced(), o.GetDropped(), o.GetEvicted())
+	}
+	if s.GetProduced() != 2 || s.GetEvicted() != 4 {
+		t.Fatalf("temp: produced %d and evicted %d, want 2 and 4", s.GetProduced(), s.GetEvicted())
+	}
+}
@@ -2,12 +2,30 @@ package node
 
 import (
 	"context"
+	"errors"
 	"io"
 
 	"github.com/kvoloboi/telemetry/internal/domain"
 )
 
+// ErrRejected marks readings the sink refused; sending them again cannot succeed.
+var ErrRejected = errors.New("telemetry rejected by sink")
+
 type TelemetrySender interface {
 	Send(ctx context.Context, t domain.Telemetry) error
 	io.Closer
 }
+
+// BatchSender buffers readings and delivers them in batches. It retries
+// readings that failed itself, ahead of the readings buffered after them,
+// so an error passed to done is final. Close sends whatever is still buffered.
+type BatchSender interface {
+	TelemetrySender
+
+	// Enqueue returns once t is buffered. done is called exactly once with
+	// the delivery outcome of t, from the sender's goroutine; it must not block.
+	Enqueue(ctx context.Context, t domain.Telemetry, done func(error)) error
+
+	// Flush sends everything buffered so far and waits for the outcomes.
+	Flush(ctx context.Context) error
+}
@@ -0,0 +1,142 @@
+package node
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// seqBlock is how many sequence numbers are reserved per state file write.
+const seqBlock = 1000
+
+type sequenceState struct {
+	ID  string `json:"id"`
+	Seq uint64 `json:"seq"` // numbers below it may have been handed out
+}
+
+// Sequence assigns the sequence numbers a node sends its readings under.
+// Numbers keep increasing across restarts: the state file records a ceiling
+// a block ahead of the numbers handed out, and a restart continues from it,
+// skipping whatever was left of the block.
+type Sequence struct {
+	path string
+	id   domain.NodeID
+
+	mu      sync.Mutex
+	next    uint64
+	ceiling uint64
+}
+
+// OpenSequence loads the state file at path, creating it if missing.
+// An empty id keeps the stored node id, or generates one on first use.
+func OpenSequence(path, id string) (*Sequence, error) {
+	var st sequenceState
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, fmt.Errorf("parse node state %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return nil, err
+	}
+
+	if id == "" {
+		id = st.ID
+	}
+	if id == "" {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		id = hex.EncodeToString(b[:])
+	}
+
+	nodeID, err := domain.NewNodeID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sequence{
+		path: path,
+		id:   nodeID,
+		next: max(st.Seq, 1),
+	}
+	s.ceiling = s.next
+
+	// persist the id right away, so it stays stable even if nothing is sent
+	if err := s.reserve(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ID returns the node id.
+func (s *Sequence) ID() domain.NodeID {
+	return s.id
+}
+
+// Next returns the next sequence number.
+func (s *Sequence) Next() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next >= s.ceiling {
+		if err := s.reserve(); err != nil {
+			return 0, err
+		}
+	}
+
+	seq := s.next
+	s.next++
+	return seq, nil
+}
+
+// reserve moves the ceiling a block ahead and writes it out. s.mu must be held.
+func (s *Sequence) reserve() error {
+	ceiling := s.next + seqBlock
+
+	data, err := json.Marshal(sequenceState{ID: s.id.String(), Seq: ceiling})
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return err
+	}
+
+	s.ceiling = ceiling
+	return nil
+}
+
+// writeFileAtomic replaces path with data, so a crash leaves either the old or the new content.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,71 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCommandTimeout bounds a Command run when no timeout is configured.
+const defaultCommandTimeout = 5 * time.Second
+
+// commandWaitDelay bounds the wait for a timed out command's output, which
+// children of the killed shell may still hold open.
+const commandWaitDelay = 100 * time.Millisecond
+
+// File reads a number from a file on every reading, such as
+// /sys/class/thermal/thermal_zone0/temp (millidegrees, so Scale 0.001).
+type File struct {
+	Path  string
+	Scale float64 // 0 = 1
+}
+
+func (f *File) Next(context.Context) (float64, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return 0, err
+	}
+	return parseValue(string(data), f.Scale)
+}
+
+// Command runs a shell command on every reading and parses its output as a number.
+type Command struct {
+	Command string
+	Scale   float64       // 0 = 1
+	Timeout time.Duration // 0 = defaultCommandTimeout
+}
+
+func (c *Command) Next(ctx context.Context) (float64, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.WaitDelay = commandWaitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("run %q: %w", c.Command, err)
+	}
+	return parseValue(string(out), c.Scale)
+}
+
+// parseValue parses the first line of s as a number and applies scale.
+func parseValue(s string, scale float64) (float64, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+	if err != nil {
+		return 0, err
+	}
+	if scale != 0 {
+		v *= scale
+	}
+	return v, nil
+}
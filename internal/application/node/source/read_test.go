@@ -0,0 +1,98 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseValue(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		scale float64
+		want  float64
+		ok    bool
+	}{
+		{in: "42000\n", scale: 0.001, want: 42, ok: true},
+		{in: "  3.5  ", want: 3.5, ok: true},
+		{in: "7\nignored\n", want: 7, ok: true},
+		{in: "\n\n-1e3\n", scale: 2, want: -2000, ok: true},
+		{in: ""},
+		{in: "warm"},
+		{in: "1 2"},
+	} {
+		got, err := parseValue(tc.in, tc.scale)
+		if (err == nil) != tc.ok {
+			t.Fatalf("parseValue(%q) err = %v", tc.in, err)
+		}
+		if tc.ok && got != tc.want {
+			t.Fatalf("parseValue(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := writeFile(t, "temp", "45000\n")
+	f := &File{Path: path, Scale: 0.001}
+
+	got, err := f.Next(context.Background())
+	if err != nil || got != 45 {
+		t.Fatalf("Next() = %v, %v, want 45", got, err)
+	}
+
+	// every reading reads the file again
+	if err := os.WriteFile(path, []byte("46000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := f.Next(context.Background()); err != nil || got != 46 {
+		t.Fatalf("Next() after a change = %v, %v, want 46", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("n/a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Next(context.Background()); err == nil {
+		t.Fatal("read a value from a file without a number")
+	}
+
+	missing := &File{Path: filepath.Join(t.TempDir(), "missing")}
+	if _, err := missing.Next(context.Background()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("err = %v, want a missing file", err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cmd     Command
+		want    float64
+		wantErr string
+	}{
+		{name: "output", cmd: Command{Command: "echo 21.5"}, want: 21.5},
+		{name: "scaled", cmd: Command{Command: "printf '1500\\nrest'", Scale: 0.01}, want: 15},
+		{name: "failing", cmd: Command{Command: "exit 3"}, wantErr: "exit status 3"},
+		{name: "not a number", cmd: Command{Command: "echo warm"}, wantErr: "invalid syntax"},
+		{name: "timeout", cmd: Command{Command: "sleep 5", Timeout: 50 * time.Millisecond}, wantErr: "signal: killed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Now()
+			got, err := tc.cmd.Next(context.Background())
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tc.wantErr)
+				}
+				if time.Since(start) > 2*time.Second {
+					t.Fatalf("took %s", time.Since(start))
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Fatalf("Next() = %v, %v, want %v", got, err, tc.want)
+			}
+		})
+	}
+}
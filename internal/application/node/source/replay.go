@@ -0,0 +1,67 @@
+package source
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSVReplay yields the values of a CSV column in file order, starting over at the end.
+type CSVReplay struct {
+	values []float64
+	next   int
+}
+
+// LoadCSV reads column of the CSV file at path. A first row whose
+// column is not a number is taken as the header and skipped.
+func LoadCSV(path string, column int) (*CSVReplay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var values []float64
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+		if column >= len(record) {
+			return nil, fmt.Errorf("%s row %d: no column %d", path, row, column)
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(record[column]), 64)
+		if err != nil {
+			if row == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s row %d: %w", path, row, err)
+		}
+		values = append(values, v)
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("no values in " + path)
+	}
+
+	return &CSVReplay{values: values}, nil
+}
+
+func (r *CSVReplay) Next(context.Context) (float64, error) {
+	v := r.values[r.next]
+	r.next = (r.next + 1) % len(r.values)
+	return v, nil
+}
@@ -0,0 +1,68 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCSV(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		column  int
+		want    []float64
+		wantErr string
+	}{
+		{name: "header skipped", data: "time,value\n1,20.5\n2, 21\n", column: 1, want: []float64{20.5, 21}},
+		{name: "no header", data: "1.5\n-2\n", column: 0, want: []float64{1.5, -2}},
+		{name: "ragged rows", data: "a,1,x\nb,2\n", column: 1, want: []float64{1, 2}},
+		{name: "missing column", data: "1,2\n3\n", column: 1, wantErr: "row 2: no column 1"},
+		{name: "not a number", data: "value\n1\nwarm\n", column: 0, wantErr: "row 3"},
+		{name: "header only", data: "value\n", column: 0, wantErr: "no values"},
+		{name: "empty", data: "", column: 0, wantErr: "no values"},
+		{name: "bad quoting", data: "1\n\"2\n", column: 0, wantErr: "read "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := LoadCSV(writeFile(t, "values.csv", tc.data), tc.column)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the values repeat from the start once exhausted
+			for i := range 2 * len(tc.want) {
+				got, err := r.Next(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := tc.want[i%len(tc.want)]; got != want {
+					t.Fatalf("value %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCSVMissingFile(t *testing.T) {
+	if _, err := LoadCSV(filepath.Join(t.TempDir(), "missing.csv"), 0); !os.IsNotExist(err) {
+		t.Fatalf("err = %v, want a missing file", err)
+	}
+}
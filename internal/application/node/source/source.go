@@ -0,0 +1,132 @@
+// Package source provides the value sources a node producer reads its values from.
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	rand "math/rand/v2"
+	"time"
+)
+
+// Kinds of value sources accepted by New.
+const (
+	KindConstant = "constant"
+	KindRandom   = "random"
+	KindSine     = "sine"
+	KindSquare   = "square"
+	KindSawtooth = "sawtooth"
+	KindWalk     = "walk"
+	KindCSV      = "csv"
+	KindFile     = "file"
+	KindCommand  = "command"
+)
+
+// Config selects and parameterizes a value source.
+// Each kind only reads the fields documented for it.
+type Config struct {
+	Kind string
+
+	Min float64 // random, waves, walk: value range
+	Max float64
+
+	Value  float64       // constant
+	Period time.Duration // waves, 0 = one minute
+	Noise  float64       // waves: standard deviation of added gaussian noise
+	Step   float64       // walk: largest change between two readings, 0 = 1% of the range
+
+	Path    string        // csv, file
+	Column  int           // csv: zero-based column holding the value
+	Command string        // command: run with sh -c
+	Scale   float64       // file, command: factor applied to the parsed value, 0 = 1
+	Timeout time.Duration // command, 0 = five seconds
+}
+
+// ValueSource yields the successive values of one sensor.
+// The producer calls Next from a single goroutine.
+type ValueSource interface {
+	Next(ctx context.Context) (float64, error)
+}
+
+// New creates the source described by cfg.
+func New(cfg Config) (ValueSource, error) {
+	switch cfg.Kind {
+	case KindConstant:
+		return Constant(cfg.Value), nil
+	case KindRandom, "":
+		if cfg.Min >= cfg.Max {
+			return nil, errors.New("min must be < max")
+		}
+		return NewUniform(cfg.Min, cfg.Max), nil
+	case KindSine, KindSquare, KindSawtooth:
+		if cfg.Min >= cfg.Max {
+			return nil, errors.New("min must be < max")
+		}
+		if cfg.Period < 0 {
+			return nil, errors.New("period must be >= 0")
+		}
+		if cfg.Noise < 0 {
+			return nil, errors.New("noise must be >= 0")
+		}
+		period := cfg.Period
+		if period == 0 {
+			period = time.Minute
+		}
+		return NewWave(cfg.Kind, cfg.Min, cfg.Max, period, cfg.Noise), nil
+	case KindWalk:
+		if cfg.Min >= cfg.Max {
+			return nil, errors.New("min must be < max")
+		}
+		if cfg.Step < 0 {
+			return nil, errors.New("step must be >= 0")
+		}
+		step := cfg.Step
+		if step == 0 {
+			step = (cfg.Max - cfg.Min) / 100
+		}
+		return NewRandomWalk(cfg.Min, cfg.Max, step), nil
+	case KindCSV:
+		if cfg.Column < 0 {
+			return nil, errors.New("column must be >= 0")
+		}
+		return LoadCSV(cfg.Path, cfg.Column)
+	case KindFile:
+		if cfg.Path == "" {
+			return nil, errors.New("path is required")
+		}
+		return &File{Path: cfg.Path, Scale: cfg.Scale}, nil
+	case KindCommand:
+		if cfg.Command == "" {
+			return nil, errors.New("command is required")
+		}
+		return &Command{Command: cfg.Command, Scale: cfg.Scale, Timeout: cfg.Timeout}, nil
+	default:
+		return nil, fmt.Errorf("unknown source: %q", cfg.Kind)
+	}
+}
+
+// Constant always yields the same value.
+type Constant float64
+
+func (c Constant) Next(context.Context) (float64, error) {
+	return float64(c), nil
+}
+
+// Uniform yields values drawn uniformly from [min, max).
+type Uniform struct {
+	min, max float64
+	rand     *rand.Rand
+}
+
+func NewUniform(min, max float64) *Uniform {
+	return &Uniform{min: min, max: max, rand: newRand()}
+}
+
+func (u *Uniform) Next(context.Context) (float64, error) {
+	return u.min + u.rand.Float64()*(u.max-u.min), nil
+}
+
+func newRand() *rand.Rand {
+	seed := uint64(time.Now().UnixNano())
+	return rand.New(rand.NewPCG(seed, seed>>1))
+}
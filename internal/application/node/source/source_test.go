@@ -0,0 +1,95 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewValidates(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+		ok   bool
+	}{
+		{name: "default random", cfg: Config{Max: 1}, ok: true},
+		{name: "constant", cfg: Config{Kind: KindConstant, Value: 3}, ok: true},
+		{name: "sine", cfg: Config{Kind: KindSine, Min: -1, Max: 1}, ok: true},
+		{name: "walk", cfg: Config{Kind: KindWalk, Min: 0, Max: 10}, ok: true},
+		{name: "file", cfg: Config{Kind: KindFile, Path: "/dev/null"}, ok: true},
+		{name: "command", cfg: Config{Kind: KindCommand, Command: "echo 1"}, ok: true},
+		{name: "empty range", cfg: Config{Kind: KindRandom, Min: 1, Max: 1}},
+		{name: "wave range", cfg: Config{Kind: KindSquare, Min: 2, Max: 1}},
+		{name: "negative period", cfg: Config{Kind: KindSawtooth, Max: 1, Period: -time.Second}},
+		{name: "negative noise", cfg: Config{Kind: KindSine, Max: 1, Noise: -1}},
+		{name: "walk range", cfg: Config{Kind: KindWalk, Min: 1}},
+		{name: "negative step", cfg: Config{Kind: KindWalk, Max: 1, Step: -1}},
+		{name: "negative column", cfg: Config{Kind: KindCSV, Path: "/dev/null", Column: -1}},
+		{name: "csv without values", cfg: Config{Kind: KindCSV, Path: "/dev/null"}},
+		{name: "file without path", cfg: Config{Kind: KindFile}},
+		{name: "command without command", cfg: Config{Kind: KindCommand}},
+		{name: "unknown kind", cfg: Config{Kind: "noise"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(tc.cfg); (err == nil) != tc.ok {
+				t.Fatalf("New() err = %v", err)
+			}
+		})
+	}
+}
+
+func TestGeneratorsStayInRange(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  ValueSource
+	}{
+		{name: "uniform", src: NewUniform(-5, 5)},
+		{name: "sine", src: NewWave(KindSine, -5, 5, time.Millisecond, 0)},
+		{name: "square", src: NewWave(KindSquare, -5, 5, time.Millisecond, 0)},
+		{name: "sawtooth", src: NewWave(KindSawtooth, -5, 5, time.Millisecond, 0)},
+		{name: "walk", src: NewRandomWalk(-5, 5, 1)},
+		// a step wider than the range still stays within it
+		{name: "wide walk", src: NewRandomWalk(-5, 5, 25)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for range 1000 {
+				v, err := tc.src.Next(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if v < -5 || v > 5 {
+					t.Fatalf("value %v outside [-5, 5]", v)
+				}
+			}
+		})
+	}
+}
+
+func TestRandomWalkStep(t *testing.T) {
+	w := NewRandomWalk(0, 100, 2)
+
+	prev := 50.0
+	for range 1000 {
+		v, err := w.Next(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := v - prev; d > 2 || d < -2 {
+			t.Fatalf("moved from %v to %v, more than the step", prev, v)
+		}
+		prev = v
+	}
+}
+
+func TestSquareWaveLevels(t *testing.T) {
+	w := NewWave(KindSquare, 1, 3, time.Hour, 0)
+
+	// the first half of the period is high
+	if v, err := w.Next(context.Background()); err != nil || v != 3 {
+		t.Fatalf("Next() = %v, %v, want 3", v, err)
+	}
+	w.start = time.Now().Add(-45 * time.Minute)
+	if v, err := w.Next(context.Background()); err != nil || v != 1 {
+		t.Fatalf("Next() in the second half = %v, %v, want 1", v, err)
+	}
+}
@@ -0,0 +1,40 @@
+package source
+
+import (
+	"context"
+	rand "math/rand/v2"
+)
+
+// RandomWalk starts halfway between min and max and moves by up to step
+// per reading, reflecting off the bounds.
+type RandomWalk struct {
+	min, max float64
+	step     float64
+	value    float64
+	rand     *rand.Rand
+}
+
+func NewRandomWalk(min, max, step float64) *RandomWalk {
+	return &RandomWalk{
+		min:   min,
+		max:   max,
+		step:  step,
+		value: min + (max-min)/2,
+		rand:  newRand(),
+	}
+}
+
+func (w *RandomWalk) Next(context.Context) (float64, error) {
+	v := w.value + (2*w.rand.Float64()-1)*w.step
+
+	if v > w.max {
+		v = 2*w.max - v
+	}
+	if v < w.min {
+		v = 2*w.min - v
+	}
+	// a step wider than the range can still overshoot after reflecting
+	w.value = min(max(v, w.min), w.max)
+
+	return w.value, nil
+}
@@ -0,0 +1,54 @@
+package source
+
+import (
+	"context"
+	"math"
+	rand "math/rand/v2"
+	"time"
+)
+
+// Wave yields a periodic signal between min and max, with optional gaussian noise.
+// The phase follows the wall clock, so the signal does not depend on the reading rate.
+type Wave struct {
+	shape    string
+	min, max float64
+	period   time.Duration
+	noise    float64
+	start    time.Time
+	rand     *rand.Rand
+}
+
+// NewWave creates a sine, square or sawtooth wave.
+func NewWave(shape string, min, max float64, period time.Duration, noise float64) *Wave {
+	return &Wave{
+		shape:  shape,
+		min:    min,
+		max:    max,
+		period: period,
+		noise:  noise,
+		start:  time.Now(),
+		rand:   newRand(),
+	}
+}
+
+func (w *Wave) Next(context.Context) (float64, error) {
+	phase := math.Mod(float64(time.Since(w.start))/float64(w.period), 1)
+
+	var level float64 // in [0, 1]
+	switch w.shape {
+	case KindSquare:
+		if phase < 0.5 {
+			level = 1
+		}
+	case KindSawtooth:
+		level = phase
+	default:
+		level = (1 + math.Sin(2*math.Pi*phase)) / 2
+	}
+
+	v := w.min + level*(w.max-w.min)
+	if w.noise > 0 {
+		v += w.rand.NormFloat64() * w.noise
+	}
+	return v, nil
+}
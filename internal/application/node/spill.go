@@ -0,0 +1,352 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/metrics"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// ErrSpillFull is returned by Spill.Append when the spill is full and keeps the oldest readings.
+var ErrSpillFull = errors.New("spill full")
+
+// SpillEvict selects which readings a full spill gives up.
+type SpillEvict string
+
+const (
+	// EvictOldest deletes the oldest undelivered readings to make room.
+	EvictOldest SpillEvict = "oldest"
+	// EvictNewest refuses new readings until delivery makes room.
+	EvictNewest SpillEvict = "newest"
+)
+
+// minSpillSegment keeps small spills from rotating a segment every few batches.
+const minSpillSegment = 64 << 10
+
+type SpillConfig struct {
+	Dir      string
+	MaxBytes int64 // bound on the segments on disk
+	Evict    SpillEvict
+}
+
+type spillCursor struct {
+	Next uint64 `json:"next"` // seq of the oldest batch not yet delivered
+}
+
+// Spill is a persistent FIFO of readings the sender could not take,
+// stored as a telemetrylog in its own directory next to a cursor file.
+// Batches are delivered in order; the cursor records how far delivery got,
+// so a restarted node resumes with what was still spilled.
+type Spill struct {
+	log        *telemetrylog.TelemetryLog
+	cfg        SpillConfig
+	cursorPath string
+	tail       *telemetrylog.TailReader     // used by Next only
+	held       *telemetrylog.TelemetryBatch // read by Next but left for the next call
+
+	mu       sync.Mutex
+	next     uint64
+	batches  []int // readings per undelivered batch, the first has seq next
+	readings int
+	handed   uint64 // seq of the first batch not yet handed to the sender
+	unhanded int    // readings of the batches from handed on
+	spilled  int64
+	evicted  int64
+}
+
+// OpenSpill opens or creates the spill in cfg.Dir and counts what is left to deliver.
+func OpenSpill(cfg SpillConfig) (*Spill, error) {
+	switch cfg.Evict {
+	case EvictOldest, EvictNewest:
+	default:
+		return nil, fmt.Errorf("unsupported spill eviction: %q", cfg.Evict)
+	}
+	if cfg.MaxBytes <= 0 {
+		return nil, errors.New("spill max bytes must be > 0")
+	}
+
+	log, err := telemetrylog.Open(cfg.Dir, &telemetrylog.Config{
+		SegmentMaxBytes: max(cfg.MaxBytes/8, minSpillSegment),
+		// new batches must be readable right away, and Close and rotation sync anyway
+		SyncMode: telemetrylog.SyncNone,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spill{
+		log:        log,
+		cfg:        cfg,
+		cursorPath: filepath.Join(cfg.Dir, "cursor.json"),
+	}
+
+	if err := s.load(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	s.handed, s.unhanded = s.next, s.readings
+	s.tail = telemetrylog.NewTailReader(log, s.next)
+
+	return s, nil
+}
+
+// load reads the cursor and counts the readings of every batch from it on.
+func (s *Spill) load() error {
+	var cur spillCursor
+
+	data, err := os.ReadFile(s.cursorPath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &cur); err != nil {
+			return fmt.Errorf("parse spill cursor %s: %w", s.cursorPath, err)
+		}
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return err
+	}
+	s.next = cur.Next
+
+	r, err := telemetrylog.NewBatchReaderFromSeq(s.cfg.Dir, s.next)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		batch, err := r.ReadBatch()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// batches below the cursor's were evicted while the cursor was not yet saved
+		if len(s.batches) == 0 {
+			s.next = batch.Seq
+		}
+		s.batches = append(s.batches, len(batch.Events))
+		s.readings += len(batch.Events)
+	}
+}
+
+// Append spills events as one batch. A full spill evicts per its policy;
+// with EvictNewest the events are refused with ErrSpillFull.
+func (s *Spill) Append(events []domain.Telemetry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.Evict == EvictNewest {
+		usage, err := telemetrylog.Usage(s.cfg.Dir)
+		if err != nil {
+			return err
+		}
+		if usage >= s.cfg.MaxBytes {
+			s.evicted += int64(len(events))
+			return ErrSpillFull
+		}
+	}
+
+	if _, err := s.log.Append(events); err != nil {
+		return err
+	}
+	s.batches = append(s.batches, len(events))
+	s.readings += len(events)
+	s.unhanded += len(events)
+	s.spilled += int64(len(events))
+
+	if s.cfg.Evict == EvictOldest {
+		return s.prune(s.cfg.MaxBytes)
+	}
+	return nil
+}
+
+// Next blocks until spilled readings are waiting and returns those of the following
+// batches, stopping before max readings are exceeded but taking at least one batch.
+// seq is the last batch returned; the caller commits it once the readings are delivered.
+// Next is not safe for concurrent use.
+func (s *Spill) Next(ctx context.Context, max int) (events []domain.Telemetry, seq uint64, err error) {
+	batch, err := s.nextBatch(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	events, seq = batch.Events, batch.Seq
+
+	// a done context still returns batches that are already readable
+	done, cancel := context.WithCancel(ctx)
+	cancel()
+
+	for len(events) < max {
+		batch, err := s.nextBatch(done)
+		if err != nil {
+			break
+		}
+		if len(events)+len(batch.Events) > max {
+			s.held = &batch
+			break
+		}
+		events = append(events, batch.Events...)
+		seq = batch.Seq
+	}
+	return events, seq, nil
+}
+
+// nextBatch returns the batch after the previous one, skipping evicted ones.
+func (s *Spill) nextBatch(ctx context.Context) (telemetrylog.TelemetryBatch, error) {
+	if s.held != nil {
+		batch := *s.held
+		s.held = nil
+		return batch, nil
+	}
+
+	for {
+		batch, err := s.tail.Next(ctx)
+		if err != nil {
+			return batch, err
+		}
+
+		s.mu.Lock()
+		next := s.next
+		s.mu.Unlock()
+
+		// evicted while waiting; the reader catches up on its own
+		if batch.Seq < next {
+			continue
+		}
+		return batch, nil
+	}
+}
+
+// Commit marks every batch up to seq delivered and moves the cursor past them.
+// Batches evicted in the meantime are skipped.
+func (s *Spill) Commit(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq < s.next {
+		return nil
+	}
+	for s.next <= seq && len(s.batches) > 0 {
+		s.readings -= s.batches[0]
+		s.batches = s.batches[1:]
+		s.next++
+	}
+
+	if err := s.saveCursor(); err != nil {
+		return err
+	}
+	return s.prune(0)
+}
+
+// prune deletes delivered segments and, with maxBytes > 0, the oldest
+// undelivered ones until the spill fits. s.mu must be held.
+func (s *Spill) prune(maxBytes int64) error {
+	report, err := telemetrylog.Prune(s.cfg.Dir, telemetrylog.RetentionPolicy{
+		MaxBytes: maxBytes,
+		MinSeq:   s.next,
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	moved := false
+	for _, seg := range report.Segments {
+		for s.next < seg.NextSeq && len(s.batches) > 0 {
+			if s.next >= s.handed {
+				s.unhanded -= s.batches[0]
+			}
+			s.readings -= s.batches[0]
+			s.evicted += int64(s.batches[0])
+			s.batches = s.batches[1:]
+			s.next++
+			moved = true
+		}
+	}
+
+	if moved {
+		s.handed = max(s.handed, s.next)
+		return s.saveCursor()
+	}
+	return nil
+}
+
+// saveCursor persists s.next. s.mu must be held.
+func (s *Spill) saveCursor() error {
+	data, err := json.Marshal(spillCursor{Next: s.next})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.cursorPath, data)
+}
+
+// Len returns the number of readings waiting for delivery.
+func (s *Spill) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.readings
+}
+
+// Handed records that the sender took every batch up to seq, which may still fail
+// and be sent again, but no longer needs new readings to queue behind it.
+func (s *Spill) Handed(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ; s.handed <= seq && s.handed-s.next < uint64(len(s.batches)); s.handed++ {
+		s.unhanded -= s.batches[s.handed-s.next]
+	}
+}
+
+// Unhanded returns the number of spilled readings not yet handed to the sender.
+// Readings sent while it is zero cannot overtake spilled ones.
+func (s *Spill) Unhanded() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.unhanded
+}
+
+// Evicted returns the number of readings given up on because the spill was full.
+func (s *Spill) Evicted() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.evicted
+}
+
+// Close syncs the spill. What was not delivered stays on disk for the next OpenSpill.
+func (s *Spill) Close() error {
+	err := s.log.Close()
+	if cerr := s.tail.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *Spill) RegisterMetrics(reg *metrics.Registry) {
+	reg.Register("telemetry_node_spill_pending", "Spilled readings waiting for delivery.",
+		metrics.GaugeFunc(func() float64 { return float64(s.Len()) }))
+	reg.Register("telemetry_node_spill_bytes", "Size of the spill segments on disk.",
+		metrics.GaugeFunc(func() float64 {
+			usage, _ := telemetrylog.Usage(s.cfg.Dir)
+			return float64(usage)
+		}))
+	reg.Register("telemetry_node_spilled_total", "Readings written to the spill.",
+		metrics.CounterFunc(func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return float64(s.spilled)
+		}))
+	reg.Register("telemetry_node_spill_evicted_total", "Readings given up on because the spill was full.",
+		metrics.CounterFunc(func() float64 { return float64(s.Evicted()) }))
+}
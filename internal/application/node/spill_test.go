@@ -0,0 +1,238 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// spillBatchSize readings make a batch of about 10 KiB, so six fill a segment
+// of a small spill, which holds two segments.
+const (
+	spillBatchSize = 500
+	smallSpill     = 2 * minSpillSegment
+)
+
+// spillBatch returns readings numbered from first on.
+func spillBatch(t *testing.T, first int) []domain.Telemetry {
+	t.Helper()
+
+	events := make([]domain.Telemetry, spillBatchSize)
+	for i := range events {
+		e, err := domain.NewTelemetry("temp", float64(first+i), time.Unix(int64(first+i), 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[i] = e
+	}
+	return events
+}
+
+func openSpill(t *testing.T, dir string, maxBytes int64, evict SpillEvict) *Spill {
+	t.Helper()
+
+	s, err := OpenSpill(SpillConfig{Dir: dir, MaxBytes: maxBytes, Evict: evict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// next returns the spilled readings of the next batch.
+func next(t *testing.T, s *Spill) ([]domain.Telemetry, uint64) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, seq, err := s.Next(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events, seq
+}
+
+func TestSpillResumesFromCursor(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openSpill(t, dir, 1<<30, EvictOldest)
+	for i := range 3 {
+		if err := s.Append(spillBatch(t, i*spillBatchSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, seq := next(t, s); seq != 0 {
+		t.Fatalf("first batch = %d, want 0", seq)
+	}
+	if err := s.Commit(0); err != nil {
+		t.Fatal(err)
+	}
+	// handed to the sender but not delivered, so it is spilled again after a restart
+	next(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "cursor.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cur spillCursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		t.Fatal(err)
+	}
+	if cur.Next != 1 {
+		t.Fatalf("cursor at %d, want 1", cur.Next)
+	}
+
+	s = openSpill(t, dir, 1<<30, EvictOldest)
+	defer s.Close()
+
+	if got, want := s.Len(), 2*spillBatchSize; got != want {
+		t.Fatalf("%d readings left after a restart, want %d", got, want)
+	}
+	if got := s.Unhanded(); got != s.Len() {
+		t.Fatalf("%d readings unhanded after a restart, want %d", got, s.Len())
+	}
+	events, seq := next(t, s)
+	if seq != 1 || events[0].Value.Float64() != spillBatchSize {
+		t.Fatalf("resumed with batch %d starting at %v, want batch 1 at %d", seq, events[0].Value.Float64(), spillBatchSize)
+	}
+}
+
+func TestSpillEvictsOldest(t *testing.T) {
+	s := openSpill(t, t.TempDir(), smallSpill, EvictOldest)
+	defer s.Close()
+
+	const batches = 20
+	for i := range batches {
+		if err := s.Append(spillBatch(t, i*spillBatchSize)); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+
+	evicted := s.Evicted()
+	if evicted == 0 {
+		t.Fatal("nothing evicted from a full spill")
+	}
+	if got := int64(s.Len()) + evicted; got != batches*spillBatchSize {
+		t.Fatalf("%d pending + %d evicted readings, want %d", s.Len(), evicted, batches*spillBatchSize)
+	}
+
+	// delivery resumes with the oldest batch left
+	events, seq := next(t, s)
+	if want := uint64(evicted / spillBatchSize); seq != want {
+		t.Fatalf("next batch = %d, want %d", seq, want)
+	}
+	if got, want := events[0].Value.Float64(), float64(evicted); got != want {
+		t.Fatalf("next reading = %v, want %v", got, want)
+	}
+}
+
+func TestSpillEvictsNewest(t *testing.T) {
+	s := openSpill(t, t.TempDir(), smallSpill, EvictNewest)
+	defer s.Close()
+
+	appended := 0
+	for {
+		err := s.Append(spillBatch(t, appended*spillBatchSize))
+		if errors.Is(err, ErrSpillFull) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		appended++
+		if appended > 100 {
+			t.Fatal("spill never filled up")
+		}
+	}
+
+	if got := s.Evicted(); got != spillBatchSize {
+		t.Fatalf("evicted %d readings, want the refused batch of %d", got, spillBatchSize)
+	}
+	if got := s.Len(); got != appended*spillBatchSize {
+		t.Fatalf("%d readings pending, want %d", got, appended*spillBatchSize)
+	}
+
+	// the oldest readings are kept
+	events, seq := next(t, s)
+	if seq != 0 || events[0].Value.Float64() != 0 {
+		t.Fatalf("next batch = %d starting at %v, want batch 0 at 0", seq, events[0].Value.Float64())
+	}
+
+	// delivering the readings of sealed segments makes room again
+	for {
+		if err := s.Commit(seq); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Append(spillBatch(t, -spillBatchSize)); err == nil {
+			break
+		} else if !errors.Is(err, ErrSpillFull) {
+			t.Fatal(err)
+		}
+		if s.Len() == 0 {
+			t.Fatal("spill still full once everything was delivered")
+		}
+		_, seq = next(t, s)
+	}
+}
+
+func TestSpillCommitAfterEviction(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpill(t, dir, smallSpill, EvictOldest)
+
+	if err := s.Append(spillBatch(t, 0)); err != nil {
+		t.Fatal(err)
+	}
+	_, handed := next(t, s)
+	s.Handed(handed)
+
+	// the handed batch is evicted while the sender still holds it
+	const batches = 20
+	for i := 1; i < batches; i++ {
+		if err := s.Append(spillBatch(t, i*spillBatchSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	evicted := s.Evicted()
+	if evicted == 0 {
+		t.Fatal("nothing evicted from a full spill")
+	}
+	pending := s.Len()
+
+	if err := s.Commit(handed); err != nil {
+		t.Fatalf("commit of an evicted batch: %v", err)
+	}
+	if got := s.Len(); got != pending {
+		t.Fatalf("%d readings pending after the commit, want %d", got, pending)
+	}
+	if got := s.Unhanded(); got != pending {
+		t.Fatalf("%d readings unhanded after the commit, want %d", got, pending)
+	}
+
+	// delivery goes on with the oldest batch left, also after a restart
+	_, seq := next(t, s)
+	if want := uint64(evicted / spillBatchSize); seq != want {
+		t.Fatalf("next batch = %d, want %d", seq, want)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openSpill(t, dir, smallSpill, EvictOldest)
+	defer s.Close()
+
+	if got := s.Len(); got != pending {
+		t.Fatalf("%d readings pending after a restart, want %d", got, pending)
+	}
+	if _, got := next(t, s); got != seq {
+		t.Fatalf("resumed with batch %d, want %d", got, seq)
+	}
+}
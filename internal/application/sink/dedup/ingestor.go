@@ -0,0 +1,180 @@
+package dedup
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/metrics"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// sensorState tracks the sequence numbers of one sensor of a node.
+type sensorState struct {
+	hwm   uint64 // highest seq appended to the log
+	batch uint64 // last log batch holding a seq of the sensor
+
+	// seqs handed on but not appended yet, with the duplicates waiting for them
+	pending map[uint64][]func(uint64, error)
+	// seqs below hwm that failed to reach the log and may be sent again
+	failed map[uint64]struct{}
+}
+
+// DedupIngestor drops sequenced telemetry a node already delivered.
+// Sequence numbers are tracked per sensor of a node: a node delivers the
+// readings of each sensor in sequence order, but not those of different
+// sensors, which it may send over several connections.
+// A duplicate is not passed on; its Appended callback reports the log batch
+// covering the original instead, so it is acked once the original is durable.
+// Telemetry without an Origin is passed on unchanged.
+type DedupIngestor struct {
+	next   sink.TelemetryIngestor
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	sensors map[telemetrylog.MarkKey]*sensorState
+
+	duplicates atomic.Int64
+}
+
+// NewDedupIngestor starts from the high-water marks recovered with TelemetryLog.Marks.
+func NewDedupIngestor(
+	next sink.TelemetryIngestor,
+	marks map[telemetrylog.MarkKey]telemetrylog.HighWaterMark,
+	logger *slog.Logger,
+) *DedupIngestor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	i := &DedupIngestor{
+		next:    next,
+		logger:  logger,
+		sensors: make(map[telemetrylog.MarkKey]*sensorState, len(marks)),
+	}
+
+	for key, m := range marks {
+		st := i.sensor(key)
+		st.hwm, st.batch = m.Seq, m.Batch
+	}
+
+	return i
+}
+
+// sensor returns the state of key. i.mu must be held.
+func (i *DedupIngestor) sensor(key telemetrylog.MarkKey) *sensorState {
+	st, ok := i.sensors[key]
+	if !ok {
+		st = &sensorState{
+			pending: make(map[uint64][]func(uint64, error)),
+			failed:  make(map[uint64]struct{}),
+		}
+		i.sensors[key] = st
+	}
+	return st
+}
+
+func (i *DedupIngestor) Ingest(ctx context.Context, item sink.TelemetryItem) error {
+	o := item.Origin
+	if o == nil {
+		return i.next.Ingest(ctx, item)
+	}
+
+	i.mu.Lock()
+	st := i.sensor(telemetrylog.MarkKey{Node: o.Node.String(), Sensor: item.Msg.Sensor.String()})
+
+	if waiting, ok := st.pending[o.Seq]; ok {
+		// the original is still on its way to the log
+		if item.Appended != nil {
+			st.pending[o.Seq] = append(waiting, item.Appended)
+		}
+		i.mu.Unlock()
+		i.duplicate(item)
+		return nil
+	}
+
+	if _, failed := st.failed[o.Seq]; o.Seq <= st.hwm && !failed {
+		batch := st.batch
+		i.mu.Unlock()
+
+		i.duplicate(item)
+		if item.Appended != nil {
+			item.Appended(batch, nil)
+		}
+		return nil
+	}
+
+	delete(st.failed, o.Seq)
+	st.pending[o.Seq] = nil
+	i.mu.Unlock()
+
+	appended := item.Appended
+	item.Appended = func(batch uint64, err error) {
+		for _, fn := range i.settle(st, o.Seq, batch, err) {
+			fn(batch, err)
+		}
+		if appended != nil {
+			appended(batch, err)
+		}
+	}
+
+	if err := i.next.Ingest(ctx, item); err != nil {
+		i.mu.Lock()
+		if _, ok := st.pending[o.Seq]; ok {
+			delete(st.pending, o.Seq)
+			if o.Seq <= st.hwm {
+				st.failed[o.Seq] = struct{}{}
+			}
+		}
+		i.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// settle records the outcome of seq and returns the duplicates waiting for it.
+func (i *DedupIngestor) settle(st *sensorState, seq, batch uint64, err error) []func(uint64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	waiting := st.pending[seq]
+	delete(st.pending, seq)
+
+	if err != nil {
+		if seq <= st.hwm {
+			st.failed[seq] = struct{}{}
+		}
+		return waiting
+	}
+
+	st.hwm = max(st.hwm, seq)
+	st.batch = max(st.batch, batch)
+	return waiting
+}
+
+func (i *DedupIngestor) duplicate(item sink.TelemetryItem) {
+	i.duplicates.Add(1)
+	i.logger.Debug("dropping duplicate telemetry",
+		"node", item.Origin.Node,
+		"seq", item.Origin.Seq,
+		"sensor", item.Msg.Sensor,
+	)
+}
+
+func (i *DedupIngestor) Close() error {
+	return i.next.Close()
+}
+
+// RegisterMetrics exposes the number of duplicates dropped.
+func (i *DedupIngestor) RegisterMetrics(reg *metrics.Registry) {
+	reg.Register("telemetry_sink_duplicates_total", "Sequenced telemetry dropped as already delivered.",
+		metrics.CounterFunc(func() float64 { return float64(i.duplicates.Load()) }))
+}
+
+// Duplicates returns the number of duplicates dropped since start.
+func (i *DedupIngestor) Duplicates() int64 {
+	return i.duplicates.Load()
+}
@@ -0,0 +1,141 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// countingIngestor counts the readings passed on to it and appends them to batch 1 at once.
+type countingIngestor struct {
+	ingested int
+}
+
+func (c *countingIngestor) Ingest(_ context.Context, item sink.TelemetryItem) error {
+	c.ingested++
+	if item.Appended != nil {
+		item.Appended(1, nil)
+	}
+	return nil
+}
+
+func (c *countingIngestor) Close() error { return nil }
+
+func appendMarked(t *testing.T, wal *telemetrylog.TelemetryLog, marks ...telemetrylog.Mark) {
+	t.Helper()
+
+	event, err := domain.NewTelemetry("temp", 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.AppendAnnotated([]domain.Telemetry{event}, telemetrylog.Annotations{Marks: marks}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarksSurviveRetention(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &telemetrylog.Config{SegmentMaxBytes: 1}
+
+	// every batch gets a segment of its own
+	wal, err := telemetrylog.Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendMarked(t, wal,
+		telemetrylog.Mark{Node: "node-a", Sensor: "temp", Seq: 10},
+		telemetrylog.Mark{Node: "node-b", Sensor: "temp", Seq: 5},
+	)
+	appendMarked(t, wal, telemetrylog.Mark{Node: "node-a", Sensor: "temp", Seq: 12})
+	appendMarked(t, wal)
+	appendMarked(t, wal)
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the segments holding every mark are gone
+	pruned, err := telemetrylog.Prune(dir, telemetrylog.RetentionPolicy{MinSeq: 3}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned.Segments) != 3 {
+		t.Fatalf("pruned %d segments, want 3", len(pruned.Segments))
+	}
+
+	wal, err = telemetrylog.Open(dir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	marks := wal.Marks()
+	if got := marks[telemetrylog.MarkKey{Node: "node-a", Sensor: "temp"}]; got.Seq != 12 || got.Batch != 1 {
+		t.Fatalf("node-a mark = %+v, want seq 12 in batch 1", got)
+	}
+	if got := marks[telemetrylog.MarkKey{Node: "node-b", Sensor: "temp"}]; got.Seq != 5 {
+		t.Fatalf("node-b mark = %+v, want seq 5", got)
+	}
+
+	next := &countingIngestor{}
+	d := NewDedupIngestor(next, marks, nil)
+	node, err := domain.NewNodeID("node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, seq := range []uint64{11, 12, 13} {
+		event, err := domain.NewTelemetry("temp", float64(seq), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.Ingest(context.Background(), sink.TelemetryItem{
+			Msg:    &event,
+			Origin: &sink.Origin{Node: node, Seq: seq},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if next.ingested != 1 || d.Duplicates() != 2 {
+		t.Fatalf("passed on %d and dropped %d readings, want 1 and 2", next.ingested, d.Duplicates())
+	}
+}
+
+func TestSequencesArePerSensor(t *testing.T) {
+	next := &countingIngestor{}
+	d := NewDedupIngestor(next, nil, nil)
+	node, err := domain.NewNodeID("node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the node numbers its readings in one sequence but delivers each sensor on its own,
+	// so hum's readings may arrive after newer ones of temp
+	for _, r := range []struct {
+		sensor string
+		seq    uint64
+	}{
+		{"temp", 2}, {"temp", 4}, {"hum", 1}, {"hum", 3}, {"temp", 4}, {"hum", 1},
+	} {
+		event, err := domain.NewTelemetry(r.sensor, 1, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.Ingest(context.Background(), sink.TelemetryItem{
+			Msg:    &event,
+			Origin: &sink.Origin{Node: node, Seq: r.seq},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if next.ingested != 4 || d.Duplicates() != 2 {
+		t.Fatalf("passed on %d and dropped %d readings, want 4 and 2", next.ingested, d.Duplicates())
+	}
+}
@@ -0,0 +1,320 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/kvoloboi/telemetry/cmd/sink/config"
+	"github.com/kvoloboi/telemetry/internal/application/common"
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/metrics"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+var (
+	ErrUnknownSensor = errors.New("unknown sensor")
+	ErrDeletedSensor = errors.New("sensor or its room is deleted")
+	ErrUnknownRoom   = errors.New("unknown room")
+	ErrExportGap     = errors.New("batch is past the export checkpoint")
+)
+
+// unknown sensor policies
+const (
+	PolicyReject = "reject"
+	PolicyCreate = "create"
+)
+
+// rejected lookups are retried after this long, so sensors added later get picked up
+const rejectTTL = time.Minute
+
+// Measurement is a telemetry event resolved to a sensor row.
+type Measurement struct {
+	SensorID   int64
+	MeasuredAt time.Time
+	Value      float64
+}
+
+// Store persists measurements together with the export checkpoint.
+type Store interface {
+	// Checkpoint returns the seq of the next batch to export.
+	Checkpoint(ctx context.Context) (uint64, error)
+	// Write inserts the rows of batch seq and moves the checkpoint past it atomically.
+	// Batches below the stored checkpoint are ignored, so replays never duplicate rows.
+	// A batch above the checkpoint returns ErrExportGap and writes nothing.
+	Write(ctx context.Context, seq uint64, rows []Measurement) error
+	// Skip moves the checkpoint forward to seq when the batches below it are lost.
+	Skip(ctx context.Context, seq uint64) error
+	// LookupSensor returns the id of an active sensor,
+	// ErrUnknownSensor or ErrDeletedSensor.
+	LookupSensor(ctx context.Context, name string) (int64, error)
+	// LookupRoom returns the id of an active room, or ErrUnknownRoom.
+	LookupRoom(ctx context.Context, name string) (int64, error)
+	// CreateSensor registers a sensor in a room and returns its id.
+	CreateSensor(ctx context.Context, name string, roomID int64, sensorType string) (int64, error)
+	Close() error
+}
+
+// Acker is notified once every batch below next is exported.
+type Acker interface {
+	Ack(next uint64)
+}
+
+type sensorEntry struct {
+	id      int64
+	err     error
+	expires time.Time
+}
+
+// Exporter tails the telemetry log and copies every batch into a Store.
+// Progress is checkpointed by batch seq inside the same transaction as the rows,
+// so restarts continue exactly where the last committed batch ended.
+type Exporter struct {
+	log    *telemetrylog.TelemetryLog
+	store  Store
+	cfg    config.ExportConfig
+	acker  Acker
+	logger *slog.Logger
+
+	backoff common.Backoff
+	sensors map[string]sensorEntry
+
+	exported        atomic.Int64
+	rejectedUnknown atomic.Int64
+	rejectedDeleted atomic.Int64
+	lostBatches     atomic.Int64
+
+	started atomic.Bool
+}
+
+// NewExporter constructs an exporter. Start() must be called explicitly.
+// acker may be nil.
+func NewExporter(
+	log *telemetrylog.TelemetryLog,
+	store Store,
+	cfg config.ExportConfig,
+	acker Acker,
+	logger *slog.Logger,
+) *Exporter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Exporter{
+		log:     log,
+		store:   store,
+		cfg:     cfg,
+		acker:   acker,
+		logger:  logger,
+		backoff: common.NewBackoff(200*time.Millisecond, 10*time.Second),
+		sensors: make(map[string]sensorEntry),
+	}
+}
+
+// Start launches the export loop. Only the first call takes effect.
+func (e *Exporter) Start(ctx context.Context) {
+	if e.started.Swap(true) {
+		return
+	}
+
+	go e.run(ctx)
+}
+
+func (e *Exporter) run(ctx context.Context) {
+	defer e.logStats()
+
+	var next uint64
+	err := e.retry(ctx, func() error {
+		var err error
+		next, err = e.store.Checkpoint(ctx)
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	e.logger.Info("exporter started", "from_seq", next)
+
+	reader := telemetrylog.NewTailReader(e.log, next)
+	defer reader.Close()
+
+	for {
+		batch, err := reader.Next(ctx)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) && !errors.Is(err, telemetrylog.ErrLogClosed) {
+				e.logger.Error("exporter stopped: failed to read telemetry log", "err", err)
+			}
+			return
+		}
+
+		if batch.Seq > next {
+			// the batches were pruned before they were exported
+			e.lostBatches.Add(int64(batch.Seq - next))
+			e.logger.Error("telemetry lost before export",
+				"err", ErrExportGap,
+				"from_seq", next,
+				"to_seq", batch.Seq-1,
+			)
+			if err := e.retry(ctx, func() error { return e.store.Skip(ctx, batch.Seq) }); err != nil {
+				return
+			}
+		}
+
+		if err := e.retry(ctx, func() error { return e.export(ctx, batch) }); err != nil {
+			return
+		}
+		next = max(next, batch.Seq+1)
+
+		if e.acker != nil {
+			e.acker.Ack(batch.Seq + 1)
+		}
+	}
+}
+
+func (e *Exporter) export(ctx context.Context, batch telemetrylog.TelemetryBatch) error {
+	rows := make([]Measurement, 0, len(batch.Events))
+	var unknown, deleted int64
+
+	for _, ev := range batch.Events {
+		id, err := e.resolve(ctx, ev.Sensor.String(), batch.Meta)
+		switch {
+		case errors.Is(err, ErrUnknownSensor):
+			unknown++
+			continue
+		case errors.Is(err, ErrDeletedSensor):
+			deleted++
+			continue
+		case err != nil:
+			return err
+		}
+
+		rows = append(rows, Measurement{
+			SensorID:   id,
+			MeasuredAt: ev.Timestamp.Time(),
+			Value:      ev.Value.Float64(),
+		})
+	}
+
+	// the checkpoint moves even if every event was rejected
+	if err := e.store.Write(ctx, batch.Seq, rows); err != nil {
+		return err
+	}
+
+	e.exported.Add(int64(len(rows)))
+	e.rejectedUnknown.Add(unknown)
+	e.rejectedDeleted.Add(deleted)
+
+	if unknown > 0 || deleted > 0 {
+		e.logger.Warn("rejected telemetry during export",
+			"seq", batch.Seq,
+			"unknown_sensor", unknown,
+			"deleted_sensor", deleted,
+		)
+	}
+
+	return nil
+}
+
+// resolve maps a sensor name to its id, applying the unknown sensor policy.
+// meta is the registry metadata stored with the batch, if any.
+func (e *Exporter) resolve(ctx context.Context, name string, meta map[string]domain.SensorMeta) (int64, error) {
+	if entry, ok := e.sensors[name]; ok {
+		if entry.err == nil || time.Now().Before(entry.expires) {
+			return entry.id, entry.err
+		}
+	}
+
+	id, err := e.store.LookupSensor(ctx, name)
+	if errors.Is(err, ErrUnknownSensor) && e.cfg.UnknownSensors == PolicyCreate {
+		id, err = e.create(ctx, name, meta)
+	}
+
+	switch {
+	case err == nil:
+		e.sensors[name] = sensorEntry{id: id}
+	case errors.Is(err, ErrUnknownSensor), errors.Is(err, ErrDeletedSensor):
+		e.sensors[name] = sensorEntry{err: err, expires: time.Now().Add(rejectTTL)}
+	}
+
+	return id, err
+}
+
+// create registers a sensor. A sensor the batch has registry metadata for is
+// created in the room of the same name with its type, any other in the configured room.
+func (e *Exporter) create(ctx context.Context, name string, meta map[string]domain.SensorMeta) (int64, error) {
+	roomID, sensorType := e.cfg.CreateRoomID, e.cfg.CreateSensorType
+
+	if m, ok := meta[name]; ok {
+		id, err := e.store.LookupRoom(ctx, m.Room)
+		if errors.Is(err, ErrUnknownRoom) {
+			return 0, fmt.Errorf("%w: %w %q", ErrUnknownSensor, err, m.Room)
+		}
+		if err != nil {
+			return 0, err
+		}
+		roomID, sensorType = id, string(m.Type)
+	}
+
+	id, err := e.store.CreateSensor(ctx, name, roomID, sensorType)
+	if err != nil {
+		return 0, err
+	}
+
+	e.logger.Info("created sensor", "sensor", name, "id", id, "room_id", roomID, "type", sensorType)
+	return id, nil
+}
+
+// retry runs fn until it succeeds or ctx is done.
+func (e *Exporter) retry(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		delay := e.backoff.Next(min(attempt, 16))
+		e.logger.Warn("export failed, retrying", "attempt", attempt, "delay", delay, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (e *Exporter) logStats() {
+	e.logger.Info("exporter stopped",
+		"exported", e.exported.Load(),
+		"rejected_unknown", e.rejectedUnknown.Load(),
+		"rejected_deleted", e.rejectedDeleted.Load(),
+		"lost_batches", e.lostBatches.Load(),
+	)
+}
+
+// RegisterMetrics exposes the rows exported, the events rejected per reason
+// and the batches pruned before they could be exported.
+func (e *Exporter) RegisterMetrics(reg *metrics.Registry) {
+	reg.Register("telemetry_sink_export_rows_total", "Measurements written to the export store.",
+		metrics.CounterFunc(func() float64 { return float64(e.exported.Load()) }))
+
+	const (
+		name = "telemetry_sink_export_rejected_total"
+		help = "Telemetry skipped by the exporter."
+	)
+	reg.Register(name, help, metrics.CounterFunc(func() float64 { return float64(e.rejectedUnknown.Load()) }),
+		"reason", "unknown_sensor")
+	reg.Register(name, help, metrics.CounterFunc(func() float64 { return float64(e.rejectedDeleted.Load()) }),
+		"reason", "deleted_sensor")
+
+	reg.Register("telemetry_sink_export_lost_batches_total", "Batches pruned from the log before they were exported.",
+		metrics.CounterFunc(func() float64 { return float64(e.lostBatches.Load()) }))
+}
@@ -0,0 +1,267 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/cmd/sink/config"
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// fakeStore keeps the rows and the checkpoint in memory with the semantics of
+// the postgres store. failCommits makes that many writes fail after they were
+// committed, as when the connection drops before the commit is confirmed.
+// It knows the sensor temp and the sensors created through it.
+type fakeStore struct {
+	mu          sync.Mutex
+	next        uint64
+	rows        []Measurement
+	failCommits int
+	rooms       map[string]int64
+	created     map[string]createdSensor
+}
+
+type createdSensor struct {
+	roomID     int64
+	sensorType string
+}
+
+func (s *fakeStore) Checkpoint(context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next, nil
+}
+
+func (s *fakeStore) Write(_ context.Context, seq uint64, rows []Measurement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq < s.next {
+		return nil
+	}
+	if seq > s.next {
+		return ErrExportGap
+	}
+	s.rows = append(s.rows, rows...)
+	s.next = seq + 1
+
+	if s.failCommits > 0 {
+		s.failCommits--
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func (s *fakeStore) Skip(_ context.Context, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = max(s.next, seq)
+	return nil
+}
+
+func (s *fakeStore) LookupSensor(_ context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "temp" {
+		return 1, nil
+	}
+	if _, ok := s.created[name]; ok {
+		return 2, nil
+	}
+	return 0, ErrUnknownSensor
+}
+
+func (s *fakeStore) LookupRoom(_ context.Context, name string) (int64, error) {
+	id, ok := s.rooms[name]
+	if !ok {
+		return 0, ErrUnknownRoom
+	}
+	return id, nil
+}
+
+func (s *fakeStore) CreateSensor(_ context.Context, name string, roomID int64, sensorType string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.created == nil {
+		s.created = make(map[string]createdSensor)
+	}
+	s.created[name] = createdSensor{roomID: roomID, sensorType: sensorType}
+	return 2, nil
+}
+
+func (s *fakeStore) Close() error { return nil }
+
+func (s *fakeStore) values() []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := make([]float64, len(s.rows))
+	for i, r := range s.rows {
+		values[i] = r.Value
+	}
+	return values
+}
+
+type ackRecorder chan uint64
+
+func (a ackRecorder) Ack(next uint64) { a <- next }
+
+// openLog returns a log holding one batch per value, each in a segment of its own.
+func openLog(t *testing.T, values ...float64) *telemetrylog.TelemetryLog {
+	t.Helper()
+
+	tl, err := telemetrylog.Open(t.TempDir(), &telemetrylog.Config{SegmentMaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tl.Close() })
+
+	for _, v := range values {
+		event, err := domain.NewTelemetry("temp", v, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tl.Append([]domain.Telemetry{event}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tl.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	return tl
+}
+
+// exportUntil runs an exporter until it acknowledged every batch below next.
+// Unknown sensors are created, in room 1 with type R unless the batch has metadata for them.
+func exportUntil(t *testing.T, tl *telemetrylog.TelemetryLog, store Store, next uint64) *Exporter {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := config.ExportConfig{
+		UnknownSensors:   PolicyCreate,
+		CreateRoomID:     1,
+		CreateSensorType: "R",
+	}
+	acks := make(ackRecorder, 16)
+	e := NewExporter(tl, store, cfg, acks, nil)
+	e.Start(ctx)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-acks:
+			if got == next {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("exporter did not acknowledge %d", next)
+		}
+	}
+}
+
+func assertValues(t *testing.T, got []float64, want ...float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("exported %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("exported %v, want %v", got, want)
+		}
+	}
+}
+
+func TestExporterResumesFromCheckpoint(t *testing.T) {
+	tl := openLog(t, 0, 1, 2, 3)
+	store := &fakeStore{next: 2}
+
+	exportUntil(t, tl, store, 4)
+
+	assertValues(t, store.values(), 2, 3)
+}
+
+func TestExporterReexportIsIdempotent(t *testing.T) {
+	tl := openLog(t, 0, 1, 2)
+	store := &fakeStore{failCommits: 1}
+
+	// the failed commit of batch 0 is retried without duplicating its rows
+	exportUntil(t, tl, store, 3)
+	assertValues(t, store.values(), 0, 1, 2)
+
+	// after a restart only the batches past the checkpoint are exported
+	event, err := domain.NewTelemetry("temp", 3, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tl.Append([]domain.Telemetry{event}); err != nil {
+		t.Fatal(err)
+	}
+	exportUntil(t, tl, store, 4)
+	assertValues(t, store.values(), 0, 1, 2, 3)
+}
+
+func TestExporterReportsPrunedBatches(t *testing.T) {
+	tl := openLog(t, 0, 1, 2, 3)
+	if _, err := telemetrylog.Prune(tl.Dir(), telemetrylog.RetentionPolicy{MinSeq: 2}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeStore{}
+
+	e := exportUntil(t, tl, store, 4)
+
+	assertValues(t, store.values(), 2, 3)
+	if got := e.lostBatches.Load(); got != 2 {
+		t.Fatalf("lost batches = %d, want 2", got)
+	}
+	if next, _ := store.Checkpoint(context.Background()); next != 4 {
+		t.Fatalf("checkpoint = %d, want 4", next)
+	}
+}
+
+func TestExporterCreatesSensorsFromBatchMeta(t *testing.T) {
+	tl := openLog(t)
+	var events []domain.Telemetry
+	for _, sensor := range []string{"lab_v", "unregistered", "moved_v"} {
+		event, err := domain.NewTelemetry(sensor, 1, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	meta := map[string]domain.SensorMeta{
+		"lab_v":   {Room: "lab", Type: domain.SensorTypeVoltage},
+		"moved_v": {Room: "attic", Type: domain.SensorTypeVoltage},
+	}
+	if _, err := tl.AppendAnnotated(events, telemetrylog.Annotations{Meta: meta}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &fakeStore{rooms: map[string]int64{"lab": 7}}
+	e := exportUntil(t, tl, store, 1)
+
+	want := map[string]createdSensor{
+		"lab_v":        {roomID: 7, sensorType: "V"},
+		"unregistered": {roomID: 1, sensorType: "R"},
+	}
+	if len(store.created) != len(want) {
+		t.Fatalf("created %+v, want %+v", store.created, want)
+	}
+	for name, w := range want {
+		if got := store.created[name]; got != w {
+			t.Fatalf("created %s as %+v, want %+v", name, got, w)
+		}
+	}
+	// a room missing in postgres cannot hold the sensor
+	if got := e.rejectedUnknown.Load(); got != 1 {
+		t.Fatalf("rejected unknown = %d, want 1", got)
+	}
+}
@@ -2,14 +2,67 @@ package sink
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync/atomic"
+	"time"
 
+	"github.com/kvoloboi/telemetry/cmd/sink/config"
 	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/metrics"
 )
 
+// ErrRejected wraps the reason an ingestor refused a single item.
+// The item is dropped, but the stream it came from stays usable.
+var ErrRejected = errors.New("telemetry rejected")
+
+// ErrOverloaded is returned for an item refused because the ingest queue is full.
+// Unlike ErrRejected, the same item may succeed later.
+var ErrOverloaded = errors.New("ingest queue full")
+
+// overload policies of ChannelIngestor
+const (
+	PolicyDrop   = "drop"   // refuse the newest item at once
+	PolicyBlock  = "block"  // wait up to a timeout for queue space
+	PolicyReject = "reject" // refuse with a hint when to retry
+)
+
+// RetryAfterError tells the sender of a refused item when to try again.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", e.Err, e.RetryAfter)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// Origin identifies a reading by the node that sent it and the node's sequence number.
+type Origin struct {
+	Node domain.NodeID
+	Seq  uint64
+}
+
 type TelemetryItem struct {
-	Msg  *domain.Telemetry
-	Size int
+	Msg    *domain.Telemetry
+	Size   int
+	Origin *Origin            // set for sequenced telemetry
+	Meta   *domain.SensorMeta // set by the sensor registry, stored with the batch
+
+	// Appended, if set and Ingest returned nil, is called once with the log seq of
+	// the batch holding Msg, or with the error that kept Msg out of the log.
+	// It must not block.
+	Appended func(seq uint64, err error)
+}
+
+// DurableLog tells when appended batches are safely on disk.
+type DurableLog interface {
+	WaitDurable(ctx context.Context, seq uint64) error
 }
 
 type TelemetryIngestor interface {
@@ -17,32 +70,113 @@ type TelemetryIngestor interface {
 	Close() error
 }
 
+// ChannelIngestor hands items to the worker through a bounded channel.
+// What happens when the channel is full is decided by the overload policy;
+// every refused item is counted.
 type ChannelIngestor struct {
 	out    chan<- TelemetryItem
+	cfg    config.OverloadConfig
 	logger *slog.Logger
+
+	dropped    atomic.Int64
+	overloaded atomic.Bool        // to log only when refusing starts and stops
+	latency    *metrics.Histogram // from Ingest until the item is appended to the log
 }
 
-func NewChannelIngestor(out chan<- TelemetryItem, logger *slog.Logger) *ChannelIngestor {
+func NewChannelIngestor(out chan<- TelemetryItem, cfg config.OverloadConfig, logger *slog.Logger) *ChannelIngestor {
 	if logger == nil {
 		logger = slog.Default()
 	}
 
 	return &ChannelIngestor{
-		out:    out,
-		logger: logger,
+		out:     out,
+		cfg:     cfg,
+		logger:  logger,
+		latency: metrics.NewHistogram(metrics.DurationBuckets),
 	}
 }
 
 func (i *ChannelIngestor) Ingest(ctx context.Context, item TelemetryItem) error {
+	start := time.Now()
+	appended := item.Appended
+	item.Appended = func(seq uint64, err error) {
+		if err == nil {
+			i.latency.ObserveSince(start)
+		}
+		if appended != nil {
+			appended(seq, err)
+		}
+	}
+
 	select {
 	case i.out <- item:
+		i.accepted()
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		i.logger.Warn("dropping telemetry: channel full", "sensor", item.Msg.Sensor)
-		return nil
 	}
+
+	if i.cfg.Policy == PolicyBlock {
+		timer := time.NewTimer(i.cfg.BlockTimeout)
+		defer timer.Stop()
+
+		select {
+		case i.out <- item:
+			i.accepted()
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	i.dropped.Add(1)
+	if !i.overloaded.Swap(true) {
+		i.logger.Warn("refusing telemetry: channel full", "sensor", item.Msg.Sensor, "policy", i.cfg.Policy)
+	}
+
+	if i.cfg.Policy == PolicyReject {
+		return &RetryAfterError{Err: ErrOverloaded, RetryAfter: i.cfg.RetryAfter}
+	}
+	return ErrOverloaded
+}
+
+// accepted logs once the queue takes items again after refusing some.
+func (i *ChannelIngestor) accepted() {
+	if i.overloaded.Load() && i.overloaded.Swap(false) {
+		i.logger.Info("ingest queue has room again", "refused_total", i.dropped.Load())
+	}
+}
+
+// IngestStats describes the ingest queue.
+type IngestStats struct {
+	Policy   string `json:"policy"`
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+	Dropped  int64  `json:"dropped"` // items refused since start
+}
+
+// Stats returns the current queue fill and the number of refused items.
+func (i *ChannelIngestor) Stats() IngestStats {
+	return IngestStats{
+		Policy:   i.cfg.Policy,
+		Queued:   len(i.out),
+		Capacity: cap(i.out),
+		Dropped:  i.dropped.Load(),
+	}
+}
+
+// RegisterMetrics exposes the queue fill, refused items and ingest latency.
+func (i *ChannelIngestor) RegisterMetrics(reg *metrics.Registry) {
+	reg.Register("telemetry_sink_ingest_queue_depth", "Items waiting in the ingest queue.",
+		metrics.GaugeFunc(func() float64 { return float64(len(i.out)) }))
+	reg.Register("telemetry_sink_ingest_queue_capacity", "Capacity of the ingest queue.",
+		metrics.GaugeFunc(func() float64 { return float64(cap(i.out)) }))
+	reg.Register("telemetry_sink_ingest_refused_total", "Items refused because the ingest queue was full.",
+		metrics.CounterFunc(func() float64 { return float64(i.dropped.Load()) }))
+	reg.Register("telemetry_sink_ingest_latency_seconds", "Time from ingest until the item is appended to the log.",
+		i.latency)
 }
 
 func (i *ChannelIngestor) Close() error {
@@ -2,29 +2,43 @@ package ratelimit
 
 import (
 	"context"
+	"time"
+
 	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/metrics"
 )
 
 type RateLimitedIngestor struct {
 	next    sink.TelemetryIngestor
 	limiter IngestRatePolicy
+	waited  *metrics.Counter // seconds spent waiting for the limiter
 }
 
 func NewRateLimitedIngestor(next sink.TelemetryIngestor, limiter IngestRatePolicy) *RateLimitedIngestor {
 	return &RateLimitedIngestor{
 		next:    next,
 		limiter: limiter,
+		waited:  metrics.NewCounter(),
 	}
 }
 
 func (r *RateLimitedIngestor) Ingest(ctx context.Context, item sink.TelemetryItem) error {
-	if err := r.limiter.Wait(ctx, item); err != nil {
+	start := time.Now()
+	err := r.limiter.Wait(ctx, item)
+	r.waited.Add(time.Since(start).Seconds())
+	if err != nil {
 		return err
 	}
 
 	return r.next.Ingest(ctx, item)
 }
 
+// RegisterMetrics exposes the time spent waiting for the rate limits.
+func (r *RateLimitedIngestor) RegisterMetrics(reg *metrics.Registry) {
+	reg.Register("telemetry_sink_ratelimit_wait_seconds_total", "Time ingestion spent waiting for the rate limits.",
+		r.waited)
+}
+
 func (r *RateLimitedIngestor) Close() error {
 	return r.next.Close()
 }
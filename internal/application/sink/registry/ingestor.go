@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/metrics"
+)
+
+// Rejections counts rejected telemetry per reason.
+type Rejections struct {
+	UnknownSensor int64 `json:"unknown_sensor"`
+	DeletedSensor int64 `json:"deleted_sensor"`
+	DeletedRoom   int64 `json:"deleted_room"`
+}
+
+// RegisteredIngestor only passes on telemetry of active registered sensors,
+// with the room and type the sensor had when the telemetry arrived.
+type RegisteredIngestor struct {
+	next     sink.TelemetryIngestor
+	registry *Registry
+	logger   *slog.Logger
+
+	unknownSensor atomic.Int64
+	deletedSensor atomic.Int64
+	deletedRoom   atomic.Int64
+}
+
+func NewRegisteredIngestor(
+	next sink.TelemetryIngestor,
+	registry *Registry,
+	logger *slog.Logger,
+) *RegisteredIngestor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &RegisteredIngestor{
+		next:     next,
+		registry: registry,
+		logger:   logger,
+	}
+}
+
+func (i *RegisteredIngestor) Ingest(ctx context.Context, item sink.TelemetryItem) error {
+	meta, err := i.registry.Lookup(item.Msg.Sensor.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownSensor):
+			i.unknownSensor.Add(1)
+		case errors.Is(err, ErrDeletedSensor):
+			i.deletedSensor.Add(1)
+		case errors.Is(err, ErrDeletedRoom):
+			i.deletedRoom.Add(1)
+		}
+		i.logger.Debug("rejecting telemetry", "sensor", item.Msg.Sensor, "reason", err)
+		return fmt.Errorf("%w: %w", sink.ErrRejected, err)
+	}
+
+	item.Meta = &meta
+	return i.next.Ingest(ctx, item)
+}
+
+func (i *RegisteredIngestor) Close() error {
+	return i.next.Close()
+}
+
+// RegisterMetrics exposes the rejection counts per reason.
+func (i *RegisteredIngestor) RegisterMetrics(reg *metrics.Registry) {
+	const (
+		name = "telemetry_sink_registry_rejected_total"
+		help = "Telemetry rejected by the sensor registry."
+	)
+	reg.Register(name, help, metrics.CounterFunc(func() float64 { return float64(i.unknownSensor.Load()) }),
+		"reason", "unknown_sensor")
+	reg.Register(name, help, metrics.CounterFunc(func() float64 { return float64(i.deletedSensor.Load()) }),
+		"reason", "deleted_sensor")
+	reg.Register(name, help, metrics.CounterFunc(func() float64 { return float64(i.deletedRoom.Load()) }),
+		"reason", "deleted_room")
+}
+
+// Rejections returns the rejection counts since start.
+func (i *RegisteredIngestor) Rejections() Rejections {
+	return Rejections{
+		UnknownSensor: i.unknownSensor.Load(),
+		DeletedSensor: i.deletedSensor.Load(),
+		DeletedRoom:   i.deletedRoom.Load(),
+	}
+}
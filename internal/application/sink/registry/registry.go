@@ -0,0 +1,341 @@
+// Package registry keeps the set of sensors the sink accepts telemetry from,
+// mirroring the rooms and sensors tables of sql/schema.sql.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+var (
+	ErrUnknownSensor = errors.New("unknown sensor")
+	ErrDeletedSensor = errors.New("sensor is deleted")
+	ErrDeletedRoom   = errors.New("sensor room is deleted")
+	ErrUnknownRoom   = errors.New("unknown room")
+)
+
+type Room struct {
+	Name      string     `json:"name"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type Sensor struct {
+	Name      string            `json:"name"`
+	Room      string            `json:"room"`
+	Type      domain.SensorType `json:"type"`
+	DeletedAt *time.Time        `json:"deleted_at,omitempty"`
+}
+
+// Snapshot is the full registry contents. It is also the registry file format.
+type Snapshot struct {
+	Rooms   []Room   `json:"rooms"`
+	Sensors []Sensor `json:"sensors"`
+}
+
+// state is an immutable, indexed snapshot. Lookups read it without locking.
+type state struct {
+	rooms   map[string]Room
+	sensors map[string]Sensor
+}
+
+func newState(snap Snapshot) (*state, error) {
+	s := &state{
+		rooms:   make(map[string]Room, len(snap.Rooms)),
+		sensors: make(map[string]Sensor, len(snap.Sensors)),
+	}
+
+	for _, r := range snap.Rooms {
+		if r.Name == "" {
+			return nil, errors.New("room name must not be empty")
+		}
+		if _, ok := s.rooms[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate room %q", r.Name)
+		}
+		s.rooms[r.Name] = r
+	}
+
+	for _, sensor := range snap.Sensors {
+		if _, err := domain.NewSensorName(sensor.Name); err != nil {
+			return nil, fmt.Errorf("sensor %q: %w", sensor.Name, err)
+		}
+		if _, err := domain.NewSensorType(string(sensor.Type)); err != nil {
+			return nil, fmt.Errorf("sensor %q: %w: %q", sensor.Name, err, sensor.Type)
+		}
+		if _, ok := s.rooms[sensor.Room]; !ok {
+			return nil, fmt.Errorf("sensor %q: %w: %q", sensor.Name, ErrUnknownRoom, sensor.Room)
+		}
+		if _, ok := s.sensors[sensor.Name]; ok {
+			return nil, fmt.Errorf("duplicate sensor %q", sensor.Name)
+		}
+		s.sensors[sensor.Name] = sensor
+	}
+
+	return s, nil
+}
+
+func (s *state) snapshot() Snapshot {
+	snap := Snapshot{
+		Rooms:   make([]Room, 0, len(s.rooms)),
+		Sensors: make([]Sensor, 0, len(s.sensors)),
+	}
+	for _, r := range s.rooms {
+		snap.Rooms = append(snap.Rooms, r)
+	}
+	for _, sensor := range s.sensors {
+		snap.Sensors = append(snap.Sensors, sensor)
+	}
+
+	sort.Slice(snap.Rooms, func(i, j int) bool { return snap.Rooms[i].Name < snap.Rooms[j].Name })
+	sort.Slice(snap.Sensors, func(i, j int) bool { return snap.Sensors[i].Name < snap.Sensors[j].Name })
+	return snap
+}
+
+// Registry is a file-backed sensor registry.
+// Changes made through its methods are written back to the file,
+// and changes made to the file are picked up by Watch.
+type Registry struct {
+	path   string
+	logger *slog.Logger
+
+	mu  sync.Mutex        // serializes changes and reloads
+	sum [sha256.Size]byte // of the file contents currently loaded
+
+	state atomic.Pointer[state]
+}
+
+// Open loads the registry file at path.
+func Open(path string, logger *slog.Logger) (*Registry, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	r := &Registry{path: path, logger: logger}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Lookup returns the metadata of an active sensor, or the reason it is not accepted.
+func (r *Registry) Lookup(name string) (domain.SensorMeta, error) {
+	s := r.state.Load()
+
+	sensor, ok := s.sensors[name]
+	if !ok {
+		return domain.SensorMeta{}, ErrUnknownSensor
+	}
+	if sensor.DeletedAt != nil {
+		return domain.SensorMeta{}, ErrDeletedSensor
+	}
+	if s.rooms[sensor.Room].DeletedAt != nil {
+		return domain.SensorMeta{}, ErrDeletedRoom
+	}
+
+	return domain.SensorMeta{Room: sensor.Room, Type: sensor.Type}, nil
+}
+
+// Snapshot returns the registry contents ordered by name.
+func (r *Registry) Snapshot() Snapshot {
+	return r.state.Load().snapshot()
+}
+
+// Reload re-reads the registry file if it changed since it was last loaded.
+// An invalid file is rejected as a whole and the current registry stays in place.
+// Changes are detected by content, as an edit within the resolution of the
+// file's mtime, or one that keeps its size, would otherwise be missed.
+func (r *Registry) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	sum := sha256.Sum256(data)
+	if r.state.Load() != nil && sum == r.sum {
+		return false, nil
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return false, fmt.Errorf("parse registry %s: %w", r.path, err)
+	}
+
+	s, err := newState(snap)
+	if err != nil {
+		return false, fmt.Errorf("invalid registry %s: %w", r.path, err)
+	}
+
+	r.state.Store(s)
+	r.sum = sum
+	return true, nil
+}
+
+// Watch polls the registry file and reloads it on change until ctx is done.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.Reload()
+			if err != nil {
+				r.logger.Error("failed to reload sensor registry", "path", r.path, "err", err)
+				continue
+			}
+			if changed {
+				s := r.state.Load()
+				r.logger.Info("sensor registry reloaded", "rooms", len(s.rooms), "sensors", len(s.sensors))
+			}
+		}
+	}
+}
+
+// PutRoom creates a room, or restores it if it was deleted.
+func (r *Registry) PutRoom(name string) (Room, error) {
+	var room Room
+	err := r.update(func(snap *Snapshot) error {
+		for i := range snap.Rooms {
+			if snap.Rooms[i].Name == name {
+				snap.Rooms[i].DeletedAt = nil
+				room = snap.Rooms[i]
+				return nil
+			}
+		}
+		room = Room{Name: name}
+		snap.Rooms = append(snap.Rooms, room)
+		return nil
+	})
+	return room, err
+}
+
+// DeleteRoom soft-deletes a room. Its sensors are rejected until it is restored.
+func (r *Registry) DeleteRoom(name string) error {
+	return r.update(func(snap *Snapshot) error {
+		for i := range snap.Rooms {
+			if snap.Rooms[i].Name == name {
+				if snap.Rooms[i].DeletedAt == nil {
+					now := time.Now().UTC()
+					snap.Rooms[i].DeletedAt = &now
+				}
+				return nil
+			}
+		}
+		return ErrUnknownRoom
+	})
+}
+
+// PutSensor creates or moves a sensor, restoring it if it was deleted.
+func (r *Registry) PutSensor(name, room string, sensorType domain.SensorType) (Sensor, error) {
+	sensor := Sensor{Name: name, Room: room, Type: sensorType}
+	err := r.update(func(snap *Snapshot) error {
+		for i := range snap.Sensors {
+			if snap.Sensors[i].Name == name {
+				snap.Sensors[i] = sensor
+				return nil
+			}
+		}
+		snap.Sensors = append(snap.Sensors, sensor)
+		return nil
+	})
+	return sensor, err
+}
+
+// DeleteSensor soft-deletes a sensor.
+func (r *Registry) DeleteSensor(name string) error {
+	return r.update(func(snap *Snapshot) error {
+		for i := range snap.Sensors {
+			if snap.Sensors[i].Name == name {
+				if snap.Sensors[i].DeletedAt == nil {
+					now := time.Now().UTC()
+					snap.Sensors[i].DeletedAt = &now
+				}
+				return nil
+			}
+		}
+		return ErrUnknownSensor
+	})
+}
+
+// update applies fn to a copy of the registry, validates the result,
+// writes it to the file and only then makes it visible to lookups.
+func (r *Registry) update(fn func(snap *Snapshot) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := r.state.Load().snapshot()
+	if err := fn(&snap); err != nil {
+		return err
+	}
+
+	s, err := newState(snap)
+	if err != nil {
+		return err
+	}
+
+	sum, err := r.write(snap)
+	if err != nil {
+		return err
+	}
+
+	r.state.Store(s)
+	r.sum = sum
+	return nil
+}
+
+// write replaces the registry file atomically and returns the hash of its contents.
+func (r *Registry) write(snap Snapshot) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return sum, err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return sum, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if info, err := os.Stat(r.path); err == nil {
+		if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+			tmp.Close()
+			return sum, err
+		}
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return sum, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return sum, err
+	}
+	if err := tmp.Close(); err != nil {
+		return sum, err
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return sum, err
+	}
+
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,180 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// openFile writes data as the registry file and opens it.
+func openFile(t *testing.T, data string) (*Registry, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "registry.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, path
+}
+
+// recordingIngestor keeps the items passed on to it.
+type recordingIngestor struct {
+	items []sink.TelemetryItem
+}
+
+func (r *recordingIngestor) Ingest(_ context.Context, item sink.TelemetryItem) error {
+	r.items = append(r.items, item)
+	return nil
+}
+
+func (r *recordingIngestor) Close() error { return nil }
+
+func TestReloadDetectsSameSizeEditWithUnchangedMtime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	write := func(room string) {
+		t.Helper()
+		data := `{"rooms": [{"name": "` + room + `"}], "sensors": [{"name": "a_v1", "room": "` + room + `", "type": "V"}]}`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("room_A")
+	r, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an edit within the same second keeps the size and, on coarse filesystems, the mtime
+	write("room_B")
+	if err := os.Chtimes(path, time.Time{}, info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("edit not detected")
+	}
+	if meta, err := r.Lookup("a_v1"); err != nil || meta.Room != "room_B" {
+		t.Fatalf("lookup after reload = %+v, %v", meta, err)
+	}
+
+	if changed, err := r.Reload(); err != nil || changed {
+		t.Fatalf("reload of an unchanged file = %v, %v", changed, err)
+	}
+}
+
+func TestIngestorRejectsByReason(t *testing.T) {
+	r, _ := openFile(t, `{
+		"rooms": [
+			{"name": "lab"},
+			{"name": "attic", "deleted_at": "2026-01-01T00:00:00Z"}
+		],
+		"sensors": [
+			{"name": "lab_v", "room": "lab", "type": "V"},
+			{"name": "lab_r", "room": "lab", "type": "R", "deleted_at": "2026-01-01T00:00:00Z"},
+			{"name": "attic_v", "room": "attic", "type": "V"}
+		]
+	}`)
+
+	next := &recordingIngestor{}
+	ing := NewRegisteredIngestor(next, r, nil)
+
+	for _, tc := range []struct {
+		sensor string
+		want   error
+	}{
+		{sensor: "lab_v"},
+		{sensor: "nowhere_v", want: ErrUnknownSensor},
+		{sensor: "lab_r", want: ErrDeletedSensor},
+		{sensor: "attic_v", want: ErrDeletedRoom},
+	} {
+		event, err := domain.NewTelemetry(tc.sensor, 1, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ing.Ingest(context.Background(), sink.TelemetryItem{Msg: &event})
+		if tc.want == nil {
+			if err != nil {
+				t.Fatalf("%s: %v", tc.sensor, err)
+			}
+			continue
+		}
+		if !errors.Is(err, sink.ErrRejected) || !errors.Is(err, tc.want) {
+			t.Fatalf("%s: err = %v, want a rejection for %v", tc.sensor, err, tc.want)
+		}
+	}
+
+	if len(next.items) != 1 {
+		t.Fatalf("passed on %d items, want 1", len(next.items))
+	}
+	want := domain.SensorMeta{Room: "lab", Type: domain.SensorTypeVoltage}
+	if meta := next.items[0].Meta; meta == nil || *meta != want {
+		t.Fatalf("meta = %v, want %+v", meta, want)
+	}
+	if got := ing.Rejections(); got != (Rejections{UnknownSensor: 1, DeletedSensor: 1, DeletedRoom: 1}) {
+		t.Fatalf("rejections = %+v, want one per reason", got)
+	}
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	r, path := openFile(t, `{"rooms": [{"name": "lab"}], "sensors": []}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	data := `{"rooms": [{"name": "lab"}], "sensors": [{"name": "lab_v", "room": "lab", "type": "V"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := r.Lookup("lab_v"); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("sensor added to the file never became known")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInvalidFileKeepsRegistry(t *testing.T) {
+	r, path := openFile(t, `{"rooms": [{"name": "lab"}], "sensors": [{"name": "lab_v", "room": "lab", "type": "V"}]}`)
+
+	for name, data := range map[string]string{
+		"malformed json": `{"rooms": [`,
+		"unknown room":   `{"rooms": [], "sensors": [{"name": "lab_v", "room": "lab", "type": "V"}]}`,
+		"unknown type":   `{"rooms": [{"name": "lab"}], "sensors": [{"name": "lab_v", "room": "lab", "type": "X"}]}`,
+		"duplicate room": `{"rooms": [{"name": "lab"}, {"name": "lab"}], "sensors": []}`,
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reload(); err == nil {
+			t.Fatalf("%s: reload accepted the file", name)
+		}
+		if meta, err := r.Lookup("lab_v"); err != nil || meta.Room != "lab" {
+			t.Fatalf("%s: lookup after a rejected reload = %+v, %v", name, meta, err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package report computes the per-room V/R/I report of sql/report.sql
+// directly from telemetry log batches, without a database.
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// Sensor places a sensor in a room.
+type Sensor struct {
+	Name string
+	Room string
+	Type domain.SensorType
+}
+
+// Params selects the reported time range [From, To).
+// Measurements from Lookback before From are read too,
+// so the first rows can carry R forward from earlier seconds.
+type Params struct {
+	From     time.Time
+	To       time.Time
+	Lookback time.Duration
+}
+
+// Row is one report line: the room averages of one second.
+type Row struct {
+	Room      string
+	Timestamp time.Time
+	V         float64
+	R         float64
+	I         float64
+}
+
+type sensorSecond struct {
+	sensor string
+	ts     int64
+}
+
+type roomSecond struct {
+	room string
+	ts   int64
+}
+
+type mean struct {
+	sum float64
+	n   int
+}
+
+func (m *mean) add(v float64) {
+	m.sum += v
+	m.n++
+}
+
+func (m mean) value() float64 {
+	return m.sum / float64(m.n)
+}
+
+// Builder accumulates measurements and produces the report.
+// The order in which events are added does not matter.
+type Builder struct {
+	params  Params
+	sensors map[string]Sensor
+	seconds map[sensorSecond]*mean
+}
+
+func NewBuilder(sensors []Sensor, params Params) *Builder {
+	b := &Builder{
+		params:  params,
+		sensors: make(map[string]Sensor, len(sensors)),
+		seconds: make(map[sensorSecond]*mean),
+	}
+	for _, s := range sensors {
+		b.sensors[s.Name] = s
+	}
+	return b
+}
+
+// Add records one event. Events of unknown sensors or outside the
+// lookback-extended range are ignored.
+func (b *Builder) Add(e domain.Telemetry) {
+	name := e.Sensor.String()
+	if _, ok := b.sensors[name]; !ok {
+		return
+	}
+
+	ts := e.Timestamp.Time()
+	if ts.Before(b.params.From.Add(-b.params.Lookback)) || !ts.Before(b.params.To) {
+		return
+	}
+
+	key := sensorSecond{sensor: name, ts: ts.Truncate(time.Second).Unix()}
+	m, ok := b.seconds[key]
+	if !ok {
+		m = &mean{}
+		b.seconds[key] = m
+	}
+	m.add(e.Value.Float64())
+}
+
+// Rows returns the report ordered by room and time, as sql/report.sql returns it.
+//
+// Every sensor is first averaged per second, then sensors of the same type
+// are averaged per room. Rows follow the V timeline: a second without V
+// produces no row. R is the highest R of the room seen so far on that
+// timeline, so R measured in seconds without V is never used.
+// V and R are rounded to 2 places and I to 3, like ROUND on numeric.
+func (b *Builder) Rows() []Row {
+	type typed struct {
+		V, R mean
+	}
+	rooms := make(map[roomSecond]*typed)
+
+	for key, m := range b.seconds {
+		s := b.sensors[key.sensor]
+		rk := roomSecond{room: s.Room, ts: key.ts}
+		t, ok := rooms[rk]
+		if !ok {
+			t = &typed{}
+			rooms[rk] = t
+		}
+
+		switch s.Type {
+		case domain.SensorTypeVoltage:
+			t.V.add(m.value())
+		case domain.SensorTypeResistance:
+			t.R.add(m.value())
+		}
+	}
+
+	keys := make([]roomSecond, 0, len(rooms))
+	for k, t := range rooms {
+		if t.V.n > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].room != keys[j].room {
+			return keys[i].room < keys[j].room
+		}
+		return keys[i].ts < keys[j].ts
+	})
+
+	var (
+		rows []Row
+		room string
+		maxR float64
+		hasR bool
+	)
+
+	for _, k := range keys {
+		if k.room != room {
+			room, hasR = k.room, false
+		}
+
+		t := rooms[k]
+		if t.R.n > 0 && (!hasR || t.R.value() > maxR) {
+			maxR, hasR = t.R.value(), true
+		}
+		if !hasR {
+			continue
+		}
+
+		ts := time.Unix(k.ts, 0).UTC()
+		if ts.Before(b.params.From) {
+			continue
+		}
+
+		v := t.V.value()
+		rows = append(rows, Row{
+			Room:      k.room,
+			Timestamp: ts,
+			V:         roundNumeric(v, 2),
+			R:         roundNumeric(maxR, 2),
+			I:         roundNumeric(v/maxR, 3),
+		})
+	}
+
+	return rows
+}
+
+// roundNumeric rounds v like ROUND(v::numeric, places) in postgres: the cast
+// keeps 15 significant digits, and halves are rounded away from zero.
+func roundNumeric(v float64, places int) float64 {
+	d, ok := new(big.Rat).SetString(strconv.FormatFloat(v, 'g', 15, 64))
+	if !ok {
+		// NaN and infinities
+		return v
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	d.Mul(d, new(big.Rat).SetInt(scale))
+
+	q, r := new(big.Int).QuoRem(d.Num(), d.Denom(), new(big.Int))
+	if r.Abs(r).Lsh(r, 1).Cmp(d.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(d.Num().Sign())))
+	}
+
+	f, _ := new(big.Rat).SetFrac(q, scale).Float64()
+	return f
+}
+
+// Build computes the report from the telemetry log in dir.
+// The sparse index is used to skip batches older than the lookback window.
+func Build(dir string, sensors []Sensor, params Params) ([]Row, error) {
+	if !params.From.Before(params.To) {
+		return nil, fmt.Errorf("empty report range: from %s, to %s", params.From, params.To)
+	}
+
+	r, err := telemetrylog.NewBatchReaderFromTime(dir, params.From.Add(-params.Lookback))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b := NewBuilder(sensors, params)
+
+	for {
+		batch, err := r.ReadBatch()
+		if errors.Is(err, io.EOF) || errors.Is(err, telemetrylog.ErrPartialBatch) {
+			// a partial record is an append in progress
+			return b.Rows(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range batch.Events {
+			b.Add(e)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package report
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+var (
+	roomRow        = regexp.MustCompile(`\((\d+), '(\w+)', NULL\)`)
+	sensorRow      = regexp.MustCompile(`\((\d+), (\d+), '(\w+)', '([VR])', NULL\)`)
+	measurementRow = regexp.MustCompile(`\((\d+), '([^']+)', ([\d.]+)\)`)
+)
+
+// loadFixtures reads the rooms, sensors and measurements inserted by sql/data.sql.
+func loadFixtures(t *testing.T) ([]Sensor, []domain.Telemetry) {
+	t.Helper()
+
+	data, err := os.ReadFile("../../../../sql/data.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rooms := make(map[string]string)
+	for _, m := range roomRow.FindAllStringSubmatch(string(data), -1) {
+		rooms[m[1]] = m[2]
+	}
+
+	var sensors []Sensor
+	names := make(map[string]string)
+	for _, m := range sensorRow.FindAllStringSubmatch(string(data), -1) {
+		sensorType, err := domain.NewSensorType(m[4])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sensors = append(sensors, Sensor{Name: m[3], Room: rooms[m[2]], Type: sensorType})
+		names[m[1]] = m[3]
+	}
+
+	var events []domain.Telemetry
+	for _, m := range measurementRow.FindAllStringSubmatch(string(data), -1) {
+		ts, err := time.Parse("2006-01-02 15:04:05.999-07", m[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := domain.NewTelemetry(names[m[1]], v, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+
+	if len(rooms) != 2 || len(sensors) != 8 || len(events) != 22 {
+		t.Fatalf("loaded %d rooms, %d sensors, %d measurements from sql/data.sql", len(rooms), len(sensors), len(events))
+	}
+	return sensors, events
+}
+
+func at(sec int) time.Time {
+	return time.Date(2026, 2, 6, 12, 0, sec, 0, time.UTC)
+}
+
+func TestRowsMatchReportSQL(t *testing.T) {
+	sensors, events := loadFixtures(t)
+
+	for _, tc := range []struct {
+		name   string
+		params Params
+		want   []Row
+	}{
+		{
+			// the parameters of sql/report.sql
+			name:   "report.sql",
+			params: Params{From: at(0).Add(-time.Hour), To: at(0).Add(time.Hour), Lookback: time.Hour},
+			want: []Row{
+				{Room: "room_A", Timestamp: at(0), V: 10.00, R: 5.10, I: 1.961},
+				{Room: "room_A", Timestamp: at(1), V: 11.00, R: 5.20, I: 2.115},
+				{Room: "room_A", Timestamp: at(2), V: 12.00, R: 5.20, I: 2.308},
+				{Room: "room_A", Timestamp: at(4), V: 12.50, R: 5.20, I: 2.404},
+				{Room: "room_A", Timestamp: at(10), V: 13.00, R: 5.20, I: 2.500},
+				{Room: "room_B", Timestamp: at(0), V: 21.00, R: 10.00, I: 2.100},
+				{Room: "room_B", Timestamp: at(2), V: 22.00, R: 10.00, I: 2.200},
+			},
+		},
+		{
+			name:   "R carried from the lookback",
+			params: Params{From: at(2), To: at(5), Lookback: time.Hour},
+			want: []Row{
+				{Room: "room_A", Timestamp: at(2), V: 12.00, R: 5.20, I: 2.308},
+				{Room: "room_A", Timestamp: at(4), V: 12.50, R: 5.20, I: 2.404},
+				{Room: "room_B", Timestamp: at(2), V: 22.00, R: 10.00, I: 2.200},
+			},
+		},
+		{
+			// R exists only in seconds without V
+			name:   "no lookback",
+			params: Params{From: at(2), To: at(5)},
+			want:   nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBuilder(sensors, tc.params)
+			for _, e := range events {
+				b.Add(e)
+			}
+
+			got := b.Rows()
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %d rows, want %d: %+v", len(got), len(tc.want), got)
+			}
+			for i := range tc.want {
+				if got[i] != tc.want[i] {
+					t.Fatalf("row %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRoundNumeric(t *testing.T) {
+	for _, tc := range []struct {
+		v      float64
+		places int
+		want   float64
+	}{
+		{v: 2.675, places: 2, want: 2.68}, // 2.67499999... as a float
+		{v: -2.675, places: 2, want: -2.68},
+		{v: 0.125, places: 2, want: 0.13}, // a tie
+		{v: 1.0005, places: 3, want: 1.001},
+		{v: 12.0 / 5.2, places: 3, want: 2.308},
+		{v: 7, places: 2, want: 7},
+	} {
+		if got := roundNumeric(tc.v, tc.places); got != tc.want {
+			t.Errorf("roundNumeric(%v, %d) = %v, want %v", tc.v, tc.places, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/kvoloboi/telemetry/cmd/sink/config"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+// RetentionWorker periodically deletes sealed WAL segments according to the retention config.
+// It runs next to TelemetryWorker and never touches the active segment, so appends are not blocked.
+type RetentionWorker struct {
+	dir    string
+	cfg    config.RetentionConfig
+	logger *slog.Logger
+
+	acked   atomic.Uint64
+	started atomic.Bool
+}
+
+// NewRetentionWorker constructs a worker for the log in dir. Start() must be called explicitly.
+func NewRetentionWorker(
+	dir string,
+	cfg config.RetentionConfig,
+	logger *slog.Logger,
+) *RetentionWorker {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &RetentionWorker{
+		dir:    dir,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Ack records that downstream consumers processed every batch with seq < next.
+// Acks never move backwards. They only delete segments with PruneExported set.
+func (w *RetentionWorker) Ack(next uint64) {
+	for {
+		cur := w.acked.Load()
+		if next <= cur || w.acked.CompareAndSwap(cur, next) {
+			return
+		}
+	}
+}
+
+// Start launches the pruning loop. Only the first call takes effect.
+func (w *RetentionWorker) Start(ctx context.Context) {
+	if w.started.Swap(true) {
+		return
+	}
+
+	go w.run(ctx)
+}
+
+func (w *RetentionWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.prune(now)
+		}
+	}
+}
+
+func (w *RetentionWorker) prune(now time.Time) {
+	policy := telemetrylog.RetentionPolicy{
+		MaxBytes: w.cfg.MaxBytes,
+		MaxAge:   w.cfg.MaxAge,
+	}
+	if w.cfg.PruneExported {
+		policy.MinSeq = w.acked.Load()
+	}
+
+	report, err := telemetrylog.Prune(w.dir, policy, now)
+
+	for _, s := range report.Segments {
+		w.logger.Info("pruned telemetry segment",
+			"path", s.Path,
+			"first_seq", s.FirstSeq,
+			"next_seq", s.NextSeq,
+			"bytes", s.Bytes,
+			"reason", s.Reason,
+		)
+	}
+
+	if err != nil {
+		w.logger.Error("telemetry log pruning failed", "err", err)
+		return
+	}
+
+	if len(report.Segments) > 0 {
+		w.logger.Info("telemetry log pruned",
+			"segments", len(report.Segments),
+			"bytes", report.Bytes(),
+		)
+	}
+}
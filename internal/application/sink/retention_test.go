@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/cmd/sink/config"
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+func TestRetentionPrunesAckedSegmentsOnlyWhenAsked(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		pruneExported bool
+		wantSegments  int
+	}{
+		{name: "keep exported", pruneExported: false, wantSegments: 4},
+		{name: "prune exported", pruneExported: true, wantSegments: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			wal, err := telemetrylog.Open(dir, &telemetrylog.Config{SegmentMaxBytes: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer wal.Close()
+
+			// every batch gets a segment of its own
+			for i := range 4 {
+				event, err := domain.NewTelemetry("temp", float64(i), time.Now())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := wal.Append([]domain.Telemetry{event}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			w := NewRetentionWorker(dir, config.RetentionConfig{
+				CheckInterval: time.Minute,
+				PruneExported: tc.pruneExported,
+			}, nil)
+			w.Ack(4)
+			w.prune(time.Now())
+
+			segments, err := telemetrylog.InspectSegments(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(segments) != tc.wantSegments {
+				t.Fatalf("%d segments left, want %d", len(segments), tc.wantSegments)
+			}
+		})
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"time"
 
 	"github.com/kvoloboi/telemetry/cmd/sink/config"
-	"github.com/kvoloboi/telemetry/internal/application/sink/telemetrylog"
 	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/metrics"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
 )
 
 // TelemetryWorker batches telemetry and writes to a TelemetryLog.
-// It is safe for single Start() call. Shutdown is triggered via context cancellation.
+// It is safe for single Start() call. It stops once the input channel is closed
+// and drained; context cancellation only flushes the pending batch early.
+// After a failed append it stops writing, but keeps draining its input and
+// fails every item, so no caller waits for an append that never comes.
 type TelemetryWorker struct {
 	in     <-chan TelemetryItem
 	wal    *telemetrylog.TelemetryLog
@@ -20,6 +24,12 @@ type TelemetryWorker struct {
 	logger *slog.Logger
 
 	started atomic.Bool
+	failed  atomic.Bool
+	done    chan struct{}
+
+	batchEvents *metrics.Histogram
+	batchBytes  *metrics.Histogram
+	flushes     *metrics.Histogram // seconds per log append
 }
 
 // NewTelemetryWorker constructs a worker. Start() must be called explicitly.
@@ -38,51 +48,116 @@ func NewTelemetryWorker(
 		wal:    log,
 		cfg:    cfg,
 		logger: logger,
+		done:   make(chan struct{}),
+
+		batchEvents: metrics.NewHistogram(metrics.ExponentialBuckets(1, 4, 8)),
+		batchBytes:  metrics.NewHistogram(metrics.ExponentialBuckets(256, 4, 8)),
+		flushes:     metrics.NewHistogram(metrics.DurationBuckets),
 	}
 }
 
+// RegisterMetrics exposes batch sizes and flush durations. Call it before Start.
+func (w *TelemetryWorker) RegisterMetrics(reg *metrics.Registry) {
+	reg.Register("telemetry_sink_batch_events", "Events per batch appended to the log.", w.batchEvents)
+	reg.Register("telemetry_sink_batch_bytes", "Encoded message bytes per batch appended to the log.", w.batchBytes)
+	reg.Register("telemetry_sink_flush_duration_seconds", "Time to append a batch to the log.", w.flushes)
+}
+
 // Start launches the worker loop. Only the first call takes effect.
 func (w *TelemetryWorker) Start(ctx context.Context) {
 	if w.started.Swap(true) {
 		return
 	}
 
-	go w.run(ctx)
+	go func() {
+		defer close(w.done)
+		if err := w.run(ctx); err != nil {
+			w.failed.Store(true)
+			w.refuse(err)
+		}
+	}()
+}
+
+// Running reports whether the worker was started and has not stopped yet.
+// It stops after a failed append, or once its input is drained.
+func (w *TelemetryWorker) Running() bool {
+	if !w.started.Load() || w.failed.Load() {
+		return false
+	}
+	select {
+	case <-w.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Done is closed when the worker has written, or failed, everything it received.
+func (w *TelemetryWorker) Done() <-chan struct{} {
+	return w.done
+}
+
+// pendingBatch is the batch being accumulated by the worker.
+type pendingBatch struct {
+	events   []domain.Telemetry
+	appended []func(uint64, error)
+	marks    map[telemetrylog.MarkKey]uint64 // highest seq per sensor of a node
+	meta     map[string]domain.SensorMeta    // registry metadata per sensor
+	size     int
 }
 
 // run batches telemetry and flushes on count, size, or timer.
 func (w *TelemetryWorker) run(ctx context.Context) error {
 	var (
-		batch     []domain.Telemetry
-		batchSize int
-		timer     = time.NewTimer(w.cfg.FlushInterval)
+		batch = pendingBatch{
+			marks: make(map[telemetrylog.MarkKey]uint64),
+			meta:  make(map[string]domain.SensorMeta),
+		}
+		timer = time.NewTimer(w.cfg.FlushInterval)
+		stop  = ctx.Done()
 	)
 
 	defer timer.Stop()
+	defer w.logStats()
 
 	for {
 		select {
-		case <-ctx.Done():
-			return w.flush(&batch, &batchSize)
+		case <-stop:
+			// keep draining until the ingestor closes the channel,
+			// servers still wait for the items they handed over
+			stop = nil
+			if err := w.flush(&batch); err != nil {
+				return err
+			}
 
 		case item, ok := <-w.in:
 			if !ok {
-				return w.flush(&batch, &batchSize)
+				return w.flush(&batch)
 			}
 
-			batch = append(batch, *item.Msg)
-			batchSize += item.Size
+			batch.events = append(batch.events, *item.Msg)
+			if item.Appended != nil {
+				batch.appended = append(batch.appended, item.Appended)
+			}
+			if o := item.Origin; o != nil {
+				key := telemetrylog.MarkKey{Node: o.Node.String(), Sensor: item.Msg.Sensor.String()}
+				batch.marks[key] = max(batch.marks[key], o.Seq)
+			}
+			if item.Meta != nil {
+				batch.meta[item.Msg.Sensor.String()] = *item.Meta
+			}
+			batch.size += item.Size
 
-			if len(batch) >= w.cfg.MaxCount ||
-				batchSize >= w.cfg.MaxBytes {
-				if err := w.flush(&batch, &batchSize); err != nil {
+			if len(batch.events) >= w.cfg.MaxCount ||
+				batch.size >= w.cfg.MaxBytes {
+				if err := w.flush(&batch); err != nil {
 					return err
 				}
 				w.resetTimer(timer)
 			}
 
 		case <-timer.C:
-			if err := w.flush(&batch, &batchSize); err != nil {
+			if err := w.flush(&batch); err != nil {
 				return err
 			}
 			w.resetTimer(timer)
@@ -90,29 +165,83 @@ func (w *TelemetryWorker) run(ctx context.Context) error {
 	}
 }
 
-func (w *TelemetryWorker) flush(batch *[]domain.Telemetry, batchSize *int) error {
-	if len(*batch) == 0 {
+func (w *TelemetryWorker) flush(batch *pendingBatch) error {
+	if len(batch.events) == 0 {
 		return nil
 	}
 
-	w.logger.Info("flushign telemetry batch", "len", len(*batch))
+	w.logger.Debug("flushing telemetry batch", "len", len(batch.events))
+
+	before := w.wal.Stats()
+
+	marks := make([]telemetrylog.Mark, 0, len(batch.marks))
+	for key, seq := range batch.marks {
+		marks = append(marks, telemetrylog.Mark{Node: key.Node, Sensor: key.Sensor, Seq: seq})
+	}
 
 	// Write the batch to the log
-	if err := w.wal.Append(*batch); err != nil {
+	start := time.Now()
+	seq, err := w.wal.AppendAnnotated(batch.events, telemetrylog.Annotations{Marks: marks, Meta: batch.meta})
+	w.flushes.ObserveSince(start)
+	for _, fn := range batch.appended {
+		fn(seq, err)
+	}
+	if err != nil {
 		w.logger.Error("failed to flush telemetry batch", "err", err)
 		return err
 	}
+	w.batchEvents.Observe(float64(len(batch.events)))
+	w.batchBytes.Observe(float64(batch.size))
+
+	written := w.wal.Stats()
+	batchStats := telemetrylog.Stats{
+		RawBytes:    written.RawBytes - before.RawBytes,
+		StoredBytes: written.StoredBytes - before.StoredBytes,
+	}
+	w.logger.Debug("telemetry batch written",
+		"raw_bytes", batchStats.RawBytes,
+		"stored_bytes", batchStats.StoredBytes,
+		"compression_ratio", batchStats.Ratio(),
+	)
 
 	// Clear slice contents but keep allocated capacity to avoid GC churn
-	for i := range *batch {
-		(*batch)[i] = domain.Telemetry{}
+	for i := range batch.events {
+		batch.events[i] = domain.Telemetry{}
+	}
+	for i := range batch.appended {
+		batch.appended[i] = nil
 	}
-	*batch = (*batch)[:0]
-	*batchSize = 0
+	batch.events = batch.events[:0]
+	batch.appended = batch.appended[:0]
+	clear(batch.marks)
+	clear(batch.meta)
+	batch.size = 0
 
 	return nil
 }
 
+// refuse fails every item left in the input with err until the ingestor
+// closes it.
+func (w *TelemetryWorker) refuse(err error) {
+	w.logger.Error("telemetry worker stopped, failing queued telemetry", "err", err)
+
+	for item := range w.in {
+		if item.Appended != nil {
+			item.Appended(0, err)
+		}
+	}
+}
+
+// logStats reports the compression achieved over the worker lifetime.
+func (w *TelemetryWorker) logStats() {
+	stats := w.wal.Stats()
+	w.logger.Info("telemetry log stats",
+		"raw_bytes", stats.RawBytes,
+		"stored_bytes", stats.StoredBytes,
+		"compression_ratio", stats.Ratio(),
+	)
+}
+
 func (w *TelemetryWorker) resetTimer(timer *time.Timer) {
 	if !timer.Stop() {
 		select {
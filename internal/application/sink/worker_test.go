@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/cmd/sink/config"
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/telemetrylog"
+)
+
+func TestWorkerFailsItemsAfterFailedAppend(t *testing.T) {
+	wal, err := telemetrylog.Open(t.TempDir(), &telemetrylog.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every append fails from now on
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	in := make(chan TelemetryItem)
+	w := NewTelemetryWorker(in, wal, config.BatchConfig{
+		MaxCount:      1,
+		MaxBytes:      1 << 20,
+		FlushInterval: time.Hour,
+	}, nil)
+	w.Start(context.Background())
+
+	results := make(chan error, 3)
+	for i := range 3 {
+		event, err := domain.NewTelemetry("temp", float64(i), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case in <- TelemetryItem{
+			Msg:      &event,
+			Appended: func(_ uint64, err error) { results <- err },
+		}:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("worker stopped taking items after %d", i)
+		}
+
+		select {
+		case err := <-results:
+			if !errors.Is(err, telemetrylog.ErrLogClosed) {
+				t.Fatalf("item %d appended with %v, want %v", i, err, telemetrylog.ErrLogClosed)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("item %d never answered", i)
+		}
+	}
+
+	if w.Running() {
+		t.Fatal("worker reported running after a failed append")
+	}
+
+	close(in)
+	select {
+	case <-w.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker not done once its input was closed")
+	}
+}
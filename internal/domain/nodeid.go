@@ -0,0 +1,29 @@
+package domain
+
+import "errors"
+
+// NodeID is the stable identity a node sends its sequenced telemetry under.
+type NodeID struct {
+	id string
+}
+
+const MaxNodeIDLen = 255
+
+var (
+	ErrNodeIDTooLong = errors.New("node id too long")
+	ErrNodeIDEmpty   = errors.New("node id cannot be empty")
+)
+
+func NewNodeID(id string) (NodeID, error) {
+	if len(id) == 0 {
+		return NodeID{}, ErrNodeIDEmpty
+	}
+	if len(id) > MaxNodeIDLen {
+		return NodeID{}, ErrNodeIDTooLong
+	}
+	return NodeID{id: id}, nil
+}
+
+func (n NodeID) String() string {
+	return n.id
+}
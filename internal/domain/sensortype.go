@@ -0,0 +1,28 @@
+package domain
+
+import "errors"
+
+// SensorType is the quantity a sensor measures, as in the sensor_type enum of sql/schema.sql.
+type SensorType string
+
+const (
+	SensorTypeVoltage    SensorType = "V"
+	SensorTypeResistance SensorType = "R"
+)
+
+var ErrUnknownSensorType = errors.New("unknown sensor type")
+
+func NewSensorType(t string) (SensorType, error) {
+	switch SensorType(t) {
+	case SensorTypeVoltage, SensorTypeResistance:
+		return SensorType(t), nil
+	default:
+		return "", ErrUnknownSensorType
+	}
+}
+
+// SensorMeta is what the sink knows about a registered sensor.
+type SensorMeta struct {
+	Room string
+	Type SensorType
+}
@@ -6,6 +6,7 @@ type Telemetry struct {
 	Sensor    SensorName
 	Value     Value
 	Timestamp Timestamp
+	Seq       uint64 // node sequence number, 0 if the node did not number the reading
 }
 
 func NewTelemetry(sensor string, value float64, ts time.Time) (Telemetry, error) {
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Health decides readiness from named checks. A check returns why
+// the process cannot take traffic, or nil.
+type Health struct {
+	mu     sync.Mutex
+	checks []healthCheck
+}
+
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+func NewHealth() *Health {
+	return &Health{}
+}
+
+// Add registers a readiness check.
+func (h *Health) Add(name string, check func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, healthCheck{name: name, check: check})
+}
+
+// Failing runs every check and returns the errors of those that fail, by name.
+func (h *Health) Failing() map[string]string {
+	h.mu.Lock()
+	checks := h.checks
+	h.mu.Unlock()
+
+	failing := make(map[string]string)
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			failing[c.name] = err.Error()
+		}
+	}
+	return failing
+}
+
+type readyJSON struct {
+	Ready   bool              `json:"ready"`
+	Failing map[string]string `json:"failing,omitempty"`
+}
+
+// RegisterHealth exposes liveness and readiness:
+//
+//	GET /healthz   the process is up
+//	GET /readyz    every readiness check passes, 503 otherwise
+func RegisterHealth(s *Server, h *Health) {
+	s.Handle("GET /healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}))
+
+	s.Handle("GET /readyz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing := h.Failing()
+		if len(failing) > 0 {
+			writeJSON(w, http.StatusServiceUnavailable, readyJSON{Failing: failing})
+			return
+		}
+		writeJSON(w, http.StatusOK, readyJSON{Ready: true})
+	}))
+}
@@ -0,0 +1,16 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+)
+
+// RegisterIngest exposes the ingest queue:
+//
+//	GET /ingest   queue fill, overload policy and refused telemetry
+func RegisterIngest(s *Server, ingestor *sink.ChannelIngestor) {
+	s.Handle("GET /ingest", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ingestor.Stats())
+	}))
+}
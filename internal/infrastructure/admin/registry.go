@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink/registry"
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+type sensorRequest struct {
+	Room string `json:"room"`
+	Type string `json:"type"`
+}
+
+// errRegistryReadOnly answers registry changes unless they are enabled.
+var errRegistryReadOnly = errors.New("registry changes are disabled, see -admin.registry-writes")
+
+// RegisterRegistry exposes the sensor registry:
+//
+//	GET    /registry                  rooms and sensors
+//	GET    /registry/rejections       rejected telemetry per reason
+//	POST   /registry/reload           re-read the registry file
+//	PUT    /registry/rooms/{name}     create or restore a room
+//	DELETE /registry/rooms/{name}     soft-delete a room
+//	PUT    /registry/sensors/{name}   create, move or restore a sensor: {"room": "...", "type": "V"}
+//	DELETE /registry/sensors/{name}   soft-delete a sensor
+//
+// The admin listener has no authentication, so unless writable is set the
+// PUT and DELETE endpoints answer 403 and the registry changes only through its file.
+func RegisterRegistry(s *Server, reg *registry.Registry, ingestor *registry.RegisteredIngestor, writable bool) {
+	s.Handle("GET /registry", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, reg.Snapshot())
+	}))
+
+	s.Handle("GET /registry/rejections", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ingestor.Rejections())
+	}))
+
+	s.Handle("POST /registry/reload", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		changed, err := reg.Reload()
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"changed": changed})
+	}))
+
+	if !writable {
+		forbidden := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusForbidden, errRegistryReadOnly)
+		})
+		s.Handle("PUT /registry/", forbidden)
+		s.Handle("DELETE /registry/", forbidden)
+		return
+	}
+
+	s.Handle("PUT /registry/rooms/{name}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		room, err := reg.PutRoom(r.PathValue("name"))
+		if err != nil {
+			writeRegistryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, room)
+	}))
+
+	s.Handle("DELETE /registry/rooms/{name}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := reg.DeleteRoom(r.PathValue("name")); err != nil {
+			writeRegistryError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	s.Handle("PUT /registry/sensors/{name}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req sensorRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		name := r.PathValue("name")
+		if _, err := domain.NewSensorName(name); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sensorType, err := domain.NewSensorType(req.Type)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		sensor, err := reg.PutSensor(name, req.Room, sensorType)
+		if err != nil {
+			writeRegistryError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sensor)
+	}))
+
+	s.Handle("DELETE /registry/sensors/{name}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := reg.DeleteSensor(r.PathValue("name")); err != nil {
+			writeRegistryError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func writeRegistryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, registry.ErrUnknownRoom), errors.Is(err, registry.ErrUnknownSensor):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink/registry"
+)
+
+func TestRegistryChangesNeedWritable(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		writable bool
+		want     int
+	}{
+		{name: "read only", writable: false, want: http.StatusForbidden},
+		{name: "writable", writable: true, want: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "registry.json")
+			if err := os.WriteFile(path, []byte(`{"rooms": [], "sensors": []}`), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			reg, err := registry.Open(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := NewServer("127.0.0.1:0", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.lis.Close()
+			RegisterRegistry(s, reg, registry.NewRegisteredIngestor(nil, reg, nil), tc.writable)
+
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/registry/rooms/room_A", nil))
+			if rec.Code != tc.want {
+				t.Fatalf("PUT answered %d, want %d", rec.Code, tc.want)
+			}
+
+			rec = httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/registry", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET answered %d", rec.Code)
+			}
+			if got := strings.Contains(rec.Body.String(), "room_A"); got != tc.writable {
+				t.Fatalf("room created = %v: %s", got, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kvoloboi/telemetry/internal/application/sink/exporter"
+)
+
+// MeasurementStore writes exported telemetry into the measurements table.
+// The export checkpoint is kept in export_checkpoints under the store name,
+// so several independent exporters may feed the same database.
+type MeasurementStore struct {
+	pool *pgxpool.Pool
+	name string
+}
+
+// NewMeasurementStore connects to dsn and makes sure the checkpoint row for name exists.
+func NewMeasurementStore(ctx context.Context, dsn, name string) (*MeasurementStore, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connect postgres: %w", err)
+	}
+
+	_, err = pool.Exec(ctx,
+		`INSERT INTO export_checkpoints (name, next_seq) VALUES ($1, 0)
+		 ON CONFLICT (name) DO NOTHING`,
+		name,
+	)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("init export checkpoint: %w", err)
+	}
+
+	return &MeasurementStore{pool: pool, name: name}, nil
+}
+
+func (s *MeasurementStore) Checkpoint(ctx context.Context) (uint64, error) {
+	var next int64
+	err := s.pool.QueryRow(ctx,
+		`SELECT next_seq FROM export_checkpoints WHERE name = $1`,
+		s.name,
+	).Scan(&next)
+	if err != nil {
+		return 0, fmt.Errorf("read export checkpoint: %w", err)
+	}
+
+	return uint64(next), nil
+}
+
+func (s *MeasurementStore) Write(ctx context.Context, seq uint64, rows []exporter.Measurement) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// the row lock serializes exporters sharing a name
+	var next int64
+	err = tx.QueryRow(ctx,
+		`SELECT next_seq FROM export_checkpoints WHERE name = $1 FOR UPDATE`,
+		s.name,
+	).Scan(&next)
+	if err != nil {
+		return fmt.Errorf("lock export checkpoint: %w", err)
+	}
+	if seq < uint64(next) {
+		// already exported before a restart
+		return nil
+	}
+	if seq > uint64(next) {
+		return fmt.Errorf("%w: batch %d, checkpoint %d", exporter.ErrExportGap, seq, next)
+	}
+
+	if len(rows) > 0 {
+		_, err = tx.CopyFrom(ctx,
+			pgx.Identifier{"measurements"},
+			[]string{"sensor_id", "measured_at", "value"},
+			pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+				r := rows[i]
+				return []any{r.SensorID, r.MeasuredAt, r.Value}, nil
+			}),
+		)
+		if err != nil {
+			return fmt.Errorf("copy measurements: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE export_checkpoints SET next_seq = $2 WHERE name = $1`,
+		s.name, int64(seq+1),
+	)
+	if err != nil {
+		return fmt.Errorf("update export checkpoint: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *MeasurementStore) Skip(ctx context.Context, seq uint64) error {
+	_, err := s.pool.Exec(ctx,
+		`UPDATE export_checkpoints SET next_seq = $2 WHERE name = $1 AND next_seq < $2`,
+		s.name, int64(seq),
+	)
+	if err != nil {
+		return fmt.Errorf("skip export checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *MeasurementStore) LookupSensor(ctx context.Context, name string) (int64, error) {
+	var (
+		id      int64
+		deleted bool
+	)
+	err := s.pool.QueryRow(ctx,
+		`SELECT s.id, s.deleted_at IS NOT NULL OR r.deleted_at IS NOT NULL
+		 FROM sensors s
+		 JOIN rooms r ON r.id = s.room_id
+		 WHERE s.name = $1`,
+		name,
+	).Scan(&id, &deleted)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return 0, exporter.ErrUnknownSensor
+	case err != nil:
+		return 0, fmt.Errorf("lookup sensor: %w", err)
+	case deleted:
+		return 0, exporter.ErrDeletedSensor
+	}
+
+	return id, nil
+}
+
+func (s *MeasurementStore) LookupRoom(ctx context.Context, name string) (int64, error) {
+	// room names are not unique, the oldest active room wins
+	var id int64
+	err := s.pool.QueryRow(ctx,
+		`SELECT id FROM rooms WHERE name = $1 AND deleted_at IS NULL ORDER BY id LIMIT 1`,
+		name,
+	).Scan(&id)
+
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return 0, exporter.ErrUnknownRoom
+	case err != nil:
+		return 0, fmt.Errorf("lookup room: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *MeasurementStore) CreateSensor(ctx context.Context, name string, roomID int64, sensorType string) (int64, error) {
+	var id int64
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO sensors (room_id, name, type) VALUES ($1, $2, $3)
+		 ON CONFLICT (name) DO NOTHING
+		 RETURNING id`,
+		roomID, name, sensorType,
+	).Scan(&id)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		// created concurrently by another exporter
+		return s.LookupSensor(ctx, name)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("create sensor: %w", err)
+	}
+
+	return id, nil
+}
+
+func (s *MeasurementStore) Close() error {
+	s.pool.Close()
+	return nil
+}
@@ -10,14 +10,17 @@ type SenderConfig struct {
 	MaxReconnectAttempts    int
 	Backoff                 common.Backoff
 	CloseOnServerDisconnect bool
-	Buffer                  int
+	Buffer                  int           // max readings awaiting an ack; Enqueue waits beyond it
+	CloseTimeout            time.Duration // how long Close waits for outstanding acks
+	NodeID                  string        // sent with every reading for the sink to drop duplicates; empty sends none
 }
 
-func defaultSenderConfig() SenderConfig {
+func DefaultSenderConfig() SenderConfig {
 	return SenderConfig{
 		MaxReconnectAttempts:    5,
 		Backoff:                 common.NewBackoff(100*time.Millisecond, 5*time.Second),
 		CloseOnServerDisconnect: false,
-		Buffer:                  100,
+		Buffer:                  1000,
+		CloseTimeout:            10 * time.Second,
 	}
 }
@@ -1,39 +1,66 @@
 package transportgrpc
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"io"
 	"log/slog"
+	"slices"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	pb "github.com/kvoloboi/telemetry/api/telemetry/v1"
-	"github.com/kvoloboi/telemetry/internal/application/common"
+	"github.com/kvoloboi/telemetry/internal/application/node"
 	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/metrics"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var (
-	ErrStreamingQueueFull = errors.New("streaming queue full")
+	errStreamEnded = errors.New("sink ended the stream")
+	// errResequence ends a stream that cannot carry an unacked reading in order
+	errResequence = errors.New("reading numbered below the stream")
 )
 
+type pendingMessage struct {
+	seq    uint64
+	msg    *pb.Telemetry
+	done   func(error)
+	stream uint64 // the stream the reading was last sent on, 0 if none
+}
+
+// TelemetryGrpcSender streams readings over SyncTelemetry. Every reading is sent
+// under its node sequence number, or one above the highest so far if it has none,
+// and is kept until the sink acks it, so readings that were in flight when a stream
+// broke are sent again on the next one. The numbers of a stream must increase:
+// a reading numbered below one the stream already carried, such as one the node
+// spilled and hands back, makes the sender finish the stream and send everything
+// unacked in order on a new one.
+// With a node id the sink drops the readings it already logged, so a reading
+// sent again under its number, even after a restart, is delivered once.
 type TelemetryGrpcSender struct {
 	conn   *grpc.ClientConn
 	logger *slog.Logger
-	queue  chan domain.Telemetry
+	cfg    SenderConfig
+
+	mu      sync.Mutex
+	unacked []pendingMessage // in seq order
+	nextSeq uint64           // highest seq enqueued
+	streams uint64           // streams opened so far, numbering them from 1
+	window  int              // how many unacked readings may be in flight
+	changed chan struct{}    // closed when readings are acked
+	closed  bool
+
+	wake chan struct{}
 
 	ctx    context.Context
 	cancel context.CancelFunc
 	done   chan struct{}
 
-	backoff common.Backoff
-
-	maxReconnectAttempts    int
-	closeOnServerDisconnect bool
-
-	closed atomic.Bool
+	stopped atomic.Bool
 }
 
 func NewTelemetryGrpcSender(
@@ -43,25 +70,23 @@ func NewTelemetryGrpcSender(
 		logger = slog.Default()
 	}
 
-	cfg := defaultSenderConfig()
+	cfg := DefaultSenderConfig()
 	if config != nil {
 		cfg = *config
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 
 	sender := &TelemetryGrpcSender{
-		conn:   conn,
-		logger: logger,
-
-		queue: make(chan domain.Telemetry, cfg.Buffer),
-
-		ctx:     ctx,
-		cancel:  cancel,
-		done:    make(chan struct{}),
-		backoff: cfg.Backoff,
-
-		maxReconnectAttempts:    cfg.MaxReconnectAttempts,
-		closeOnServerDisconnect: cfg.CloseOnServerDisconnect,
+		conn:    conn,
+		logger:  logger,
+		cfg:     cfg,
+		window:  cfg.Buffer,
+		changed: make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
 	}
 
 	go sender.run()
@@ -69,86 +94,179 @@ func NewTelemetryGrpcSender(
 	return sender, nil
 }
 
+// Send enqueues msg and waits until the sink acked it.
 func (s *TelemetryGrpcSender) Send(ctx context.Context, msg domain.Telemetry) error {
-	if s.closed.Load() {
-		return io.ErrClosedPipe
+	result := make(chan error, 1)
+	if err := s.Enqueue(ctx, msg, func(err error) { result <- err }); err != nil {
+		return err
 	}
 
 	select {
-	case s.queue <- msg:
-		return nil
+	case err := <-result:
+		return err
 	case <-ctx.Done():
 		return ctx.Err()
-	case <-s.ctx.Done():
-		return io.ErrClosedPipe
-	default:
-		// optional: backpressure policy
-		return ErrStreamingQueueFull
 	}
 }
 
-// Close implements io.Closer
+func (s *TelemetryGrpcSender) Enqueue(ctx context.Context, t domain.Telemetry, done func(error)) error {
+	msg := &pb.Telemetry{
+		Sensor:    t.Sensor.String(),
+		Value:     t.Value.Float64(),
+		Timestamp: timestamppb.New(t.Timestamp.Time()),
+	}
+
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return io.ErrClosedPipe
+		}
+		if len(s.unacked) < s.cfg.Buffer {
+			break
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	seq := t.Seq
+	if seq == 0 {
+		seq = s.nextSeq + 1
+	}
+	s.nextSeq = max(s.nextSeq, seq)
+
+	i, _ := slices.BinarySearchFunc(s.unacked, seq, func(m pendingMessage, seq uint64) int {
+		return cmp.Compare(m.seq, seq)
+	})
+	s.unacked = slices.Insert(s.unacked, i, pendingMessage{seq: seq, msg: msg, done: done})
+	s.mu.Unlock()
+
+	s.notify()
+	return nil
+}
+
+// Flush waits until every enqueued reading is acked or failed.
+func (s *TelemetryGrpcSender) Flush(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if len(s.unacked) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close stops accepting readings and waits up to CloseTimeout for outstanding acks.
+// Readings still unacked after that fail with io.ErrClosedPipe.
 func (s *TelemetryGrpcSender) Close() error {
-	if s.closed.Swap(true) {
+	if s.stopped.Swap(true) {
 		return nil
 	}
 
-	// 1. Stop accepting new messages
-	close(s.queue)
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
 
-	// 2. Wait for sender to flush + CloseAndRecv
-	<-s.done
+	s.notify()
+
+	select {
+	case <-s.done:
+	case <-time.After(s.cfg.CloseTimeout):
+		s.logger.Warn("timed out waiting for acks, closing stream")
+	}
 
 	s.cancel()
+	<-s.done
 
 	return s.conn.Close()
 }
 
+func (s *TelemetryGrpcSender) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
 func (s *TelemetryGrpcSender) run() {
 	defer close(s.done)
 
 	for {
 		stream, err := s.openWithRetry()
-
 		if err != nil {
 			s.logger.Error("cannot open stream, shutting down sender", "err", err)
 
 			// stop accepting new messages and propagate shutdown
-			_ = s.Close()
+			s.fail(io.ErrClosedPipe)
+			return
 		}
 
-		err = s.sendLoop(stream)
-
+		err = s.sync(stream)
 		if err == nil {
 			return
 		}
+		if errors.Is(err, errResequence) {
+			s.logger.Debug("stream finished to send a reading numbered below it")
+			continue
+		}
 		s.logger.Warn("stream failed", "err", err)
 
-		if s.closeOnServerDisconnect {
+		if s.cfg.CloseOnServerDisconnect {
 			s.logger.Warn("closeOnServerDisconnect enabled, stopping sender")
+			s.fail(io.ErrClosedPipe)
 			return
 		}
+
+		// an overloaded sink asks to come back later instead of right away,
+		// and gets fewer readings in flight until acks show it keeps up
+		if delay, ok := retryDelay(err); ok {
+			s.mu.Lock()
+			s.window = max(s.window/2, 1)
+			window := s.window
+			s.mu.Unlock()
+
+			s.logger.Warn("sink overloaded, slowing down", "retry_after", delay, "window", window)
+			select {
+			case <-time.After(delay):
+			case <-s.ctx.Done():
+			}
+		}
 	}
 }
+
 func (s *TelemetryGrpcSender) openWithRetry() (
-	pb.TelemetrySink_StreamTelemetryClient,
+	pb.TelemetrySink_SyncTelemetryClient,
 	error,
 ) {
 	attempt := 1
 	client := pb.NewTelemetrySinkClient(s.conn)
 
 	for {
-		stream, err := client.StreamTelemetry(s.ctx)
+		stream, err := client.SyncTelemetry(s.ctx)
 		if err == nil {
 			s.logger.Info("gRPC stream established")
 			return stream, nil
 		}
 
-		if attempt > s.maxReconnectAttempts {
+		if attempt > s.cfg.MaxReconnectAttempts {
 			return nil, io.ErrClosedPipe
 		}
 
-		delay := s.backoff.Next(attempt)
+		delay := s.cfg.Backoff.Next(attempt)
 
 		s.logger.Warn(
 			"failed to open gRPC stream",
@@ -167,42 +285,152 @@ func (s *TelemetryGrpcSender) openWithRetry() (
 	}
 }
 
-func (s *TelemetryGrpcSender) closeStream(
-	stream pb.TelemetrySink_StreamTelemetryClient,
-) error {
-	if stream == nil {
-		return nil
-	}
-
-	if _, err := stream.CloseAndRecv(); err != nil {
-		s.logger.Warn("CloseAndRecv failed", "err", err)
-	}
+// sync sends the unacked readings within the window on stream, starting with those
+// a previous stream left unacked. It returns nil once the sender is closed and all acked,
+// and errResequence once the stream is finished because it cannot carry an unacked reading.
+func (s *TelemetryGrpcSender) sync(stream pb.TelemetrySink_SyncTelemetryClient) error {
+	s.mu.Lock()
+	s.streams++
+	id := s.streams
+	s.mu.Unlock()
 
-	return nil
-}
+	acks := make(chan error, 1)
+	go func() {
+		acks <- s.recvAcks(stream, id)
+	}()
 
-func (s *TelemetryGrpcSender) sendLoop(
-	stream pb.TelemetrySink_StreamTelemetryClient,
-) error {
-	defer s.closeStream(stream)
+	var sent uint64 // highest seq sent on this stream
 
 	for {
-		select {
-		case msg, ok := <-s.queue:
-			if !ok {
-				return nil
+		s.mu.Lock()
+		finished := s.closed && len(s.unacked) == 0
+		i, _ := slices.BinarySearchFunc(s.unacked, sent+1, func(m pendingMessage, seq uint64) int {
+			return cmp.Compare(m.seq, seq)
+		})
+		behind := slices.ContainsFunc(s.unacked[:i], func(m pendingMessage) bool { return m.stream != id })
+		var batch []pendingMessage
+		if !behind {
+			end := max(i, min(s.window, len(s.unacked)))
+			for k := i; k < end; k++ {
+				s.unacked[k].stream = id
 			}
+			batch = slices.Clone(s.unacked[i:end])
+		}
+		s.mu.Unlock()
 
-			if err := stream.Send(&pb.Telemetry{
-				Sensor:    msg.Sensor.String(),
-				Value:     msg.Value.Float64(),
-				Timestamp: timestamppb.New(msg.Timestamp.Time()),
-			}); err != nil {
+		if finished || behind {
+			// the sink acks everything it received before it ends the stream
+			if err := stream.CloseSend(); err != nil {
+				return err
+			}
+			if err := <-acks; err != nil || finished {
 				return err
 			}
+			return errResequence
+		}
 
-		case <-s.ctx.Done():
+		for _, m := range batch {
+			err := stream.Send(&pb.SequencedTelemetry{Seq: m.seq, Telemetry: m.msg, NodeId: s.cfg.NodeID})
+			if err == io.EOF {
+				// the stream is gone, Recv tells why
+				return streamError(<-acks)
+			}
+			if err != nil {
+				return err
+			}
+			sent = m.seq
+		}
+
+		select {
+		case <-s.wake:
+		case err := <-acks:
+			return streamError(err)
+		}
+	}
+}
+
+// recvAcks completes readings as acks of stream id arrive. It returns nil when the sink ends the stream.
+func (s *TelemetryGrpcSender) recvAcks(stream pb.TelemetrySink_SyncTelemetryClient, id uint64) error {
+	for {
+		ack, err := stream.Recv()
+		if err == io.EOF {
 			return nil
 		}
+		if err != nil {
+			return err
+		}
+
+		s.acked(ack, id)
+		s.notify()
+	}
+}
+
+// acked completes every reading up to ack.Seq that was sent on stream id.
+func (s *TelemetryGrpcSender) acked(ack *pb.TelemetryAck, id uint64) {
+	s.mu.Lock()
+	var completed []pendingMessage
+	s.unacked = slices.DeleteFunc(s.unacked, func(m pendingMessage) bool {
+		if m.stream != id || m.seq > ack.GetSeq() {
+			return false
+		}
+		completed = append(completed, m)
+		return true
+	})
+	s.window = min(s.window+len(completed), s.cfg.Buffer)
+	s.broadcast()
+	s.mu.Unlock()
+
+	rejected := ack.GetRejected()
+	for _, m := range completed {
+		if slices.Contains(rejected, m.seq) {
+			m.done(node.ErrRejected)
+			continue
+		}
+		m.done(nil)
+	}
+}
+
+// fail stops the sender and completes every unacked reading with err.
+func (s *TelemetryGrpcSender) fail(err error) {
+	s.mu.Lock()
+	s.closed = true
+	failed := s.unacked
+	s.unacked = nil
+	s.broadcast()
+	s.mu.Unlock()
+
+	for _, m := range failed {
+		m.done(err)
+	}
+}
+
+// RegisterMetrics exposes the readings awaiting an ack and the send window,
+// labelled with labels to tell apart the senders of one node.
+func (s *TelemetryGrpcSender) RegisterMetrics(reg *metrics.Registry, labels ...string) {
+	reg.Register("telemetry_node_unacked", "Readings sent or queued but not acked by the sink.",
+		metrics.GaugeFunc(func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return float64(len(s.unacked))
+		}), labels...)
+	reg.Register("telemetry_node_send_window", "Readings allowed in flight before the sink acks them.",
+		metrics.GaugeFunc(func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return float64(s.window)
+		}), labels...)
+}
+
+// broadcast wakes everyone waiting on s.changed. s.mu must be held.
+func (s *TelemetryGrpcSender) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// streamError turns a stream the sink ended early into an error.
+func streamError(err error) error {
+	if err == nil {
+		return errStreamEnded
 	}
+	return err
 }
@@ -0,0 +1,201 @@
+package transportgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/kvoloboi/telemetry/api/telemetry/v1"
+	"github.com/kvoloboi/telemetry/internal/application/common"
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// silentSink receives readings without ever acking them, like a sink that
+// logged them but went away before their batch was durable.
+type silentSink struct {
+	pb.UnimplementedTelemetrySinkServer
+	received chan *pb.SequencedTelemetry
+}
+
+func (s *silentSink) SyncTelemetry(stream pb.TelemetrySink_SyncTelemetryServer) error {
+	for {
+		m, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		s.received <- m
+	}
+}
+
+func dialSink(t *testing.T, srv pb.TelemetrySinkServer) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pb.RegisterTelemetrySinkServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// TestUnackedReadingSentAgainWithItsSeq shows why spilled readings are delivered
+// exactly once: a reading failed on Close is spilled by the dispatcher and
+// enqueued again after a restart under the number it was first sent with.
+func TestUnackedReadingSentAgainWithItsSeq(t *testing.T) {
+	sink := &silentSink{received: make(chan *pb.SequencedTelemetry, 1)}
+
+	event, err := domain.NewTelemetry("temp", 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.Seq = 42 // numbered by the dispatcher
+
+	// send runs a node until the sink received the reading, then shuts it down
+	send := func() (uint64, error) {
+		t.Helper()
+
+		s, err := NewTelemetryGrpcSender(dialSink(t, sink), nil, &SenderConfig{
+			MaxReconnectAttempts: 1,
+			Backoff:              common.NewBackoff(time.Millisecond, time.Millisecond),
+			Buffer:               10,
+			CloseTimeout:         50 * time.Millisecond,
+			NodeID:               "node-a",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		outcome := make(chan error, 1)
+		if err := s.Enqueue(context.Background(), event, func(err error) { outcome <- err }); err != nil {
+			t.Fatal(err)
+		}
+
+		var got *pb.SequencedTelemetry
+		select {
+		case got = <-sink.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("sink did not receive the reading")
+		}
+		if got.GetNodeId() != "node-a" {
+			t.Fatalf("node id = %q, want node-a", got.GetNodeId())
+		}
+
+		s.Close()
+		return got.GetSeq(), <-outcome
+	}
+
+	first, err := send()
+	if !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("unacked reading failed with %v, want io.ErrClosedPipe", err)
+	}
+	if first != 42 {
+		t.Fatalf("reading sent with seq %d, want its own, 42", first)
+	}
+
+	if second, _ := send(); second != first {
+		t.Fatalf("reading sent again with seq %d, not %d, the sink would log it twice", second, first)
+	}
+}
+
+// ackingSink acks every reading as it arrives and, like the sink, ends a stream
+// whose sequence numbers do not increase.
+type ackingSink struct {
+	pb.UnimplementedTelemetrySinkServer
+
+	mu       sync.Mutex
+	streams  int
+	received []streamSeq
+}
+
+type streamSeq struct {
+	stream int
+	seq    uint64
+}
+
+func (s *ackingSink) SyncTelemetry(stream pb.TelemetrySink_SyncTelemetryServer) error {
+	s.mu.Lock()
+	s.streams++
+	id := s.streams
+	s.mu.Unlock()
+
+	var last uint64
+	for {
+		m, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if m.GetSeq() <= last {
+			return status.Errorf(codes.InvalidArgument, "seq %d does not follow %d", m.GetSeq(), last)
+		}
+		last = m.GetSeq()
+
+		s.mu.Lock()
+		s.received = append(s.received, streamSeq{id, m.GetSeq()})
+		s.mu.Unlock()
+
+		if err := stream.Send(&pb.TelemetryAck{Seq: m.GetSeq()}); err != nil {
+			return err
+		}
+	}
+}
+
+func TestReadingNumberedBelowStreamGetsNewStream(t *testing.T) {
+	sink := &ackingSink{}
+	s, err := NewTelemetryGrpcSender(dialSink(t, sink), nil, &SenderConfig{
+		MaxReconnectAttempts: 1,
+		Backoff:              common.NewBackoff(time.Millisecond, time.Millisecond),
+		Buffer:               10,
+		CloseTimeout:         time.Second,
+		NodeID:               "node-a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// a newer reading is sent before an older one handed back from the spill
+	for _, seq := range []uint64{5, 3} {
+		event, err := domain.NewTelemetry("temp", float64(seq), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.Seq = seq
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = s.Send(ctx, event)
+		cancel()
+		if err != nil {
+			t.Fatalf("reading %d: %v", seq, err)
+		}
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	want := []streamSeq{{1, 5}, {2, 3}}
+	if !slices.Equal(sink.received, want) {
+		t.Fatalf("sink received %v, want %v", sink.received, want)
+	}
+}
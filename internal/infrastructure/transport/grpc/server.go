@@ -2,6 +2,7 @@ package transportgrpc
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net"
@@ -9,7 +10,10 @@ import (
 
 	"github.com/kvoloboi/telemetry/internal/application/sink"
 	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/metrics"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/protobuf/proto"
 
 	telemetrypb "github.com/kvoloboi/telemetry/api/telemetry/v1"
@@ -19,16 +23,23 @@ type GRPCServer struct {
 	telemetrypb.UnimplementedTelemetrySinkServer
 
 	server   *grpc.Server
+	health   *health.Server
 	logger   *slog.Logger
 	ingestor sink.TelemetryIngestor
+	wal      sink.DurableLog
 	lis      net.Listener
 	ctx      context.Context
+
+	// open streams per RPC
+	streams     *metrics.Gauge
+	syncStreams *metrics.Gauge
 }
 
 func NewGRPCServer(
 	ctx context.Context,
 	addr string,
 	ingestor sink.TelemetryIngestor,
+	wal sink.DurableLog,
 	logger *slog.Logger,
 	opts ...grpc.ServerOption,
 ) (*GRPCServer, error) {
@@ -41,13 +52,19 @@ func NewGRPCServer(
 
 	self := &GRPCServer{
 		server:   grpcServer,
+		health:   health.NewServer(),
 		ingestor: ingestor,
+		wal:      wal,
 		lis:      lis,
 		logger:   logger,
 		ctx:      ctx,
+
+		streams:     metrics.NewGauge(),
+		syncStreams: metrics.NewGauge(),
 	}
 
 	telemetrypb.RegisterTelemetrySinkServer(grpcServer, self)
+	healthpb.RegisterHealthServer(grpcServer, self.health)
 
 	return self, nil
 }
@@ -55,6 +72,9 @@ func NewGRPCServer(
 func (s *GRPCServer) StreamTelemetry(
 	stream telemetrypb.TelemetrySink_StreamTelemetryServer,
 ) error {
+	s.streams.Inc()
+	defer s.streams.Dec()
+
 	var received uint64
 
 	for {
@@ -90,20 +110,44 @@ func (s *GRPCServer) StreamTelemetry(
 		size := proto.Size(msg)
 
 		// Pass the stream context downstream for cancellation in ingestion pipeline
-		if err := s.ingestor.Ingest(stream.Context(), sink.TelemetryItem{Msg: &model, Size: size}); err != nil {
-			return err
+		err = s.ingestor.Ingest(stream.Context(), sink.TelemetryItem{Msg: &model, Size: size})
+		if errors.Is(err, sink.ErrRejected) {
+			// a single rejected item does not end the stream
+			continue
+		}
+		if err != nil {
+			s.logger.Warn("ending stream, telemetry not ingested", "received", received, "err", err)
+			return ingestStatus(err)
 		}
 
 		received++
 	}
 }
 
+// RegisterMetrics exposes the number of open streams per RPC.
+func (s *GRPCServer) RegisterMetrics(reg *metrics.Registry) {
+	const help = "Open gRPC telemetry streams."
+	reg.Register("telemetry_sink_grpc_active_streams", help, s.streams, "rpc", "StreamTelemetry")
+	reg.Register("telemetry_sink_grpc_active_streams", help, s.syncStreams, "rpc", "SyncTelemetry")
+}
+
+// Run serves until Shutdown and reports the server as serving to health checks.
 func (s *GRPCServer) Run() error {
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	s.health.SetServingStatus(telemetrypb.TelemetrySink_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
 	return s.server.Serve(s.lis)
 }
 
+// Drain reports the server as not serving to health checks, so clients and
+// load balancers move away before Shutdown. Shutdown implies Drain.
+func (s *GRPCServer) Drain() {
+	s.health.Shutdown()
+}
+
 func (s *GRPCServer) Shutdown(timeout time.Duration) {
 	s.logger.Info("initiating graceful shutdown of gRPC server")
+	s.Drain()
 
 	done := make(chan struct{})
 
@@ -0,0 +1,48 @@
+package transportgrpc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ingestStatus turns an ingest failure into the status that ends the stream.
+// An overloaded sink answers RESOURCE_EXHAUSTED with a RetryInfo detail when
+// it has a retry hint, and UNAVAILABLE otherwise.
+func ingestStatus(err error) error {
+	var retry *sink.RetryAfterError
+	switch {
+	case errors.As(err, &retry):
+		st := status.New(codes.ResourceExhausted, err.Error())
+		if detailed, derr := st.WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(retry.RetryAfter),
+		}); derr == nil {
+			st = detailed
+		}
+		return st.Err()
+	case errors.Is(err, sink.ErrOverloaded):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return err
+	}
+}
+
+// retryDelay returns the retry hint of a RESOURCE_EXHAUSTED status.
+func retryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
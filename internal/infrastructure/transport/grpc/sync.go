@@ -0,0 +1,307 @@
+package transportgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	telemetrypb "github.com/kvoloboi/telemetry/api/telemetry/v1"
+)
+
+// SyncTelemetry ingests sequenced telemetry and acks it once it is durable in the log.
+// Acks are cumulative and sent in receive order, so a message is acked only after
+// every message before it is either durable or rejected.
+func (s *GRPCServer) SyncTelemetry(
+	stream telemetrypb.TelemetrySink_SyncTelemetryServer,
+) error {
+	s.syncStreams.Inc()
+	defer s.syncStreams.Dec()
+
+	ctx := stream.Context()
+	acks := newAckTracker()
+
+	ackErr := make(chan error, 1)
+	go func() {
+		ackErr <- s.sendAcks(stream, acks)
+	}()
+
+	// Recv blocks, so it runs aside to keep the loop responsive to shutdown
+	type received struct {
+		msg *telemetrypb.SequencedTelemetry
+		err error
+	}
+	msgs := make(chan received)
+	quit := make(chan struct{})
+	defer close(quit)
+
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			select {
+			case msgs <- received{msg, err}:
+			case <-quit:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var (
+		lastSeq uint64
+		node    string         // node id of the first message, fixed for the stream
+		origin  *domain.NodeID // set when the node sent an id
+	)
+
+	// finish stops intake and waits until everything received so far is acked
+	finish := func() error {
+		acks.close()
+		return <-ackErr
+	}
+
+	for {
+		var r received
+
+		select {
+		case <-s.ctx.Done():
+			s.logger.Info("server shutting down, finishing sync stream", "last_seq", lastSeq)
+			return finish()
+		case err := <-ackErr:
+			return err
+		case r = <-msgs:
+		}
+
+		if r.err == io.EOF {
+			s.logger.Info("sync stream closed by client", "last_seq", lastSeq)
+			return finish()
+		}
+		if r.err != nil {
+			s.logger.Error("failed to receive telemetry", "err", r.err)
+			return r.err
+		}
+
+		seq := r.msg.GetSeq()
+		if seq <= lastSeq {
+			return status.Errorf(codes.InvalidArgument, "seq %d does not follow %d", seq, lastSeq)
+		}
+
+		if lastSeq == 0 {
+			node = r.msg.GetNodeId()
+			if node != "" {
+				id, err := domain.NewNodeID(node)
+				if err != nil {
+					return status.Errorf(codes.InvalidArgument, "invalid node id: %v", err)
+				}
+				origin = &id
+			}
+		} else if r.msg.GetNodeId() != node {
+			return status.Error(codes.InvalidArgument, "node id changed within the stream")
+		}
+		lastSeq = seq
+
+		entry := acks.add(seq)
+
+		msg := r.msg.GetTelemetry()
+		model, err := domain.NewTelemetry(msg.GetSensor(), msg.GetValue(), msg.GetTimestamp().AsTime())
+		if err != nil {
+			// resending a malformed message cannot help, so it is rejected instead of ending the stream
+			s.logger.Error("received mailformed telemetry", "seq", seq, "err", err)
+			acks.reject(entry)
+			continue
+		}
+
+		item := sink.TelemetryItem{
+			Msg:  &model,
+			Size: proto.Size(msg),
+			Appended: func(walSeq uint64, err error) {
+				acks.appended(entry, walSeq, err)
+			},
+		}
+		if origin != nil {
+			item.Origin = &sink.Origin{Node: *origin, Seq: seq}
+		}
+
+		err = s.ingestor.Ingest(ctx, item)
+		if errors.Is(err, sink.ErrRejected) {
+			acks.reject(entry)
+			continue
+		}
+		if err != nil {
+			// ack what made it in, the node resends the rest
+			s.logger.Warn("ending sync stream, telemetry not ingested", "seq", seq, "err", err)
+			acks.remove(entry)
+			if ferr := finish(); ferr != nil {
+				return ferr
+			}
+			return ingestStatus(err)
+		}
+	}
+}
+
+// sendAcks sends a cumulative ack whenever a prefix of the received messages is settled.
+// It returns nil once the tracker is closed and fully acked.
+func (s *GRPCServer) sendAcks(
+	stream telemetrypb.TelemetrySink_SyncTelemetryServer,
+	acks *ackTracker,
+) error {
+	ctx := stream.Context()
+
+	for {
+		settled, drained, err := acks.next(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(settled) > 0 {
+			ack := &telemetrypb.TelemetryAck{Seq: settled[len(settled)-1].seq}
+
+			var (
+				walSeq   uint64
+				appended bool
+			)
+			for _, e := range settled {
+				if e.rejected {
+					ack.Rejected = append(ack.Rejected, e.seq)
+					continue
+				}
+				walSeq, appended = max(walSeq, e.walSeq), true
+			}
+
+			if appended {
+				if err := s.wal.WaitDurable(ctx, walSeq); err != nil {
+					s.logger.Error("telemetry not durable, ending sync stream", "err", err)
+					return status.Error(codes.Unavailable, "telemetry log unavailable")
+				}
+			}
+
+			if err := stream.Send(ack); err != nil {
+				return err
+			}
+		}
+
+		if drained {
+			return nil
+		}
+	}
+}
+
+// ackEntry is the state of one received message.
+type ackEntry struct {
+	seq      uint64
+	walSeq   uint64
+	settled  bool
+	rejected bool
+}
+
+// ackTracker holds the received messages of one stream in receive order.
+type ackTracker struct {
+	mu      sync.Mutex
+	entries []*ackEntry
+	err     error
+	closed  bool
+	changed chan struct{}
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{changed: make(chan struct{}, 1)}
+}
+
+func (t *ackTracker) add(seq uint64) *ackEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e := &ackEntry{seq: seq}
+	t.entries = append(t.entries, e)
+	return e
+}
+
+func (t *ackTracker) reject(e *ackEntry) {
+	t.mu.Lock()
+	e.settled, e.rejected = true, true
+	t.mu.Unlock()
+
+	t.notify()
+}
+
+// remove forgets e, which was never handed on.
+func (t *ackTracker) remove(e *ackEntry) {
+	t.mu.Lock()
+	if i := slices.Index(t.entries, e); i >= 0 {
+		t.entries = slices.Delete(t.entries, i, i+1)
+	}
+	t.mu.Unlock()
+
+	t.notify()
+}
+
+// appended records the outcome of handing e to the log.
+// An error fails the whole stream, since later messages can no longer be acked.
+func (t *ackTracker) appended(e *ackEntry, walSeq uint64, err error) {
+	t.mu.Lock()
+	if err != nil {
+		if t.err == nil {
+			t.err = err
+		}
+	} else {
+		e.settled, e.walSeq = true, walSeq
+	}
+	t.mu.Unlock()
+
+	t.notify()
+}
+
+// close marks the end of intake; next reports drained once every entry is settled.
+func (t *ackTracker) close() {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	t.notify()
+}
+
+func (t *ackTracker) notify() {
+	select {
+	case t.changed <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for a settled prefix of entries and removes it from the tracker.
+func (t *ackTracker) next(ctx context.Context) ([]*ackEntry, bool, error) {
+	for {
+		t.mu.Lock()
+		if t.err != nil {
+			err := t.err
+			t.mu.Unlock()
+			return nil, false, status.Errorf(codes.Unavailable, "telemetry not appended: %v", err)
+		}
+
+		n := 0
+		for n < len(t.entries) && t.entries[n].settled {
+			n++
+		}
+		settled := t.entries[:n:n]
+		t.entries = t.entries[n:]
+		drained := t.closed && len(t.entries) == 0
+		t.mu.Unlock()
+
+		if n > 0 || drained {
+			return settled, drained, nil
+		}
+
+		select {
+		case <-t.changed:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
@@ -3,6 +3,7 @@ package transporthttp
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,6 +29,18 @@ func WithTimeout(d time.Duration) Option {
 	}
 }
 
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) error {
+		if cfg == nil {
+			return nil
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg
+		c.httpClient.Transport = transport
+		return nil
+	}
+}
+
 func WithBaseURL(u string) Option {
 	return func(c *Client) error {
 		parsed, err := url.Parse(u)
@@ -91,50 +104,81 @@ func (c *Client) Delete(ctx context.Context, path string, out any) error {
 	return c.doRequest(ctx, http.MethodDelete, path, nil, out)
 }
 
+// PostEncoded sends a POST request with an already encoded JSON body,
+// compressed as contentEncoding unless it is empty, and decodes response into `out`.
+// It returns the response headers.
+func (c *Client) PostEncoded(ctx context.Context, path string, body []byte, contentEncoding string, out any) (http.Header, error) {
+	return c.send(ctx, http.MethodPost, path, body, contentEncoding, out)
+}
+
+// StatusError is returned for non-2xx responses.
+type StatusError struct {
+	Code   int
+	Body   string
+	Header http.Header
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http %d: %s", e.Code, e.Body)
+}
+
 func (c *Client) doRequest(ctx context.Context, method, path string, body any, out any) error {
+	// Encode body if present
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request body: %w", err)
+		}
+	}
+
+	_, err := c.send(ctx, method, path, b, "", out)
+	return err
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body []byte, contentEncoding string, out any) (http.Header, error) {
 	// Build URL
 	rel, err := url.Parse(path)
 	if err != nil {
-		return fmt.Errorf("invalid path %q: %w", path, err)
+		return nil, fmt.Errorf("invalid path %q: %w", path, err)
 	}
 	fullURL := c.baseURL.ResolveReference(rel)
 
-	// Encode body if present
 	var bodyReader io.Reader
 	if body != nil {
-		b, err := json.Marshal(body)
-		if err != nil {
-			return fmt.Errorf("marshal request body: %w", err)
-		}
-		bodyReader = bytes.NewReader(b)
+		bodyReader = bytes.NewReader(body)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, fullURL.String(), bodyReader)
 
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 
 	// Set default headers
 	maps.Copy(req.Header, c.headers)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("http request failed: %w", err)
+		return nil, fmt.Errorf("http request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		const errBodySize = 1 << 10
 		payload, _ := io.ReadAll(io.LimitReader(resp.Body, errBodySize))
-		return fmt.Errorf("http %d: %s", resp.StatusCode, payload)
+		return resp.Header, &StatusError{Code: resp.StatusCode, Body: string(payload), Header: resp.Header}
 	}
 
 	if out != nil {
 		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
-			return fmt.Errorf("decode response: %w", err)
+			return resp.Header, fmt.Errorf("decode response: %w", err)
 		}
 	}
 
-	return nil
+	return resp.Header, nil
 }
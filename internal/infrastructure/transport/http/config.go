@@ -0,0 +1,28 @@
+package transporthttp
+
+import (
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/common"
+)
+
+type SenderConfig struct {
+	MaxBatchCount int            // readings per request
+	MaxBatchBytes int            // uncompressed JSON bytes per request
+	Linger        time.Duration  // max time a reading waits for its batch to fill
+	Gzip          bool           // gzip request bodies
+	MaxRetries    int            // attempts per reading before it fails
+	Backoff       common.Backoff // wait between attempts, unless Retry-After asks for longer
+	NodeID        string         // sent with numbered readings for the sink to drop duplicates; empty sends none
+}
+
+func defaultSenderConfig() SenderConfig {
+	return SenderConfig{
+		MaxBatchCount: 100,
+		MaxBatchBytes: 64 * 1024,
+		Linger:        100 * time.Millisecond,
+		Gzip:          false,
+		MaxRetries:    5,
+		Backoff:       common.NewBackoff(200*time.Millisecond, 5*time.Second),
+	}
+}
@@ -1,23 +1,68 @@
 package transporthttp
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
-	"net/url"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/kvoloboi/telemetry/internal/application/node"
 	"github.com/kvoloboi/telemetry/internal/domain"
 )
 
+// buffered readings beyond this many batches make Enqueue wait
+const maxBufferedBatches = 4
+
+type telemetryJSON struct {
+	Sensor    string  `json:"sensor"`
+	Value     float64 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+	Node      string  `json:"node,omitempty"` // with Seq, lets the sink drop readings it already logged
+	Seq       uint64  `json:"seq,omitempty"`
+}
+
+type pendingItem struct {
+	raw  json.RawMessage
+	done func(error)
+}
+
+// TelemetryHttpSender accumulates readings and POSTs them to /telemetry as
+// one JSON array per batch. A batch is sent when it reaches MaxBatchCount
+// readings or MaxBatchBytes, or when its oldest reading waited Linger.
+// Readings the sink could not take yet are retried before the next batch.
+// With a NodeID, numbered readings carry the node id and their sequence
+// number, so the sink drops the ones it already logged.
 type TelemetryHttpSender struct {
-	client  *Client
-	logger  *slog.Logger
-	baseURL *url.URL
+	client *Client
+	logger *slog.Logger
+	cfg    SenderConfig
+
+	mu      sync.Mutex
+	buf     []pendingItem
+	bytes   int
+	firstAt time.Time     // when the oldest buffered reading arrived
+	space   chan struct{} // closed when buffered readings are taken
+	closed  bool
+
+	sendMu sync.Mutex // one request at a time keeps readings in order
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
 }
 
 func NewTelemetryHttpSender(
 	baseURL string,
 	logger *slog.Logger,
+	config *SenderConfig,
 	opts ...Option,
 ) (*TelemetryHttpSender, error) {
 	if baseURL == "" {
@@ -28,6 +73,11 @@ func NewTelemetryHttpSender(
 		logger = slog.Default()
 	}
 
+	cfg := defaultSenderConfig()
+	if config != nil {
+		cfg = *config
+	}
+
 	client, err := New(
 		append(
 			[]Option{
@@ -40,35 +90,341 @@ func NewTelemetryHttpSender(
 		return nil, err
 	}
 
-	return &TelemetryHttpSender{
+	s := &TelemetryHttpSender{
 		client: client,
 		logger: logger,
-	}, nil
-}
+		cfg:    cfg,
+		space:  make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
 
-type telemetryJSON struct {
-	Sensor    string  `json:"sensor"`
-	Value     float64 `json:"value"`
-	Timestamp int64   `json:"timestamp"`
+	go s.run()
+
+	return s, nil
 }
 
+// Send buffers t and waits until the batch holding it was delivered.
 func (s *TelemetryHttpSender) Send(ctx context.Context, t domain.Telemetry) error {
-	payload := telemetryJSON{
+	result := make(chan error, 1)
+	if err := s.Enqueue(ctx, t, func(err error) { result <- err }); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *TelemetryHttpSender) Enqueue(ctx context.Context, t domain.Telemetry, done func(error)) error {
+	msg := telemetryJSON{
 		Sensor:    t.Sensor.String(),
 		Value:     t.Value.Float64(),
 		Timestamp: t.Timestamp.Time().UnixMilli(),
 	}
-
-	if err := s.client.Post(ctx, "/telemetry", payload, nil); err != nil {
-		s.logger.Error("failed to send telemetry", "err", err)
+	if t.Seq != 0 && s.cfg.NodeID != "" {
+		msg.Node, msg.Seq = s.cfg.NodeID, t.Seq
+	}
+	raw, err := json.Marshal(msg)
+	if err != nil {
 		return err
 	}
 
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return io.ErrClosedPipe
+		}
+		if len(s.buf) < maxBufferedBatches*s.cfg.MaxBatchCount {
+			break
+		}
+		space := s.space
+		s.mu.Unlock()
+
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if len(s.buf) == 0 {
+		s.firstAt = time.Now()
+	}
+	s.buf = append(s.buf, pendingItem{raw: raw, done: done})
+	s.bytes += len(raw)
+	full := s.ready(time.Now())
+	s.mu.Unlock()
+
+	if full {
+		s.notify()
+	}
 	return nil
 }
 
+func (s *TelemetryHttpSender) Flush(ctx context.Context) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	for {
+		batch := s.take()
+		if len(batch) == 0 {
+			return nil
+		}
+		s.sendBatch(ctx, batch)
+	}
+}
+
+// Close stops accepting readings and sends whatever is buffered.
 func (s *TelemetryHttpSender) Close() error {
-	// Nothing to close for http client
-	// kept for interface stability & future transports
-	return nil
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.stop)
+	<-s.done
+
+	// requests are bounded by the client timeout
+	return s.Flush(context.Background())
+}
+
+func (s *TelemetryHttpSender) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ready reports whether a batch should be sent now. s.mu must be held.
+func (s *TelemetryHttpSender) ready(now time.Time) bool {
+	if len(s.buf) == 0 {
+		return false
+	}
+	return len(s.buf) >= s.cfg.MaxBatchCount ||
+		s.bytes >= s.cfg.MaxBatchBytes ||
+		now.Sub(s.firstAt) >= s.cfg.Linger
+}
+
+// run sends batches as they become ready until Close.
+func (s *TelemetryHttpSender) run() {
+	defer close(s.done)
+
+	timer := time.NewTimer(s.cfg.Linger)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		ready := s.ready(time.Now())
+		wait := s.cfg.Linger
+		if len(s.buf) > 0 {
+			wait = time.Until(s.firstAt.Add(s.cfg.Linger))
+		}
+		s.mu.Unlock()
+
+		if ready {
+			s.sendMu.Lock()
+			if batch := s.take(); len(batch) > 0 {
+				s.sendBatch(context.Background(), batch)
+			}
+			s.sendMu.Unlock()
+			continue
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-s.wake:
+		case <-timer.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// take removes up to one batch from the buffer.
+func (s *TelemetryHttpSender) take() []pendingItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, size := 0, 0
+	for n < len(s.buf) && n < s.cfg.MaxBatchCount {
+		if n > 0 && size+len(s.buf[n].raw) > s.cfg.MaxBatchBytes {
+			break
+		}
+		size += len(s.buf[n].raw)
+		n++
+	}
+
+	batch := make([]pendingItem, n)
+	copy(batch, s.buf)
+	s.buf = append(s.buf[:0], s.buf[n:]...)
+	s.bytes -= size
+	if len(s.buf) > 0 {
+		// the rest already waited, send it with the next batch check
+		s.firstAt = time.Now().Add(-s.cfg.Linger)
+	}
+
+	close(s.space)
+	s.space = make(chan struct{})
+
+	return batch
+}
+
+// sendBatch POSTs a batch and reports the outcome of every reading. Readings
+// the sink could not take yet are sent again in place, before any reading
+// buffered behind them, after the backoff or the sink's Retry-After, whichever
+// is longer. Once MaxRetries attempts failed, or the wait is cut short by ctx
+// or Close, they fail together with everything buffered, so that no later
+// reading overtakes them.
+func (s *TelemetryHttpSender) sendBatch(ctx context.Context, batch []pendingItem) {
+	for attempt := 1; ; attempt++ {
+		retry, retryAfter, err := s.post(ctx, batch)
+		if len(retry) == 0 {
+			return
+		}
+
+		if attempt >= s.cfg.MaxRetries {
+			s.giveUp(retry, err)
+			return
+		}
+
+		delay := max(s.cfg.Backoff.Next(attempt), retryAfter)
+		s.logger.Warn("retrying telemetry batch",
+			"readings", len(retry),
+			"attempt", attempt,
+			"delay", delay,
+			"err", err,
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			s.giveUp(retry, err)
+			return
+		case <-s.stop:
+			timer.Stop()
+			s.giveUp(retry, err)
+			return
+		}
+		batch = retry
+	}
+}
+
+// post sends batch once and reports the readings that were delivered or rejected.
+// It returns the others, which are worth sending again, with the error they failed
+// with and how long the sink asked to wait before.
+func (s *TelemetryHttpSender) post(ctx context.Context, batch []pendingItem) ([]pendingItem, time.Duration, error) {
+	body, encoding, err := s.encode(batch)
+	if err != nil {
+		s.complete(batch, err)
+		return nil, 0, nil
+	}
+
+	var result batchResultJSON
+	header, err := s.client.PostEncoded(ctx, "/telemetry", body, encoding, &result)
+	if err != nil {
+		s.logger.Error("failed to send telemetry batch", "readings", len(batch), "err", err)
+
+		var status *StatusError
+		if errors.As(err, &status) && status.Code >= 400 && status.Code < 500 &&
+			status.Code != http.StatusRequestTimeout && status.Code != http.StatusTooManyRequests {
+			s.complete(batch, fmt.Errorf("%w: %w", node.ErrRejected, err))
+			return nil, 0, nil
+		}
+		return batch, retryAfter(header, time.Now()), err
+	}
+
+	if len(result.Results) != len(batch) {
+		s.complete(batch, fmt.Errorf("sink returned %d results for %d readings", len(result.Results), len(batch)))
+		return nil, 0, nil
+	}
+
+	var retry []pendingItem
+	for i, item := range batch {
+		r := result.Results[i]
+		switch {
+		case r.Error == "":
+			item.done(nil)
+		case r.Retryable:
+			retry = append(retry, item)
+			err = errors.New(r.Error)
+		default:
+			item.done(fmt.Errorf("%w: %s", node.ErrRejected, r.Error))
+		}
+	}
+	return retry, retryAfter(header, time.Now()), err
+}
+
+// giveUp fails retry and every buffered reading with err.
+func (s *TelemetryHttpSender) giveUp(retry []pendingItem, err error) {
+	s.complete(retry, err)
+
+	s.mu.Lock()
+	rest := s.buf
+	s.buf, s.bytes = nil, 0
+	close(s.space)
+	s.space = make(chan struct{})
+	s.mu.Unlock()
+
+	if len(rest) > 0 {
+		s.logger.Warn("failing buffered telemetry behind undelivered readings", "readings", len(rest))
+	}
+	s.complete(rest, err)
+}
+
+// retryAfter returns the wait a Retry-After header asks for, given in seconds or as a date.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+func (s *TelemetryHttpSender) complete(batch []pendingItem, err error) {
+	for _, item := range batch {
+		item.done(err)
+	}
+}
+
+func (s *TelemetryHttpSender) encode(batch []pendingItem) ([]byte, string, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, item := range batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(item.raw)
+	}
+	buf.WriteByte(']')
+
+	if !s.cfg.Gzip {
+		return buf.Bytes(), "", nil
+	}
+
+	var zbuf bytes.Buffer
+	zw := gzip.NewWriter(&zbuf)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return zbuf.Bytes(), "gzip", nil
 }
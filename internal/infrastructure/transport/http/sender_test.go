@@ -0,0 +1,218 @@
+package transporthttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/common"
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+var errBusy = errors.New("sink busy")
+
+// recordingSink accepts readings in the order they arrive. Its first answer is
+// made by first, with a Retry-After of one second.
+type recordingSink struct {
+	first func(w http.ResponseWriter, n int)
+
+	mu       sync.Mutex
+	requests int
+	retryAt  time.Time // when the second request arrived
+	accepted []float64
+}
+
+func (s *recordingSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msgs []telemetryJSON
+	if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if s.requests == 1 {
+		w.Header().Set("Retry-After", "1")
+		s.first(w, len(msgs))
+		return
+	}
+	if s.requests == 2 {
+		s.retryAt = time.Now()
+	}
+
+	result := batchResultJSON{Accepted: len(msgs), Results: make([]itemResultJSON, len(msgs))}
+	for _, m := range msgs {
+		s.accepted = append(s.accepted, m.Value)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func TestSenderRetriesInPlaceAfterRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		first func(w http.ResponseWriter, n int)
+	}{
+		{
+			name: "too many requests",
+			first: func(w http.ResponseWriter, n int) {
+				writeError(w, http.StatusTooManyRequests, errBusy)
+			},
+		},
+		{
+			name: "retryable readings",
+			first: func(w http.ResponseWriter, n int) {
+				result := batchResultJSON{Results: make([]itemResultJSON, n)}
+				for i := 1; i < n; i++ {
+					result.Results[i] = itemResultJSON{Error: errBusy.Error(), Retryable: true}
+				}
+				writeJSON(w, http.StatusOK, result)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rs := &recordingSink{first: tc.first}
+			srv := httptest.NewServer(rs)
+			defer srv.Close()
+
+			s, err := NewTelemetryHttpSender(srv.URL, nil, &SenderConfig{
+				MaxBatchCount: 2,
+				MaxBatchBytes: 64 * 1024,
+				Linger:        10 * time.Millisecond,
+				MaxRetries:    3,
+				Backoff:       common.NewBackoff(time.Millisecond, time.Millisecond),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			start := time.Now()
+			const n = 6
+			outcomes := make(chan error, n)
+			for i := range n {
+				event, err := domain.NewTelemetry("temp", float64(i), time.Now())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Enqueue(context.Background(), event, func(err error) { outcomes <- err }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for range n {
+				select {
+				case err := <-outcomes:
+					if err != nil {
+						t.Fatalf("reading failed: %v", err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("readings were not delivered")
+				}
+			}
+
+			rs.mu.Lock()
+			defer rs.mu.Unlock()
+
+			if wait := rs.retryAt.Sub(start); wait < time.Second {
+				t.Fatalf("retried after %v, before the Retry-After of 1s", wait)
+			}
+			// the retried readings go out before the ones buffered behind them
+			if len(rs.accepted) == 0 || rs.accepted[len(rs.accepted)-1] != n-1 {
+				t.Fatalf("sink accepted %v, want up to %d", rs.accepted, n-1)
+			}
+			for i, v := range rs.accepted {
+				if i > 0 && v <= rs.accepted[i-1] {
+					t.Fatalf("sink accepted %v, out of order", rs.accepted)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "3", want: 3 * time.Second},
+		{value: "-1", want: 0},
+		{value: now.Add(10 * time.Second).Format(http.TimeFormat), want: 10 * time.Second},
+		{value: now.Add(-time.Second).Format(http.TimeFormat), want: 0},
+		{value: "soon", want: 0},
+	} {
+		header := http.Header{}
+		if tc.value != "" {
+			header.Set("Retry-After", tc.value)
+		}
+		if got := retryAfter(header, now); got != tc.want {
+			t.Errorf("retryAfter(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestSenderSendsNodeAndSeq(t *testing.T) {
+	received := make(chan []telemetryJSON, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msgs []telemetryJSON
+		if err := json.NewDecoder(r.Body).Decode(&msgs); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		received <- msgs
+		writeJSON(w, http.StatusOK, batchResultJSON{Accepted: len(msgs), Results: make([]itemResultJSON, len(msgs))})
+	}))
+	defer srv.Close()
+
+	s, err := NewTelemetryHttpSender(srv.URL, nil, &SenderConfig{
+		MaxBatchCount: 2,
+		MaxBatchBytes: 1 << 20,
+		Linger:        time.Hour,
+		MaxRetries:    1,
+		Backoff:       common.NewBackoff(time.Millisecond, time.Millisecond),
+		NodeID:        "node-a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	numbered, err := domain.NewTelemetry("temp", 1, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbered.Seq = 7
+	plain, err := domain.NewTelemetry("temp", 2, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []domain.Telemetry{numbered, plain} {
+		if err := s.Enqueue(context.Background(), m, func(error) {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var msgs []telemetryJSON
+	select {
+	case msgs = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink received no batch")
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("received %+v, want two readings", msgs)
+	}
+	if msgs[0].Node != "node-a" || msgs[0].Seq != 7 {
+		t.Fatalf("numbered reading sent as %+v, want node-a seq 7", msgs[0])
+	}
+	if msgs[1].Node != "" || msgs[1].Seq != 0 {
+		t.Fatalf("unnumbered reading sent as %+v, want no node and seq", msgs[1])
+	}
+}
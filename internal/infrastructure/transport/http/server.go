@@ -0,0 +1,334 @@
+package transporthttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+const maxRequestBytes = 4 << 20
+
+// itemResultJSON is the outcome of one reading of a batched request.
+// An empty Error means the reading was accepted.
+type itemResultJSON struct {
+	Error     string `json:"error,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+type batchResultJSON struct {
+	Accepted int              `json:"accepted"`
+	Results  []itemResultJSON `json:"results"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// appendResult reports where the reading at index of a request was appended.
+type appendResult struct {
+	index int
+	seq   uint64
+	err   error
+}
+
+// HTTPServer accepts the JSON payloads sent by TelemetryHttpSender.
+// POST /telemetry takes a single telemetryJSON object or an array of them.
+// A request is answered once its accepted readings are durable in the log.
+type HTTPServer struct {
+	server   *http.Server
+	logger   *slog.Logger
+	ingestor sink.TelemetryIngestor
+	wal      sink.DurableLog
+	lis      net.Listener
+	tls      bool
+}
+
+// NewHTTPServer listens on addr. With a non-nil tlsConfig the server speaks
+// HTTPS and enforces the client authentication it configures.
+func NewHTTPServer(
+	ctx context.Context,
+	addr string,
+	ingestor sink.TelemetryIngestor,
+	wal sink.DurableLog,
+	logger *slog.Logger,
+	tlsConfig *tls.Config,
+) (*HTTPServer, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &HTTPServer{
+		logger:   logger,
+		ingestor: ingestor,
+		wal:      wal,
+		lis:      lis,
+		tls:      tlsConfig != nil,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /telemetry", self.handleTelemetry)
+
+	self.server = &http.Server{
+		Handler:           mux,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	return self, nil
+}
+
+func (s *HTTPServer) Run() error {
+	var err error
+	if s.tls {
+		// certificates come from TLSConfig
+		err = s.server.ServeTLS(s.lis, "", "")
+	} else {
+		err = s.server.Serve(s.lis)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *HTTPServer) Shutdown(timeout time.Duration) {
+	s.logger.Info("initiating graceful shutdown of HTTP server")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.logger.Warn("graceful shutdown timed out; forcing stop", "err", err)
+		s.server.Close()
+		return
+	}
+	s.logger.Info("HTTP server stopped gracefully")
+}
+
+func (s *HTTPServer) handleTelemetry(w http.ResponseWriter, r *http.Request) {
+	var src io.ReadCloser = http.MaxBytesReader(w, r.Body, maxRequestBytes)
+
+	switch r.Header.Get("Content-Encoding") {
+	case "":
+	case "gzip":
+		zr, err := gzip.NewReader(src)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer zr.Close()
+		// the limit also applies to the decompressed body
+		src = http.MaxBytesReader(w, zr, maxRequestBytes)
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, errors.New("unsupported content encoding"))
+		return
+	}
+
+	body, err := io.ReadAll(src)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+		} else {
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		s.handleBatch(w, r, body)
+		return
+	}
+
+	var msg telemetryJSON
+	if err := json.Unmarshal(body, &msg); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var retry *sink.RetryAfterError
+
+	appended := make(chan appendResult, 1)
+	err = s.ingest(r.Context(), msg, len(body), 0, appended)
+	if err == nil {
+		var failed map[int]error
+		failed, err = s.awaitDurable(r.Context(), appended, 1)
+		if err == nil {
+			err = failed[0]
+		}
+	}
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, domain.ErrSensorNameEmpty),
+		errors.Is(err, domain.ErrSensorNameTooLong),
+		errors.Is(err, domain.ErrNodeIDTooLong):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, sink.ErrRejected):
+		writeError(w, http.StatusUnprocessableEntity, err)
+	case errors.As(err, &retry):
+		w.Header().Set("Retry-After", retryAfterHeader(retry.RetryAfter))
+		writeError(w, http.StatusTooManyRequests, err)
+	default:
+		s.logger.Error("failed to ingest telemetry", "err", err)
+		writeError(w, http.StatusServiceUnavailable, err)
+	}
+}
+
+// handleBatch ingests an array of readings and reports the outcome of each.
+// Invalid or rejected readings do not stop the batch; an ingest failure
+// marks the failing reading and everything after it as retryable.
+func (s *HTTPServer) handleBatch(w http.ResponseWriter, r *http.Request, body []byte) {
+	var msgs []json.RawMessage
+	if err := json.Unmarshal(body, &msgs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result := batchResultJSON{Results: make([]itemResultJSON, len(msgs))}
+	appended := make(chan appendResult, len(msgs))
+	var ingested []int
+
+	for i, raw := range msgs {
+		var msg telemetryJSON
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			result.Results[i] = itemResultJSON{Error: err.Error()}
+			continue
+		}
+
+		err := s.ingest(r.Context(), msg, len(raw), i, appended)
+		switch {
+		case err == nil:
+			ingested = append(ingested, i)
+			continue
+		case errors.Is(err, domain.ErrSensorNameEmpty),
+			errors.Is(err, domain.ErrSensorNameTooLong),
+			errors.Is(err, domain.ErrNodeIDTooLong),
+			errors.Is(err, sink.ErrRejected):
+			result.Results[i] = itemResultJSON{Error: err.Error()}
+			continue
+		}
+
+		s.logger.Error("failed to ingest telemetry", "err", err)
+		var retry *sink.RetryAfterError
+		if errors.As(err, &retry) {
+			w.Header().Set("Retry-After", retryAfterHeader(retry.RetryAfter))
+		}
+		for j := i; j < len(msgs); j++ {
+			result.Results[j] = itemResultJSON{Error: err.Error(), Retryable: true}
+		}
+		break
+	}
+
+	failed, err := s.awaitDurable(r.Context(), appended, len(ingested))
+	for _, i := range ingested {
+		ierr := failed[i]
+		if ierr == nil {
+			ierr = err
+		}
+		if ierr != nil {
+			result.Results[i] = itemResultJSON{Error: ierr.Error(), Retryable: true}
+			continue
+		}
+		result.Accepted++
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ingest passes msg on; once it is appended, or failed to be, its result is sent to appended.
+func (s *HTTPServer) ingest(ctx context.Context, msg telemetryJSON, size, index int, appended chan<- appendResult) error {
+	model, err := domain.NewTelemetry(msg.Sensor, msg.Value, time.UnixMilli(msg.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	item := sink.TelemetryItem{
+		Msg:  &model,
+		Size: size,
+		Appended: func(seq uint64, err error) {
+			// buffered for every reading of the request, so this never blocks
+			appended <- appendResult{index: index, seq: seq, err: err}
+		},
+	}
+	if msg.Node != "" && msg.Seq != 0 {
+		node, err := domain.NewNodeID(msg.Node)
+		if err != nil {
+			return err
+		}
+		item.Origin = &sink.Origin{Node: node, Seq: msg.Seq}
+	}
+
+	return s.ingestor.Ingest(ctx, item)
+}
+
+// awaitDurable waits for the append results of n ingested readings and then
+// for the batches holding them to be durable. It returns the readings that
+// failed to be appended by index, and an error if the others are not durable.
+func (s *HTTPServer) awaitDurable(ctx context.Context, appended <-chan appendResult, n int) (map[int]error, error) {
+	var (
+		failed map[int]error
+		walSeq uint64
+		ok     bool
+	)
+
+	for range n {
+		select {
+		case res := <-appended:
+			if res.err != nil {
+				if failed == nil {
+					failed = make(map[int]error)
+				}
+				failed[res.index] = res.err
+				continue
+			}
+			walSeq, ok = max(walSeq, res.seq), true
+		case <-ctx.Done():
+			return failed, ctx.Err()
+		}
+	}
+
+	if ok {
+		if err := s.wal.WaitDurable(ctx, walSeq); err != nil {
+			s.logger.Error("telemetry not durable", "err", err)
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+// retryAfterHeader formats d as Retry-After seconds, rounded up.
+func retryAfterHeader(d time.Duration) string {
+	return strconv.FormatInt(max(int64(math.Ceil(d.Seconds())), 1), 10)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorJSON{Error: err.Error()})
+}
@@ -0,0 +1,175 @@
+package transporthttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/application/sink"
+)
+
+// appendingIngestor appends every reading to batch 7 in the background,
+// failing the readings of sensor "lost".
+type appendingIngestor struct{}
+
+func (appendingIngestor) Ingest(_ context.Context, item sink.TelemetryItem) error {
+	go func() {
+		if item.Msg.Sensor.String() == "lost" {
+			item.Appended(0, errors.New("log closed"))
+			return
+		}
+		item.Appended(7, nil)
+	}()
+	return nil
+}
+
+func (appendingIngestor) Close() error { return nil }
+
+// gatedLog makes batches durable once released, failing them if err is set.
+type gatedLog struct {
+	release chan struct{}
+	waited  chan uint64
+	err     error
+}
+
+func (l *gatedLog) WaitDurable(ctx context.Context, seq uint64) error {
+	l.waited <- seq
+	<-l.release
+	return l.err
+}
+
+func newTestServer(t *testing.T, wal *gatedLog) *HTTPServer {
+	t.Helper()
+
+	s, err := NewHTTPServer(context.Background(), "127.0.0.1:0", appendingIngestor{}, wal, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.lis.Close() })
+	return s
+}
+
+func post(s *HTTPServer, body string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/telemetry", strings.NewReader(body)))
+		done <- rec
+	}()
+	return done
+}
+
+func TestSingleReadingAnsweredOnceDurable(t *testing.T) {
+	wal := &gatedLog{release: make(chan struct{}), waited: make(chan uint64, 1)}
+	s := newTestServer(t, wal)
+
+	done := post(s, `{"sensor": "temp", "value": 1, "timestamp": 1770379200000}`)
+
+	if seq := <-wal.waited; seq != 7 {
+		t.Fatalf("waited for batch %d, want 7", seq)
+	}
+	select {
+	case rec := <-done:
+		t.Fatalf("answered %d before the batch was durable", rec.Code)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(wal.release)
+	if rec := <-done; rec.Code != http.StatusAccepted {
+		t.Fatalf("answered %d, want 202", rec.Code)
+	}
+}
+
+func TestBatchReportsReadingsNotDurable(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		durableErr   error
+		wantAccepted int
+		wantRetry    []bool
+	}{
+		{name: "durable", wantAccepted: 1, wantRetry: []bool{false, true}},
+		{name: "fsync failed", durableErr: errors.New("fsync failed"), wantAccepted: 0, wantRetry: []bool{true, true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			wal := &gatedLog{release: make(chan struct{}), waited: make(chan uint64, 1), err: tc.durableErr}
+			close(wal.release)
+			s := newTestServer(t, wal)
+
+			rec := <-post(s, `[
+				{"sensor": "temp", "value": 1, "timestamp": 1770379200000},
+				{"sensor": "lost", "value": 2, "timestamp": 1770379200000}
+			]`)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("answered %d, want 200", rec.Code)
+			}
+
+			var result batchResultJSON
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Accepted != tc.wantAccepted {
+				t.Fatalf("accepted %d, want %d: %+v", result.Accepted, tc.wantAccepted, result)
+			}
+			for i, want := range tc.wantRetry {
+				if result.Results[i].Retryable != want {
+					t.Fatalf("reading %d retryable = %v, want %v: %+v", i, !want, want, result)
+				}
+			}
+		})
+	}
+}
+
+// originIngestor records the origin of every reading by sensor and appends it at once.
+type originIngestor struct {
+	origins map[string]*sink.Origin
+}
+
+func (i *originIngestor) Ingest(_ context.Context, item sink.TelemetryItem) error {
+	i.origins[item.Msg.Sensor.String()] = item.Origin
+	item.Appended(1, nil)
+	return nil
+}
+
+func (i *originIngestor) Close() error { return nil }
+
+// durableLog makes every batch durable at once.
+type durableLog struct{}
+
+func (durableLog) WaitDurable(context.Context, uint64) error { return nil }
+
+func TestReadingsCarryTheirOrigin(t *testing.T) {
+	ingestor := &originIngestor{origins: make(map[string]*sink.Origin)}
+	s, err := NewHTTPServer(context.Background(), "127.0.0.1:0", ingestor, durableLog{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.lis.Close()
+
+	body := `[
+		{"sensor": "numbered", "value": 1, "timestamp": 1, "node": "node-a", "seq": 4},
+		{"sensor": "plain", "value": 2, "timestamp": 1},
+		{"sensor": "bad-node", "value": 3, "timestamp": 1, "node": "` + strings.Repeat("n", 256) + `", "seq": 5}
+	]`
+	rec := <-post(s, body)
+
+	var result batchResultJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Accepted != 2 || result.Results[2].Error == "" || result.Results[2].Retryable {
+		t.Fatalf("result = %+v, want the reading with a bad node id rejected", result)
+	}
+
+	o := ingestor.origins["numbered"]
+	if o == nil || o.Node.String() != "node-a" || o.Seq != 4 {
+		t.Fatalf("origin = %+v, want node-a seq 4", o)
+	}
+	if o := ingestor.origins["plain"]; o != nil {
+		t.Fatalf("origin = %+v, want none", o)
+	}
+}
@@ -0,0 +1,190 @@
+// Package metrics implements the few Prometheus metric types the binaries need
+// and serves them in the Prometheus text exposition format.
+//
+// All instrument methods are safe on a nil receiver, so components can hold
+// instruments that are only set when metrics are enabled.
+package metrics
+
+import (
+	"math"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Metric is an instrument that can be registered with a Registry.
+type Metric interface {
+	kind() string
+	samples() []sample
+}
+
+// sample is one exposed value; suffix and le extend the family name and labels.
+type sample struct {
+	suffix string
+	le     string
+	value  float64
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) { f.bits.Store(math.Float64bits(v)) }
+func (f *atomicFloat) load() float64 { return math.Float64frombits(f.bits.Load()) }
+
+// Counter is a value that only goes up.
+type Counter struct {
+	v atomicFloat
+}
+
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add increases the counter; negative values are ignored.
+func (c *Counter) Add(v float64) {
+	if c == nil || v <= 0 {
+		return
+	}
+	c.v.add(v)
+}
+
+func (c *Counter) Value() float64 {
+	if c == nil {
+		return 0
+	}
+	return c.v.load()
+}
+
+func (c *Counter) kind() string      { return "counter" }
+func (c *Counter) samples() []sample { return []sample{{value: c.Value()}} }
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	v atomicFloat
+}
+
+func NewGauge() *Gauge {
+	return &Gauge{}
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) Add(v float64) {
+	if g == nil {
+		return
+	}
+	g.v.add(v)
+}
+
+func (g *Gauge) Set(v float64) {
+	if g == nil {
+		return
+	}
+	g.v.set(v)
+}
+
+func (g *Gauge) Value() float64 {
+	if g == nil {
+		return 0
+	}
+	return g.v.load()
+}
+
+func (g *Gauge) kind() string      { return "gauge" }
+func (g *Gauge) samples() []sample { return []sample{{value: g.Value()}} }
+
+// CounterFunc exposes a counter kept elsewhere, read on every scrape.
+type CounterFunc func() float64
+
+func (f CounterFunc) kind() string      { return "counter" }
+func (f CounterFunc) samples() []sample { return []sample{{value: f()}} }
+
+// GaugeFunc exposes a gauge kept elsewhere, read on every scrape.
+type GaugeFunc func() float64
+
+func (f GaugeFunc) kind() string      { return "gauge" }
+func (f GaugeFunc) samples() []sample { return []sample{{value: f()}} }
+
+// Histogram counts observations into buckets by upper bound.
+type Histogram struct {
+	bounds []float64
+	counts []atomic.Uint64 // per bucket, the last one is +Inf
+	sum    atomicFloat
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	bounds = slices.Clone(bounds)
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	if h == nil {
+		return
+	}
+	i, _ := slices.BinarySearch(h.bounds, v)
+	h.counts[i].Add(1)
+	h.sum.add(v)
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) kind() string { return "histogram" }
+
+func (h *Histogram) samples() []sample {
+	out := make([]sample, 0, len(h.counts)+2)
+
+	// cumulative counts; the total is taken from the buckets so they agree
+	var total uint64
+	for i := range h.counts {
+		total += h.counts[i].Load()
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = formatFloat(h.bounds[i])
+		}
+		out = append(out, sample{suffix: "_bucket", le: le, value: float64(total)})
+	}
+
+	return append(out,
+		sample{suffix: "_sum", value: h.sum.load()},
+		sample{suffix: "_count", value: float64(total)},
+	)
+}
+
+// DurationBuckets suit latencies from a tenth of a millisecond to ten seconds.
+var DurationBuckets = []float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// ExponentialBuckets returns count bounds starting at start, each factor times the previous.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// family is every series registered under one metric name.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	series []series
+}
+
+type series struct {
+	labels string // rendered label pairs, without braces
+	metric Metric
+}
+
+// Registry holds named metrics and writes them in the Prometheus text format.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Register adds m under name. Labels are name/value pairs telling apart
+// series that share a name; all of them must be of the same kind.
+// It panics on a kind mismatch or a repeated label set, as both are programming errors.
+func (r *Registry) Register(name, help string, m Metric, labels ...string) {
+	if len(labels)%2 != 0 {
+		panic(fmt.Sprintf("metrics: odd label list for %s", name))
+	}
+
+	var pairs []string
+	for i := 0; i < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+	}
+	rendered := strings.Join(pairs, ",")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: m.kind()}
+		r.families[name] = f
+	}
+	if f.kind != m.kind() {
+		panic(fmt.Sprintf("metrics: %s registered as %s and %s", name, f.kind, m.kind()))
+	}
+	if slices.ContainsFunc(f.series, func(s series) bool { return s.labels == rendered }) {
+		panic(fmt.Sprintf("metrics: %s{%s} registered twice", name, rendered))
+	}
+
+	f.series = append(f.series, series{labels: rendered, metric: m})
+}
+
+// WriteTo writes every metric, sorted by name, in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, family{
+			name:   f.name,
+			help:   f.help,
+			kind:   f.kind,
+			series: slices.Clone(f.series),
+		})
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(families, func(a, b family) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	for _, f := range families {
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.kind)
+
+		for _, s := range f.series {
+			for _, smp := range s.metric.samples() {
+				bw.WriteString(f.name + smp.suffix)
+
+				labels := s.labels
+				if smp.le != "" {
+					if labels != "" {
+						labels += ","
+					}
+					labels += `le="` + smp.le + `"`
+				}
+				if labels != "" {
+					bw.WriteString("{" + labels + "}")
+				}
+
+				bw.WriteString(" " + formatFloat(smp.value) + "\n")
+			}
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry to Prometheus scrapes.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+func escapeHelp(v string) string  { return helpEscaper.Replace(v) }
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerExposition(t *testing.T) {
+	reg := NewRegistry()
+
+	requests := NewCounter()
+	requests.Add(3)
+	reg.Register("app_requests_total", "Requests served.", requests)
+
+	queue := NewGauge()
+	queue.Set(7)
+	queue.Dec()
+	reg.Register("app_queue_depth", "Items waiting.\nEscaped \\ help.", queue)
+
+	reg.Register("app_rejected_total", "Rejected items by reason.",
+		CounterFunc(func() float64 { return 2 }), "reason", "unknown")
+	reg.Register("app_rejected_total", "Rejected items by reason.",
+		CounterFunc(func() float64 { return 0.5 }), "reason", `say "no"`)
+
+	latency := NewHistogram([]float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(2)
+	reg.Register("app_latency_seconds", "Request latency.", latency, "route", "/x")
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("content type = %q", got)
+	}
+
+	// families sorted by name, series in the order they were registered
+	want := `# HELP app_latency_seconds Request latency.
+# TYPE app_latency_seconds histogram
+app_latency_seconds_bucket{route="/x",le="0.1"} 1
+app_latency_seconds_bucket{route="/x",le="1"} 2
+app_latency_seconds_bucket{route="/x",le="+Inf"} 3
+app_latency_seconds_sum{route="/x"} 2.55
+app_latency_seconds_count{route="/x"} 3
+# HELP app_queue_depth Items waiting.\nEscaped \\ help.
+# TYPE app_queue_depth gauge
+app_queue_depth 6
+# HELP app_rejected_total Rejected items by reason.
+# TYPE app_rejected_total counter
+app_rejected_total{reason="unknown"} 2
+app_rejected_total{reason="say \"no\""} 0.5
+# HELP app_requests_total Requests served.
+# TYPE app_requests_total counter
+app_requests_total 3
+`
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("scraped:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegisterPanicsOnKindMismatch(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("app_items", "Items.", NewCounter(), "kind", "a")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registered a gauge under a counter's name")
+		}
+	}()
+	reg.Register("app_items", "Items.", NewGauge(), "kind", "b")
+}
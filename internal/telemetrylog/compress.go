@@ -0,0 +1,121 @@
+package telemetrylog
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Codec is the payload compression codec.
+// The codec of every record is stored in the low bits of the header flags byte,
+// so a log may freely mix compressed and uncompressed records.
+type Codec string
+
+const (
+	CodecNone  Codec = "none"
+	CodecFlate Codec = "flate"
+)
+
+// header flags
+const (
+	flagCodecMask  uint8 = 0x03
+	flagCodecNone  uint8 = 0x00
+	flagCodecFlate uint8 = 0x01
+
+	flagMarks uint8 = 0x04 // raw payload starts with node marks, see marks.go
+	flagMeta  uint8 = 0x08 // raw payload has sensor metadata after the marks, see meta.go
+	flagSeqs  uint8 = 0x10 // raw payload has node sequence numbers before the events, see seqs.go
+)
+
+func (c Codec) validate() error {
+	switch c {
+	case CodecNone, CodecFlate:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression codec: %q", c)
+	}
+}
+
+func (c Codec) flag() uint8 {
+	if c == CodecFlate {
+		return flagCodecFlate
+	}
+	return flagCodecNone
+}
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// compress encodes payload with the codec and returns the header flags to store.
+// Payloads that do not shrink are stored uncompressed.
+func compress(codec Codec, payload []byte) ([]byte, uint8, error) {
+	if codec != CodecFlate {
+		return payload, flagCodecNone, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(payload) / 2)
+
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+
+	if _, err := w.Write(payload); err != nil {
+		return nil, 0, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, 0, err
+	}
+
+	if buf.Len() >= len(payload) {
+		return payload, flagCodecNone, nil
+	}
+	return buf.Bytes(), codec.flag(), nil
+}
+
+// decompress returns the raw payload of a record according to its header flags.
+func decompress(hdr recordHeader, payload []byte) ([]byte, error) {
+	switch hdr.flags & flagCodecMask {
+	case flagCodecNone:
+		return payload, nil
+	case flagCodecFlate:
+		r := flate.NewReader(bytes.NewReader(payload))
+		defer r.Close()
+
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			return nil, ErrCorruptLog
+		}
+		return raw, nil
+	default:
+		return nil, ErrCorruptLog
+	}
+}
+
+// Stats holds cumulative payload sizes written by the log since Open.
+type Stats struct {
+	RawBytes    int64 // marshaled payload bytes before compression
+	StoredBytes int64 // payload bytes written to disk
+}
+
+// Ratio returns the achieved compression ratio (raw / stored).
+func (s Stats) Ratio() float64 {
+	if s.StoredBytes == 0 {
+		return 1
+	}
+	return float64(s.RawBytes) / float64(s.StoredBytes)
+}
+
+// Stats returns the cumulative payload sizes written since Open.
+func (tl *TelemetryLog) Stats() Stats {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	return tl.stats
+}
@@ -0,0 +1,160 @@
+package telemetrylog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SyncMode selects when appended batches are fsynced.
+type SyncMode string
+
+const (
+	// SyncAlways fsyncs every batch before Append returns.
+	SyncAlways SyncMode = "always"
+	// SyncInterval fsyncs periodically, covering every batch appended since the last sync.
+	SyncInterval SyncMode = "interval"
+	// SyncNone leaves flushing to the OS. Segments are still fsynced on rotation and Close.
+	SyncNone SyncMode = "none"
+)
+
+func (m SyncMode) validate() error {
+	switch m {
+	case SyncAlways, SyncInterval, SyncNone:
+		return nil
+	default:
+		return fmt.Errorf("unsupported sync mode: %q", m)
+	}
+}
+
+// Sync fsyncs everything appended so far.
+// Appends are not blocked while the fsync is in flight.
+func (tl *TelemetryLog) Sync() error {
+	tl.mu.Lock()
+	if tl.closed {
+		tl.mu.Unlock()
+		return ErrLogClosed
+	}
+	if tl.err != nil {
+		err := tl.err
+		tl.mu.Unlock()
+		return err
+	}
+	target := tl.seq
+	if tl.durable >= target {
+		tl.mu.Unlock()
+		return nil
+	}
+	f := tl.active.f
+	tl.mu.Unlock()
+
+	err := tl.fsync(f)
+
+	// the segment was sealed or the log closed meanwhile; both fsync before closing
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	if err != nil {
+		// a failed fsync may have dropped dirty pages; nothing appended since is trustworthy
+		tl.err = err
+		tl.broadcast()
+		return err
+	}
+	tl.markDurable(target)
+
+	return nil
+}
+
+// WaitDurable blocks until the batch with the given seq is fsynced,
+// the context is done, or the log is closed.
+// In SyncNone mode it forces an fsync instead of waiting for one.
+func (tl *TelemetryLog) WaitDurable(ctx context.Context, seq uint64) error {
+	for {
+		tl.mu.Lock()
+		if tl.durable > seq {
+			tl.mu.Unlock()
+			return nil
+		}
+		if tl.err != nil {
+			err := tl.err
+			tl.mu.Unlock()
+			return err
+		}
+		if tl.closed {
+			tl.mu.Unlock()
+			return ErrLogClosed
+		}
+		appended := seq < tl.seq
+		changed := tl.changed
+		tl.mu.Unlock()
+
+		if appended && tl.cfg.SyncMode == SyncNone {
+			if err := tl.Sync(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// DurableSeq returns the seq of the first batch that is not yet fsynced.
+func (tl *TelemetryLog) DurableSeq() uint64 {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	return tl.durable
+}
+
+// Err returns the fsync failure that stopped the log from accepting appends, if any,
+// or ErrLogClosed once the log is closed.
+func (tl *TelemetryLog) Err() error {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	if tl.closed {
+		return ErrLogClosed
+	}
+	return tl.err
+}
+
+// markDurable advances the durable watermark. The caller must hold tl.mu.
+func (tl *TelemetryLog) markDurable(seq uint64) {
+	if seq <= tl.durable {
+		return
+	}
+	tl.durable = seq
+	tl.broadcast()
+}
+
+// broadcast wakes up every WaitDurable and TailReader caller. The caller must hold tl.mu.
+func (tl *TelemetryLog) broadcast() {
+	close(tl.changed)
+	tl.changed = make(chan struct{})
+}
+
+// syncLoop implements group commit for SyncInterval mode.
+func (tl *TelemetryLog) syncLoop() {
+	defer close(tl.done)
+
+	ticker := time.NewTicker(tl.cfg.SyncInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// fsync errors are kept in tl.err and returned by the next Append
+		if err := tl.Sync(); errors.Is(err, ErrLogClosed) {
+			return
+		}
+	}
+}
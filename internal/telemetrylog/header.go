@@ -44,7 +44,11 @@ func decodeHeader(buf []byte) (recordHeader, error) {
 
 	copy(h.reserved[:], buf[offReserved:offReserved+reservedLen])
 
-	if h.version != formatVer {
+	if h.version != formatV1 && h.version != formatV2 {
+		return recordHeader{}, ErrCorruptLog
+	}
+
+	if h.flags&^(flagCodecMask|flagMarks|flagMeta|flagSeqs) != 0 {
 		return recordHeader{}, ErrCorruptLog
 	}
 
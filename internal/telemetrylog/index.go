@@ -0,0 +1,224 @@
+package telemetrylog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// Every segment has a sidecar sparse index. An entry is written for each span
+// of roughly indexInterval bytes of records and maps the span to its file offsets,
+// sequence range and event time range. The index is a hint: it is rebuilt from
+// the segment whenever it is missing or does not match the segment.
+const (
+	indexExt      = ".idx"
+	indexEntryLen = 48
+
+	defaultIndexInterval = 4 << 10
+)
+
+// indexEntry covers records with firstSeq <= seq < nextSeq stored in [offset, end).
+// minTs/maxTs bound the event timestamps (unix nanos) of those records.
+type indexEntry struct {
+	firstSeq uint64
+	nextSeq  uint64
+	offset   int64
+	end      int64
+	minTs    int64
+	maxTs    int64
+}
+
+func (e indexEntry) encode(buf []byte) {
+	binary.LittleEndian.PutUint64(buf[0:], e.firstSeq)
+	binary.LittleEndian.PutUint64(buf[8:], e.nextSeq)
+	binary.LittleEndian.PutUint64(buf[16:], uint64(e.offset))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(e.end))
+	binary.LittleEndian.PutUint64(buf[32:], uint64(e.minTs))
+	binary.LittleEndian.PutUint64(buf[40:], uint64(e.maxTs))
+}
+
+func decodeIndexEntry(buf []byte) indexEntry {
+	return indexEntry{
+		firstSeq: binary.LittleEndian.Uint64(buf[0:]),
+		nextSeq:  binary.LittleEndian.Uint64(buf[8:]),
+		offset:   int64(binary.LittleEndian.Uint64(buf[16:])),
+		end:      int64(binary.LittleEndian.Uint64(buf[24:])),
+		minTs:    int64(binary.LittleEndian.Uint64(buf[32:])),
+		maxTs:    int64(binary.LittleEndian.Uint64(buf[40:])),
+	}
+}
+
+func indexPath(segmentPath string) string {
+	return strings.TrimSuffix(segmentPath, segmentExt) + indexExt
+}
+
+// readIndex loads the index of a segment holding segSize bytes.
+// Only the consistent prefix of entries that lies within segSize is returned.
+func readIndex(segmentPath string, segSize int64) ([]indexEntry, error) {
+	buf, err := os.ReadFile(indexPath(segmentPath))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]indexEntry, 0, len(buf)/indexEntryLen)
+	var prevEnd int64
+	for i := 0; i+indexEntryLen <= len(buf); i += indexEntryLen {
+		e := decodeIndexEntry(buf[i : i+indexEntryLen])
+		if e.offset != prevEnd || e.end <= e.offset || e.end > segSize {
+			break
+		}
+		entries = append(entries, e)
+		prevEnd = e.end
+	}
+
+	return entries, nil
+}
+
+// indexIsCurrent reports whether the index of a sealed segment covers all of it.
+func indexIsCurrent(segmentPath string, segSize int64) bool {
+	entries, err := readIndex(segmentPath, segSize)
+	if err != nil {
+		return false
+	}
+	if len(entries) == 0 {
+		return segSize == 0
+	}
+	return entries[len(entries)-1].end == segSize
+}
+
+// indexWriter accumulates records into spans and appends an entry per span.
+type indexWriter struct {
+	f        *os.File
+	interval int64
+	span     indexEntry
+	pending  bool
+}
+
+// createIndex starts an empty index for the segment, replacing any existing one.
+func createIndex(segmentPath string, interval int64) (*indexWriter, error) {
+	f, err := os.OpenFile(indexPath(segmentPath), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = defaultIndexInterval
+	}
+	return &indexWriter{f: f, interval: interval}, nil
+}
+
+// add registers the record with the given seq stored at [offset, offset+length).
+func (w *indexWriter) add(seq uint64, offset, length int64, minTs, maxTs int64) error {
+	if !w.pending {
+		w.span = indexEntry{
+			firstSeq: seq,
+			offset:   offset,
+			minTs:    math.MaxInt64,
+			maxTs:    math.MinInt64,
+		}
+		w.pending = true
+	}
+
+	w.span.nextSeq = seq + 1
+	w.span.end = offset + length
+	w.span.minTs = min(w.span.minTs, minTs)
+	w.span.maxTs = max(w.span.maxTs, maxTs)
+
+	if w.span.end-w.span.offset >= w.interval {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush writes the pending span, if any.
+func (w *indexWriter) flush() error {
+	if !w.pending {
+		return nil
+	}
+
+	var buf [indexEntryLen]byte
+	w.span.encode(buf[:])
+	if _, err := w.f.Write(buf[:]); err != nil {
+		return err
+	}
+
+	w.pending = false
+	return nil
+}
+
+// close flushes the pending span and closes the file.
+// Sealed segments sync their index so it survives a crash.
+func (w *indexWriter) close(sync bool) error {
+	err := w.flush()
+	if err == nil && sync {
+		err = w.f.Sync()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// buildIndex rewrites the index of a sealed segment from its records.
+func buildIndex(info segmentInfo, interval int64) error {
+	f, err := os.Open(info.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := stat.Size()
+
+	w, err := createIndex(info.path, interval)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for offset < size {
+		hdr, payload, err := readRecord(f, offset, size)
+		if err != nil {
+			if errors.Is(err, ErrPartialBatch) || errors.Is(err, ErrCorruptLog) {
+				break
+			}
+			w.close(false)
+			return err
+		}
+
+		minTs, maxTs := payloadTimeRange(hdr, payload)
+		if err := w.add(hdr.seq, offset, recordLen(hdr), minTs, maxTs); err != nil {
+			w.close(false)
+			return err
+		}
+
+		offset += recordLen(hdr)
+	}
+
+	return w.close(true)
+}
+
+// payloadTimeRange returns the event time range of an encoded batch.
+// A payload that cannot be decoded is indexed like an empty batch.
+func payloadTimeRange(hdr recordHeader, payload []byte) (int64, int64) {
+	events, _ := decodePayload(hdr, payload)
+	return eventTimeRange(events)
+}
+
+// eventTimeRange returns the min and max event timestamps in unix nanos.
+// An empty batch yields an inverted range that never matches a time seek.
+func eventTimeRange(events []domain.Telemetry) (int64, int64) {
+	minTs, maxTs := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, e := range events {
+		ts := e.Timestamp.Time().UnixNano()
+		minTs = min(minTs, ts)
+		maxTs = max(maxTs, ts)
+	}
+	return minTs, maxTs
+}
@@ -0,0 +1,142 @@
+package telemetrylog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// SegmentSummary describes the contents of one segment file.
+type SegmentSummary struct {
+	Path    string
+	BaseSeq uint64
+	Size    int64
+
+	Batches    int
+	Events     int
+	Compressed int
+	Versions   map[uint8]int // batches per payload format version
+
+	FirstSeq     uint64
+	NextSeq      uint64
+	MinEventTime time.Time
+	MaxEventTime time.Time
+
+	// ValidBytes is the length of the prefix made of intact records.
+	// When it is less than Size, Err tells what stopped the scan at that offset.
+	ValidBytes int64
+	Err        error
+}
+
+// Intact reports whether every byte of the segment belongs to a valid record.
+func (s SegmentSummary) Intact() bool {
+	return s.Err == nil
+}
+
+// PartialTail reports whether the segment only ends in an incomplete record,
+// which is expected for the active segment of a running sink.
+func (s SegmentSummary) PartialTail() bool {
+	return errors.Is(s.Err, ErrPartialBatch)
+}
+
+// InspectSegments scans every segment in dir, validating each record's CRC and payload.
+// It only reads files and never truncates, so it is safe on a log a sink has open.
+func InspectSegments(dir string) ([]SegmentSummary, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]SegmentSummary, 0, len(segments))
+	for _, s := range segments {
+		summary, err := inspectSegment(s)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+func inspectSegment(info segmentInfo) (SegmentSummary, error) {
+	summary := SegmentSummary{
+		Path:     info.path,
+		BaseSeq:  info.baseSeq,
+		FirstSeq: info.baseSeq,
+		NextSeq:  info.baseSeq,
+		Versions: make(map[uint8]int),
+	}
+
+	f, err := os.Open(info.path)
+	if err != nil {
+		return summary, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return summary, err
+	}
+	summary.Size = stat.Size()
+
+	var offset int64
+	for offset < summary.Size {
+		hdr, payload, err := readRecord(f, offset, summary.Size)
+		if err != nil {
+			if !isDataError(err) {
+				return summary, err
+			}
+			summary.Err = err
+			break
+		}
+
+		events, err := decodePayload(hdr, payload)
+		if err != nil {
+			// CRC matched, but the payload cannot be decoded
+			summary.Err = err
+			break
+		}
+
+		summary.add(hdr, events)
+		offset += recordLen(hdr)
+	}
+
+	summary.ValidBytes = offset
+	return summary, nil
+}
+
+func (s *SegmentSummary) add(hdr recordHeader, events []domain.Telemetry) {
+	if s.Batches == 0 {
+		s.FirstSeq = hdr.seq
+	}
+	s.NextSeq = hdr.seq + 1
+	s.Batches++
+	s.Events += len(events)
+	s.Versions[hdr.version]++
+	if hdr.flags&flagCodecMask != flagCodecNone {
+		s.Compressed++
+	}
+
+	for _, e := range events {
+		t := e.Timestamp.Time()
+		if s.MinEventTime.IsZero() || t.Before(s.MinEventTime) {
+			s.MinEventTime = t
+		}
+		if t.After(s.MaxEventTime) {
+			s.MaxEventTime = t
+		}
+	}
+}
+
+// isDataError reports whether err describes bad log contents rather than an I/O failure.
+// A file that shrinks under the reader shows up as EOF.
+func isDataError(err error) bool {
+	return errors.Is(err, ErrPartialBatch) ||
+		errors.Is(err, ErrCorruptLog) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,74 @@
+package telemetrylog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// legacySuffix names a single-file log while it is moved into its directory.
+const legacySuffix = ".legacy"
+
+// migrateLegacy turns a log written before segments, a single file at path,
+// into a directory at path holding the file as its first segment.
+// The records are the same, so the file is moved, not rewritten.
+// A migration interrupted by a crash is finished on the next call.
+func migrateLegacy(path string) error {
+	moving := path + legacySuffix
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.Mode().IsRegular():
+		if err := os.Rename(path, moving); err != nil {
+			return err
+		}
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return err
+		}
+	case err == nil, errors.Is(err, os.ErrNotExist):
+		if _, err := os.Stat(moving); errors.Is(err, os.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+
+	base, err := legacyBaseSeq(moving)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return err
+	}
+	if err := os.Rename(moving, filepath.Join(path, segmentName(base))); err != nil {
+		return err
+	}
+	if err := syncDir(path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// legacyBaseSeq returns the seq of the first record of a single-file log, 0 if it has none.
+func legacyBaseSeq(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	hdr, _, err := readRecord(f, 0, info.Size())
+	if err != nil {
+		// recovery truncates whatever is unreadable once the file is the active segment
+		return 0, nil
+	}
+	return hdr.seq, nil
+}
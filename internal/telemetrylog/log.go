@@ -0,0 +1,523 @@
+package telemetrylog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+	"github.com/kvoloboi/telemetry/internal/metrics"
+)
+
+const (
+	magicValue = 0x544C5942 // "TLYB"
+
+	// payload encodings, stored per record in the header version byte
+	formatV1  = 1 // row oriented
+	formatV2  = 2 // columnar, see marshal_v2.go
+	formatVer = formatV1
+
+	// field sizes
+	magicLen     = 4
+	versionLen   = 1
+	flagsLen     = 1
+	reservedLen  = 2
+	timestampLen = 8
+	seqLen       = 8
+	payloadLen   = 4
+
+	headerLen = magicLen +
+		versionLen +
+		flagsLen +
+		reservedLen +
+		timestampLen +
+		payloadLen +
+		seqLen
+
+	crcLen = 4
+)
+
+// header field offsets (little endian)
+const (
+	offMagic      = 0
+	offVersion    = offMagic + magicLen
+	offFlags      = offVersion + versionLen
+	offReserved   = offFlags + flagsLen
+	offTimestamp  = offReserved + reservedLen
+	offSeq        = offTimestamp + timestampLen
+	offPayloadLen = offSeq + seqLen
+)
+
+var (
+	ErrPartialBatch = errors.New("partial batch detected")
+	ErrLogClosed    = errors.New("telemetry log closed")
+	ErrTooLarge     = errors.New("batch too large")
+	ErrCorruptLog   = errors.New("log corruption detected")
+)
+
+// TelemetryBatch represents a batch of telemetry events
+type TelemetryBatch struct {
+	Seq       uint64
+	Timestamp time.Time // time the batch was appended
+	Events    []domain.Telemetry
+	Meta      map[string]domain.SensorMeta // registry metadata of the sensors, if appended with it
+}
+
+// Config controls segment rotation and durability of the log.
+// A zero rotation limit disables the corresponding rotation trigger.
+type Config struct {
+	// SegmentMaxBytes rolls the active segment over once the next record would exceed it.
+	SegmentMaxBytes int64
+	// SegmentMaxAge rolls the active segment over on the first append after it gets this old.
+	SegmentMaxAge time.Duration
+
+	// SyncMode selects when appended batches are fsynced.
+	SyncMode SyncMode
+	// SyncInterval is the group commit period for SyncInterval mode.
+	SyncInterval time.Duration
+
+	// IndexInterval is the approximate number of record bytes covered by one sparse index entry.
+	IndexInterval int64
+
+	// Compression is the codec used for new records.
+	Compression Codec
+
+	// FormatVersion is the payload encoding used for new records.
+	// Records of every supported version can be read regardless.
+	FormatVersion uint8
+
+	// StrictRecovery makes Open fail with ErrMidFileCorruption instead of
+	// truncating when intact records follow a corrupt one in the active segment.
+	// A torn record at the very end is still truncated.
+	StrictRecovery bool
+}
+
+func defaultConfig() Config {
+	return Config{
+		SegmentMaxBytes: 64 << 20,
+		SyncMode:        SyncAlways,
+		SyncInterval:    100 * time.Millisecond,
+		IndexInterval:   defaultIndexInterval,
+		Compression:     CodecNone,
+		FormatVersion:   formatVer,
+	}
+}
+
+// withDefaults fills unset fields from the default config.
+// Rotation limits are left alone since zero disables them.
+func (c Config) withDefaults() Config {
+	d := defaultConfig()
+	if c.SyncMode == "" {
+		c.SyncMode = d.SyncMode
+	}
+	if c.SyncInterval == 0 {
+		c.SyncInterval = d.SyncInterval
+	}
+	if c.IndexInterval == 0 {
+		c.IndexInterval = d.IndexInterval
+	}
+	if c.Compression == "" {
+		c.Compression = d.Compression
+	}
+	if c.FormatVersion == 0 {
+		c.FormatVersion = d.FormatVersion
+	}
+	return c
+}
+
+// TelemetryLog writes batches to a directory of numbered segments.
+// Appends are expected to come from a single writer;
+// Sync and WaitDurable may be called from any goroutine.
+type TelemetryLog struct {
+	dir string
+	cfg Config
+
+	mu      sync.Mutex
+	active  *segment
+	seq     uint64
+	durable uint64        // every batch with seq < durable is fsynced
+	changed chan struct{} // closed and replaced whenever seq or durable advances
+	err     error         // sticky fsync failure
+	stats   Stats
+	marks   map[MarkKey]HighWaterMark // of every batch, saved to the marks file on rotation
+	closed  bool
+	fsyncs  *metrics.Histogram
+
+	done chan struct{}
+}
+
+// Open opens or creates a WAL-style telemetry log in dir and recovers partial batches.
+// Only the last (active) segment is scanned; sealed segments are trusted as written.
+// A single-file log left at dir by an older sink becomes the first segment of the directory.
+func Open(dir string, config *Config) (*TelemetryLog, error) {
+	cfg := defaultConfig()
+	if config != nil {
+		cfg = config.withDefaults()
+	}
+
+	if err := cfg.SyncMode.validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Compression.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.FormatVersion != formatV1 && cfg.FormatVersion != formatV2 {
+		return nil, fmt.Errorf("unsupported format version: %d", cfg.FormatVersion)
+	}
+	if cfg.SyncMode == SyncInterval && cfg.SyncInterval <= 0 {
+		return nil, errors.New("sync interval must be > 0")
+	}
+
+	if err := migrateLegacy(dir); err != nil {
+		return nil, fmt.Errorf("migrate single-file log %s: %w", dir, err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tl := &TelemetryLog{
+		dir:     dir,
+		cfg:     cfg,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+		fsyncs:  metrics.NewHistogram(metrics.DurationBuckets),
+	}
+
+	if len(segments) == 0 {
+		seg, err := createSegment(dir, 0, cfg.IndexInterval)
+		if err != nil {
+			return nil, err
+		}
+		tl.active = seg
+	} else {
+		seg, err := openSegment(segments[len(segments)-1])
+		if err != nil {
+			return nil, err
+		}
+		tl.active = seg
+		tl.seq = seg.baseSeq
+
+		if err := tl.openTail(); err != nil {
+			seg.close(false)
+			return nil, err
+		}
+
+		if err := recoverIndexes(segments[:len(segments)-1], cfg.IndexInterval); err != nil {
+			seg.close(false)
+			return nil, err
+		}
+	}
+
+	if tl.marks, err = ReadMarks(dir); err != nil {
+		tl.active.close(false)
+		return nil, fmt.Errorf("read high-water marks: %w", err)
+	}
+
+	tl.durable = tl.seq
+
+	if cfg.SyncMode == SyncInterval {
+		go tl.syncLoop()
+	} else {
+		close(tl.done)
+	}
+
+	return tl, nil
+}
+
+// openTail recovers the active segment and prepares it for appends.
+// Its index is always rebuilt while scanning, since the scan reads every record anyway.
+func (tl *TelemetryLog) openTail() error {
+	index, err := createIndex(tl.active.path, tl.cfg.IndexInterval)
+	if err != nil {
+		return err
+	}
+	tl.active.index = index
+
+	// Recover partial batches and set seq to last batch + 1
+	if err := tl.recover(); err != nil && err != ErrPartialBatch {
+		return err
+	}
+
+	// Whatever survived may still sit in the page cache after a process crash
+	// in interval or none mode; persist it before it is reported as durable.
+	if err := tl.active.f.Sync(); err != nil {
+		return err
+	}
+
+	// Seek to end for appends
+	_, err = tl.active.f.Seek(0, io.SeekEnd)
+	return err
+}
+
+// recoverIndexes rebuilds the indexes of sealed segments that are missing or stale.
+func recoverIndexes(sealed []segmentInfo, interval int64) error {
+	for _, s := range sealed {
+		info, err := os.Stat(s.path)
+		if err != nil {
+			return err
+		}
+		if indexIsCurrent(s.path, info.Size()) {
+			continue
+		}
+		if err := buildIndex(s, interval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marks returns the high-water mark of each sensor of each node over every batch appended so far.
+func (tl *TelemetryLog) Marks() map[MarkKey]HighWaterMark {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	return maps.Clone(tl.marks)
+}
+
+// Dir returns the directory holding the log segments.
+func (tl *TelemetryLog) Dir() string {
+	return tl.dir
+}
+
+// Annotations are stored in a batch record next to its events.
+type Annotations struct {
+	// Marks are the highest node sequence numbers in the batch per sensor. Marks and
+	// ReadMarks recover them after a restart, even once retention removed the batch.
+	Marks []Mark
+	// Meta is the registry metadata of the batch's sensors by name,
+	// returned with the batch by the readers.
+	Meta map[string]domain.SensorMeta
+}
+
+// Append writes a batch: header + payload + CRC32.
+// It returns the seq assigned to the batch, which WaitDurable accepts.
+func (tl *TelemetryLog) Append(events []domain.Telemetry) (uint64, error) {
+	return tl.AppendAnnotated(events, Annotations{})
+}
+
+// AppendAnnotated writes a batch like Append, storing ann in the same record.
+func (tl *TelemetryLog) AppendAnnotated(events []domain.Telemetry, ann Annotations) (uint64, error) {
+	raw, err := encodePayload(tl.cfg.FormatVersion, events)
+	if err != nil {
+		return 0, err
+	}
+
+	seqs := hasSeqs(events)
+	if seqs {
+		raw = append(marshalSeqs(events), raw...)
+	}
+	if len(ann.Meta) > 0 {
+		raw = append(marshalMeta(ann.Meta), raw...)
+	}
+	if len(ann.Marks) > 0 {
+		prefix, err := marshalMarks(ann.Marks)
+		if err != nil {
+			return 0, err
+		}
+		raw = append(prefix, raw...)
+	}
+
+	payload, flags, err := compress(tl.cfg.Compression, raw)
+	if err != nil {
+		return 0, err
+	}
+	if len(ann.Marks) > 0 {
+		flags |= flagMarks
+	}
+	if len(ann.Meta) > 0 {
+		flags |= flagMeta
+	}
+	if seqs {
+		flags |= flagSeqs
+	}
+
+	if len(payload) > math.MaxUint32 {
+		return 0, ErrTooLarge
+	}
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	if tl.closed {
+		return 0, ErrLogClosed
+	}
+	if tl.err != nil {
+		return 0, tl.err
+	}
+
+	now := time.Now()
+
+	header := recordHeader{
+		magic:      magicValue,
+		version:    tl.cfg.FormatVersion,
+		flags:      flags,
+		reserved:   [2]byte{0, 0},
+		timestamp:  now.UnixNano(),
+		payloadLen: uint32(len(payload)),
+		seq:        tl.seq,
+	}
+
+	if tl.shouldRotate(recordLen(header), now) {
+		if err := tl.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	// single buffer allocation for header + payload + CRC
+	record := make([]byte, headerLen+len(payload)+crcLen)
+	header.encode(record[:headerLen])
+	copy(record[headerLen:], payload)
+
+	crc := crc32.ChecksumIEEE(record[:headerLen+len(payload)])
+	binary.LittleEndian.PutUint32(record[headerLen+len(payload):], crc)
+
+	if _, err := tl.active.f.Write(record); err != nil {
+		return 0, err
+	}
+
+	if tl.active.size == 0 {
+		tl.active.created = now
+	}
+	minTs, maxTs := eventTimeRange(events)
+	tl.active.indexRecord(tl.seq, tl.active.size, int64(len(record)), minTs, maxTs)
+	tl.active.size += int64(len(record))
+	seq := tl.seq
+	tl.seq++
+	addMarks(tl.marks, seq, ann.Marks)
+	tl.stats.RawBytes += int64(len(raw))
+	tl.stats.StoredBytes += int64(len(payload))
+
+	if tl.cfg.SyncMode == SyncAlways {
+		if err := tl.fsync(tl.active.f); err != nil {
+			tl.err = err
+			return 0, err
+		}
+		tl.markDurable(tl.seq)
+		return seq, nil
+	}
+
+	tl.broadcast()
+	return seq, nil
+}
+
+// Close syncs and closes the log
+func (tl *TelemetryLog) Close() error {
+	tl.mu.Lock()
+	if tl.closed {
+		tl.mu.Unlock()
+		return nil
+	}
+	tl.closed = true
+
+	err := tl.active.f.Sync()
+	if err == nil {
+		tl.markDurable(tl.seq)
+	}
+	if cerr := tl.active.close(false); err == nil {
+		err = cerr
+	}
+	// wake up waiters for batches that will never be appended
+	tl.broadcast()
+	tl.mu.Unlock()
+
+	<-tl.done
+	return err
+}
+
+// shouldRotate reports whether a record of recordLen bytes must go to a new segment.
+// An empty segment is never rotated, so oversized records still get written.
+func (tl *TelemetryLog) shouldRotate(recordLen int64, now time.Time) bool {
+	if tl.active.size == 0 {
+		return false
+	}
+	if tl.cfg.SegmentMaxBytes > 0 && tl.active.size+recordLen > tl.cfg.SegmentMaxBytes {
+		return true
+	}
+	if tl.cfg.SegmentMaxAge > 0 && now.Sub(tl.active.created) >= tl.cfg.SegmentMaxAge {
+		return true
+	}
+	return false
+}
+
+// rotate seals the active segment and starts a new one at the current seq.
+// Sealed segments are always fsynced, regardless of the sync mode,
+// so recovery only ever has to look at the tail.
+// The active segment is only closed once the new one exists, so a failed
+// creation leaves it usable and the next append tries again.
+func (tl *TelemetryLog) rotate() error {
+	if err := tl.fsync(tl.active.f); err != nil {
+		// a failed fsync may have dropped dirty pages; nothing appended since is trustworthy
+		tl.err = err
+		tl.broadcast()
+		return err
+	}
+	tl.markDurable(tl.seq)
+
+	// the sealed segments may be pruned from now on, their marks must not go with them
+	if err := writeMarksSnapshot(tl.dir, tl.seq, tl.marks); err != nil {
+		return err
+	}
+
+	seg, err := createSegment(tl.dir, tl.seq, tl.cfg.IndexInterval)
+	if err != nil {
+		return err
+	}
+
+	sealed := tl.active
+	tl.active = seg
+	return sealed.close(true)
+}
+
+// recover scans the active segment and truncates partial or corrupted batches
+func (tl *TelemetryLog) recover() error {
+	info, err := tl.active.f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := info.Size()
+	offset := int64(0)
+
+	for offset < size {
+		hdr, payload, err := readRecord(tl.active.f, offset, size)
+		if err != nil {
+			if tl.cfg.StrictRecovery {
+				if next, ok := findNextRecord(tl.active.f, offset, size); ok {
+					return fmt.Errorf("%w: %s: bad record at offset %d, intact record at offset %d",
+						ErrMidFileCorruption, tl.active.path, offset, next)
+				}
+			}
+			return tl.truncate(offset)
+		}
+
+		if offset == 0 {
+			tl.active.created = time.Unix(0, hdr.timestamp)
+		}
+
+		minTs, maxTs := payloadTimeRange(hdr, payload)
+		tl.active.indexRecord(hdr.seq, offset, recordLen(hdr), minTs, maxTs)
+		offset += recordLen(hdr)
+		tl.seq = hdr.seq + 1
+	}
+
+	tl.active.size = offset
+	return nil
+}
+
+func (tl *TelemetryLog) truncate(offset int64) error {
+	tl.active.size = offset
+	return tl.active.f.Truncate(offset)
+}
@@ -0,0 +1,232 @@
+package telemetrylog
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+func testEvents(t *testing.T, sensor string, values ...float64) []domain.Telemetry {
+	t.Helper()
+
+	base := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	events := make([]domain.Telemetry, len(values))
+	for i, v := range values {
+		e, err := domain.NewTelemetry(sensor, v, base.Add(time.Duration(i)*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[i] = e
+	}
+	return events
+}
+
+func readAll(t *testing.T, dir string) []TelemetryBatch {
+	t.Helper()
+
+	r, err := NewBatchReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var batches []TelemetryBatch
+	for {
+		batch, err := r.ReadBatch()
+		if errors.Is(err, io.EOF) {
+			return batches
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, batch)
+	}
+}
+
+func TestOpenMigratesSingleFileLog(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "build")
+
+	// a v1 segment has the records of the single-file log
+	tl, err := Open(dir, &Config{FormatVersion: formatV1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if _, err := tl.Append(testEvents(t, "temp", float64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := filepath.Join(root, "telemetry.wal")
+	if err := os.Rename(filepath.Join(dir, segmentName(0)), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	tl, err = Open(legacy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := tl.Append(testEvents(t, "temp", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if seq != 3 {
+		t.Fatalf("seq after migration = %d, want 3", seq)
+	}
+	if info, err := os.Stat(legacy); err != nil || !info.IsDir() {
+		t.Fatalf("log path is not a directory after migration: %v", err)
+	}
+
+	batches := readAll(t, legacy)
+	if len(batches) != 4 {
+		t.Fatalf("read %d batches, want 4", len(batches))
+	}
+	for i, b := range batches {
+		if b.Seq != uint64(i) || b.Events[0].Value.Float64() != float64(i) {
+			t.Fatalf("batch %d = seq %d value %v", i, b.Seq, b.Events[0].Value.Float64())
+		}
+	}
+}
+
+func TestOpenFinishesInterruptedMigration(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "build")
+
+	tl, err := Open(dir, &Config{FormatVersion: formatV1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tl.Append(testEvents(t, "temp", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// crashed after moving the file aside, before the directory was created
+	legacy := filepath.Join(root, "telemetry.wal")
+	if err := os.Rename(filepath.Join(dir, segmentName(0)), legacy+legacySuffix); err != nil {
+		t.Fatal(err)
+	}
+
+	tl, err = Open(legacy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(readAll(t, legacy)); got != 1 {
+		t.Fatalf("read %d batches, want 1", got)
+	}
+	if _, err := os.Stat(legacy + legacySuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("legacy file left behind: %v", err)
+	}
+}
+
+func TestRotateKeepsActiveSegmentWhenCreateFails(t *testing.T) {
+	dir := t.TempDir()
+
+	tl, err := Open(dir, &Config{SegmentMaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tl.Close()
+
+	if _, err := tl.Append(testEvents(t, "temp", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next segment cannot be created while its name is taken
+	blocker := filepath.Join(dir, segmentName(1))
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tl.Append(testEvents(t, "temp", 1)); err == nil {
+		t.Fatal("append succeeded although the segment could not be created")
+	}
+
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	seq, err := tl.Append(testEvents(t, "temp", 1))
+	if err != nil {
+		t.Fatalf("append after the failed rotation: %v", err)
+	}
+	if seq != 1 {
+		t.Fatalf("seq = %d, want 1", seq)
+	}
+	if err := tl.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(readAll(t, dir)); got != 2 {
+		t.Fatalf("read %d batches, want 2", got)
+	}
+}
+
+func TestAnnotationsRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	tl, err := Open(dir, &Config{Compression: CodecFlate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := map[string]domain.SensorMeta{
+		"temp": {Room: "lab", Type: domain.SensorTypeVoltage},
+	}
+	if _, err := tl.Append(testEvents(t, "temp", 1)); err != nil {
+		t.Fatal(err)
+	}
+	events := testEvents(t, "temp", 2, 3)
+	events[0].Seq, events[1].Seq = 6, 7
+	if _, err := tl.AppendAnnotated(events, Annotations{
+		Marks: []Mark{{Node: "node-a", Sensor: "temp", Seq: 7}},
+		Meta:  meta,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tl.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	batches := readAll(t, dir)
+	if len(batches) != 2 {
+		t.Fatalf("read %d batches, want 2", len(batches))
+	}
+	if batches[0].Meta != nil || batches[0].Events[0].Seq != 0 {
+		t.Fatalf("batch 0 = %+v, want no meta and no seqs", batches[0])
+	}
+	got := batches[1]
+	if len(got.Events) != 2 || got.Events[1].Value.Float64() != 3 {
+		t.Fatalf("batch 1 events = %+v", got.Events)
+	}
+	if got.Events[0].Seq != 6 || got.Events[1].Seq != 7 {
+		t.Fatalf("batch 1 seqs = %d and %d, want 6 and 7", got.Events[0].Seq, got.Events[1].Seq)
+	}
+	if len(got.Meta) != 1 || got.Meta["temp"] != meta["temp"] {
+		t.Fatalf("batch 1 meta = %+v, want %+v", got.Meta, meta)
+	}
+
+	marks, err := ReadMarks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := marks[MarkKey{Node: "node-a", Sensor: "temp"}]; m.Seq != 7 || m.Batch != 1 {
+		t.Fatalf("node-a temp mark = %+v, want seq 7 in batch 1", m)
+	}
+}
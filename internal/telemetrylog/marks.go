@@ -0,0 +1,253 @@
+package telemetrylog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// marksFileName is the file next to the segments that carries the high-water
+// marks of every batch below its Next across retention, which removes the
+// segments holding them. It is rewritten on every rotation.
+const marksFileName = "marks.json"
+
+// MarkKey is what high-water marks are kept for: the readings of one sensor
+// of one node, which the node delivers in sequence order.
+type MarkKey struct {
+	Node   string
+	Sensor string
+}
+
+// Mark is the highest node sequence number a batch holds for one sensor of a node.
+// Records flagged with flagMarks start their raw payload with:
+//
+//	uvarint  mark count
+//	per mark: 1 byte length + node id, 1 byte length + sensor name, uvarint seq
+type Mark struct {
+	Node   string
+	Sensor string
+	Seq    uint64
+}
+
+// HighWaterMark is the highest sequence number the log holds for a sensor of a node.
+type HighWaterMark struct {
+	Seq   uint64
+	Batch uint64 // last batch holding a mark of the sensor
+}
+
+type marksSnapshot struct {
+	Next  uint64         `json:"next"` // the marks cover every batch below Next
+	Marks []markSnapshot `json:"marks"`
+}
+
+type markSnapshot struct {
+	Node   string `json:"node"`
+	Sensor string `json:"sensor"`
+	Seq    uint64 `json:"seq"`
+	Batch  uint64 `json:"batch"`
+}
+
+// addMarks merges the marks of batch into hwm.
+func addMarks(hwm map[MarkKey]HighWaterMark, batch uint64, marks []Mark) {
+	for _, m := range marks {
+		key := MarkKey{Node: m.Node, Sensor: m.Sensor}
+		h := hwm[key]
+		hwm[key] = HighWaterMark{Seq: max(h.Seq, m.Seq), Batch: batch}
+	}
+}
+
+func marshalMarks(marks []Mark) ([]byte, error) {
+	buf := binary.AppendUvarint(nil, uint64(len(marks)))
+	for _, m := range marks {
+		if len(m.Node) > domain.MaxNodeIDLen {
+			return nil, domain.ErrNodeIDTooLong
+		}
+		if len(m.Sensor) > domain.MaxSensorNameLen {
+			return nil, domain.ErrSensorNameTooLong
+		}
+		buf = append(buf, byte(len(m.Node)))
+		buf = append(buf, m.Node...)
+		buf = append(buf, byte(len(m.Sensor)))
+		buf = append(buf, m.Sensor...)
+		buf = binary.AppendUvarint(buf, m.Seq)
+	}
+	return buf, nil
+}
+
+// splitMarks returns the marks of a decompressed payload and the event payload following them.
+func splitMarks(hdr recordHeader, raw []byte) ([]Mark, []byte, error) {
+	if hdr.flags&flagMarks == 0 {
+		return nil, raw, nil
+	}
+
+	count, n := binary.Uvarint(raw)
+	if n <= 0 || count > uint64(len(raw)) {
+		return nil, nil, ErrPartialBatch
+	}
+	i := n
+
+	// readName reads a 1 byte length and the name following it
+	readName := func() (string, bool) {
+		if i >= len(raw) {
+			return "", false
+		}
+		l := int(raw[i])
+		i++
+		if i+l > len(raw) {
+			return "", false
+		}
+		name := string(raw[i : i+l])
+		i += l
+		return name, true
+	}
+
+	marks := make([]Mark, count)
+	for k := range marks {
+		var ok bool
+		if marks[k].Node, ok = readName(); !ok {
+			return nil, nil, ErrPartialBatch
+		}
+		if marks[k].Sensor, ok = readName(); !ok {
+			return nil, nil, ErrPartialBatch
+		}
+
+		seq, n := binary.Uvarint(raw[i:])
+		if n <= 0 {
+			return nil, nil, ErrPartialBatch
+		}
+		marks[k].Seq = seq
+		i += n
+	}
+
+	return marks, raw[i:], nil
+}
+
+// ReadMarks returns the high-water mark of each sensor of each node: those saved
+// in the marks file, and those of the batches after it, scanned from the segments.
+// Like recovery on Open, it stops at the first bad record of a segment.
+func ReadMarks(dir string) (map[MarkKey]HighWaterMark, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := readMarksSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hwm := make(map[MarkKey]HighWaterMark, len(snap.Marks))
+	for _, m := range snap.Marks {
+		hwm[MarkKey{Node: m.Node, Sensor: m.Sensor}] = HighWaterMark{Seq: m.Seq, Batch: m.Batch}
+	}
+	for i, s := range segments {
+		// the snapshot covers every batch of the segments before the one holding Next
+		if i+1 < len(segments) && segments[i+1].baseSeq <= snap.Next {
+			continue
+		}
+		if err := readSegmentMarks(s, snap.Next, hwm); err != nil {
+			return nil, err
+		}
+	}
+
+	return hwm, nil
+}
+
+// readMarksSnapshot reads the marks file of dir, or returns an empty snapshot if there is none.
+func readMarksSnapshot(dir string) (marksSnapshot, error) {
+	var snap marksSnapshot
+
+	data, err := os.ReadFile(filepath.Join(dir, marksFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return snap, nil
+	}
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snap, fmt.Errorf("parse %s: %w", marksFileName, err)
+	}
+	return snap, nil
+}
+
+// writeMarksSnapshot replaces the marks file of dir with hwm, the marks of every batch below next.
+// A crash leaves either the old or the new file.
+func writeMarksSnapshot(dir string, next uint64, hwm map[MarkKey]HighWaterMark) error {
+	snap := marksSnapshot{Next: next, Marks: make([]markSnapshot, 0, len(hwm))}
+	for k, h := range hwm {
+		snap.Marks = append(snap.Marks, markSnapshot{Node: k.Node, Sensor: k.Sensor, Seq: h.Seq, Batch: h.Batch})
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, marksFileName+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, marksFileName)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// readSegmentMarks merges the marks of the segment's batches, from batch first on, into hwm.
+func readSegmentMarks(info segmentInfo, first uint64, hwm map[MarkKey]HighWaterMark) error {
+	f, err := os.Open(info.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for offset < stat.Size() {
+		hdr, payload, err := readRecord(f, offset, stat.Size())
+		if err != nil {
+			if isDataError(err) {
+				return nil
+			}
+			return err
+		}
+		offset += recordLen(hdr)
+
+		if hdr.flags&flagMarks == 0 || hdr.seq < first {
+			continue
+		}
+
+		raw, err := decompress(hdr, payload)
+		if err != nil {
+			return nil
+		}
+		marks, _, err := splitMarks(hdr, raw)
+		if err != nil {
+			return nil
+		}
+		addMarks(hwm, hdr.seq, marks)
+	}
+
+	return nil
+}
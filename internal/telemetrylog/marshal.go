@@ -13,6 +13,60 @@ const (
 	valueLen  = 8
 )
 
+// encodePayload marshals events with the given format version.
+func encodePayload(version uint8, events []domain.Telemetry) ([]byte, error) {
+	if version == formatV1 {
+		return marshal(events)
+	}
+	return marshalV2(events)
+}
+
+// decodePayload decompresses and unmarshals the events of a record.
+func decodePayload(hdr recordHeader, payload []byte) ([]domain.Telemetry, error) {
+	batch, err := decodeBatch(hdr, payload)
+	return batch.Events, err
+}
+
+// decodeBatch decompresses and unmarshals a record into a batch.
+func decodeBatch(hdr recordHeader, payload []byte) (TelemetryBatch, error) {
+	batch := TelemetryBatch{Seq: hdr.seq, Timestamp: time.Unix(0, hdr.timestamp)}
+
+	raw, err := decompress(hdr, payload)
+	if err != nil {
+		return batch, err
+	}
+	_, raw, err = splitMarks(hdr, raw)
+	if err != nil {
+		return batch, err
+	}
+	batch.Meta, raw, err = splitMeta(hdr, raw)
+	if err != nil {
+		return batch, err
+	}
+	seqs, raw, err := splitSeqs(hdr, raw)
+	if err != nil {
+		return batch, err
+	}
+
+	if hdr.version == formatV1 {
+		batch.Events, err = unmarshal(raw)
+	} else {
+		batch.Events, err = unmarshalV2(raw)
+	}
+	if err != nil {
+		return batch, err
+	}
+	if seqs != nil {
+		if len(seqs) != len(batch.Events) {
+			return batch, ErrPartialBatch
+		}
+		for i := range batch.Events {
+			batch.Events[i].Seq = seqs[i]
+		}
+	}
+	return batch, nil
+}
+
 func marshal(events []domain.Telemetry) ([]byte, error) {
 	var size int
 	for _, e := range events {
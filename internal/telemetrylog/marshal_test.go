@@ -0,0 +1,124 @@
+package telemetrylog
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// benchEvents returns readings of a few sensors sampled at a steady rate,
+// the shape of a batch the sink receives from a node.
+func benchEvents(tb testing.TB, n int) []domain.Telemetry {
+	tb.Helper()
+
+	base := time.Date(2026, 2, 6, 12, 0, 0, 0, time.UTC)
+	sensors := []string{"temperature", "humidity", "pressure", "voltage"}
+
+	events := make([]domain.Telemetry, n)
+	for i := range events {
+		sensor := sensors[i%len(sensors)]
+		ts := base.Add(time.Duration(i/len(sensors)) * 100 * time.Millisecond)
+		v := 20 + math.Round(math.Sin(float64(i)/50)*100)/10
+
+		e, err := domain.NewTelemetry(sensor, v, ts)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		events[i] = e
+	}
+	return events
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	events := benchEvents(t, 100)
+
+	for _, version := range []uint8{formatV1, formatV2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			buf, err := encodePayload(version, events)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodePayload(recordHeader{version: version}, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(events) {
+				t.Fatalf("decoded %d events, want %d", len(got), len(events))
+			}
+			for i := range events {
+				if got[i].Sensor != events[i].Sensor ||
+					got[i].Value != events[i].Value ||
+					!got[i].Timestamp.Time().Equal(events[i].Timestamp.Time()) {
+					t.Fatalf("event %d = %+v, want %+v", i, got[i], events[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPayloadDecodeValidatesEvents(t *testing.T) {
+	// an empty sensor name cannot be built through domain.NewTelemetry
+	events := []domain.Telemetry{{
+		Value:     domain.NewValue(1),
+		Timestamp: domain.NewTimestamp(time.Unix(0, 0)),
+	}}
+
+	for _, version := range []uint8{formatV1, formatV2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			buf, err := encodePayload(version, events)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := decodePayload(recordHeader{version: version}, buf); err == nil {
+				t.Fatal("decoded an event without a sensor name")
+			}
+		})
+	}
+}
+
+func BenchmarkFormatV1(b *testing.B) {
+	benchmarkFormat(b, formatV1)
+}
+
+func BenchmarkFormatV2(b *testing.B) {
+	benchmarkFormat(b, formatV2)
+}
+
+// benchmarkFormat reports the encoded size per event and the encode and
+// decode throughput in events, for batches of 256 events.
+func benchmarkFormat(b *testing.B, version uint8) {
+	events := benchEvents(b, 256)
+
+	buf, err := encodePayload(version, events)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bytesPerEvent := float64(len(buf)) / float64(len(events))
+
+	b.Run("encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := encodePayload(version, events); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(bytesPerEvent, "B/event")
+		b.ReportMetric(float64(b.N*len(events))/b.Elapsed().Seconds(), "events/s")
+	})
+
+	b.Run("decode", func(b *testing.B) {
+		hdr := recordHeader{version: version}
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := decodePayload(hdr, buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(bytesPerEvent, "B/event")
+		b.ReportMetric(float64(b.N*len(events))/b.Elapsed().Seconds(), "events/s")
+	})
+}
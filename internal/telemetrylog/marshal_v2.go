@@ -0,0 +1,327 @@
+package telemetrylog
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// Format v2 stores a batch column by column:
+//
+//	uvarint  sensor dictionary size, then per sensor: 1 byte length + name
+//	uvarint  event count
+//	uvarint  sensor dictionary id, per event
+//	varint   timestamp, per event: first raw, second delta, then delta-of-delta
+//	bits     values, Gorilla XOR encoded
+//
+// Timestamps and values are encoded against the previous event of the same
+// sensor, so interleaved sensors keep their own regular series.
+
+// seriesState is the per-sensor encoder/decoder state.
+type seriesState struct {
+	n         int
+	ts        int64
+	delta     int64
+	value     uint64
+	leading   int
+	trailing  int
+	hasWindow bool
+}
+
+func marshalV2(events []domain.Telemetry) ([]byte, error) {
+	ids := make(map[string]uint64)
+	var names []string
+	sensorIDs := make([]uint64, len(events))
+
+	for i, e := range events {
+		name := e.Sensor.String()
+		id, ok := ids[name]
+		if !ok {
+			id = uint64(len(names))
+			ids[name] = id
+			names = append(names, name)
+		}
+		sensorIDs[i] = id
+	}
+
+	buf := make([]byte, 0, 16+len(events)*4)
+
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		buf = append(buf, byte(len(name)))
+		buf = append(buf, name...)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(events)))
+	for _, id := range sensorIDs {
+		buf = binary.AppendUvarint(buf, id)
+	}
+
+	series := make([]seriesState, len(names))
+
+	for i, e := range events {
+		s := &series[sensorIDs[i]]
+		ts := e.Timestamp.Time().UnixNano()
+
+		switch s.n {
+		case 0:
+			buf = binary.AppendVarint(buf, ts)
+		case 1:
+			s.delta = ts - s.ts
+			buf = binary.AppendVarint(buf, s.delta)
+		default:
+			delta := ts - s.ts
+			buf = binary.AppendVarint(buf, delta-s.delta)
+			s.delta = delta
+		}
+		s.ts = ts
+		s.n++
+	}
+
+	w := bitWriter{buf: buf}
+	for i := range series {
+		series[i].n = 0
+	}
+
+	for i, e := range events {
+		s := &series[sensorIDs[i]]
+		v := math.Float64bits(e.Value.Float64())
+
+		if s.n == 0 {
+			w.writeBits(v, 64)
+		} else {
+			writeXOR(&w, s, v)
+		}
+		s.value = v
+		s.n++
+	}
+
+	return w.bytes(), nil
+}
+
+// writeXOR appends v using Gorilla XOR compression against the previous value.
+func writeXOR(w *bitWriter, s *seriesState, v uint64) {
+	xor := v ^ s.value
+	if xor == 0 {
+		w.writeBit(false)
+		return
+	}
+	w.writeBit(true)
+
+	leading := min(bits.LeadingZeros64(xor), 31)
+	trailing := bits.TrailingZeros64(xor)
+
+	if s.hasWindow && leading >= s.leading && trailing >= s.trailing {
+		// meaningful bits fit into the previous window
+		w.writeBit(false)
+		w.writeBits(xor>>uint(s.trailing), 64-s.leading-s.trailing)
+		return
+	}
+
+	sig := 64 - leading - trailing
+	w.writeBit(true)
+	w.writeBits(uint64(leading), 5)
+	w.writeBits(uint64(sig-1), 6)
+	w.writeBits(xor>>uint(trailing), sig)
+
+	s.leading, s.trailing, s.hasWindow = leading, trailing, true
+}
+
+func unmarshalV2(buf []byte) ([]domain.Telemetry, error) {
+	i := 0
+
+	dictLen, n := binary.Uvarint(buf[i:])
+	if n <= 0 || dictLen > uint64(len(buf)) {
+		return nil, ErrPartialBatch
+	}
+	i += n
+
+	names := make([]string, dictLen)
+	for k := range names {
+		if i >= len(buf) {
+			return nil, ErrPartialBatch
+		}
+		nameLen := int(buf[i])
+		i += sensorLen
+		if i+nameLen > len(buf) {
+			return nil, ErrPartialBatch
+		}
+		names[k] = string(buf[i : i+nameLen])
+		i += nameLen
+	}
+
+	count, n := binary.Uvarint(buf[i:])
+	if n <= 0 || count > uint64(len(buf)) {
+		return nil, ErrPartialBatch
+	}
+	i += n
+
+	sensorIDs := make([]uint64, count)
+	for k := range sensorIDs {
+		id, n := binary.Uvarint(buf[i:])
+		if n <= 0 {
+			return nil, ErrPartialBatch
+		}
+		if id >= dictLen {
+			return nil, ErrCorruptLog
+		}
+		sensorIDs[k] = id
+		i += n
+	}
+
+	series := make([]seriesState, dictLen)
+	timestamps := make([]int64, count)
+
+	for k, id := range sensorIDs {
+		s := &series[id]
+		v, n := binary.Varint(buf[i:])
+		if n <= 0 {
+			return nil, ErrPartialBatch
+		}
+		i += n
+
+		switch s.n {
+		case 0:
+			s.ts = v
+		case 1:
+			s.delta = v
+			s.ts += s.delta
+		default:
+			s.delta += v
+			s.ts += s.delta
+		}
+		timestamps[k] = s.ts
+		s.n++
+	}
+
+	for k := range series {
+		series[k].n = 0
+	}
+
+	r := bitReader{buf: buf[i:]}
+	events := make([]domain.Telemetry, count)
+
+	for k, id := range sensorIDs {
+		s := &series[id]
+
+		var v uint64
+		var err error
+		if s.n == 0 {
+			v, err = r.readBits(64)
+		} else {
+			v, err = readXOR(&r, s)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.value = v
+		s.n++
+
+		event, err := domain.NewTelemetry(names[id], math.Float64frombits(v), time.Unix(0, timestamps[k]))
+		if err != nil {
+			return nil, err
+		}
+		events[k] = event
+	}
+
+	return events, nil
+}
+
+func readXOR(r *bitReader, s *seriesState) (uint64, error) {
+	changed, err := r.readBit()
+	if err != nil {
+		return 0, err
+	}
+	if !changed {
+		return s.value, nil
+	}
+
+	newWindow, err := r.readBit()
+	if err != nil {
+		return 0, err
+	}
+
+	if newWindow {
+		leading, err := r.readBits(5)
+		if err != nil {
+			return 0, err
+		}
+		sig, err := r.readBits(6)
+		if err != nil {
+			return 0, err
+		}
+		s.leading = int(leading)
+		s.trailing = 64 - s.leading - int(sig+1)
+		if s.trailing < 0 {
+			return 0, ErrCorruptLog
+		}
+		s.hasWindow = true
+	} else if !s.hasWindow {
+		return 0, ErrCorruptLog
+	}
+
+	meaningful, err := r.readBits(64 - s.leading - s.trailing)
+	if err != nil {
+		return 0, err
+	}
+	return s.value ^ (meaningful << uint(s.trailing)), nil
+}
+
+// bitWriter appends bits MSB first.
+type bitWriter struct {
+	buf  []byte
+	free int // unused bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << uint(w.free)
+	}
+}
+
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for n > 0 {
+		n--
+		w.writeBit(v>>uint(n)&1 == 1)
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	return w.buf
+}
+
+// bitReader reads bits MSB first.
+type bitReader struct {
+	buf []byte
+	pos int // bit position
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, ErrPartialBatch
+	}
+	bit := r.buf[r.pos/8]>>(7-uint(r.pos%8))&1 == 1
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(n int) (uint64, error) {
+	if r.pos+n > len(r.buf)*8 {
+		return 0, ErrPartialBatch
+	}
+
+	var v uint64
+	for ; n > 0; n-- {
+		v = v<<1 | uint64(r.buf[r.pos/8]>>(7-uint(r.pos%8))&1)
+		r.pos++
+	}
+	return v, nil
+}
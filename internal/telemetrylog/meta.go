@@ -0,0 +1,76 @@
+package telemetrylog
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// Records flagged with flagMeta carry the registry metadata of their sensors,
+// after the marks:
+//
+//	uvarint  sensor count
+//	per sensor: uvarint length + name, uvarint length + room, uvarint length + type
+func marshalMeta(meta map[string]domain.SensorMeta) []byte {
+	names := make([]string, 0, len(meta))
+	for name := range meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := binary.AppendUvarint(nil, uint64(len(names)))
+	for _, name := range names {
+		m := meta[name]
+		buf = appendString(buf, name)
+		buf = appendString(buf, m.Room)
+		buf = appendString(buf, string(m.Type))
+	}
+	return buf
+}
+
+// splitMeta returns the sensor metadata of a payload stripped of its marks,
+// and the event payload following it.
+func splitMeta(hdr recordHeader, raw []byte) (map[string]domain.SensorMeta, []byte, error) {
+	if hdr.flags&flagMeta == 0 {
+		return nil, raw, nil
+	}
+
+	count, n := binary.Uvarint(raw)
+	if n <= 0 || count > uint64(len(raw)) {
+		return nil, nil, ErrPartialBatch
+	}
+	raw = raw[n:]
+
+	meta := make(map[string]domain.SensorMeta, count)
+	for range count {
+		var name, room, sensorType string
+		var ok bool
+		if name, raw, ok = readString(raw); !ok {
+			return nil, nil, ErrPartialBatch
+		}
+		if room, raw, ok = readString(raw); !ok {
+			return nil, nil, ErrPartialBatch
+		}
+		if sensorType, raw, ok = readString(raw); !ok {
+			return nil, nil, ErrPartialBatch
+		}
+		meta[name] = domain.SensorMeta{Room: room, Type: domain.SensorType(sensorType)}
+	}
+
+	return meta, raw, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(buf []byte) (string, []byte, bool) {
+	l, n := binary.Uvarint(buf)
+	if n <= 0 || l > uint64(len(buf)-n) {
+		return "", nil, false
+	}
+	end := n + int(l)
+	return string(buf[n:end]), buf[end:], true
+}
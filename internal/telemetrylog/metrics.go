@@ -0,0 +1,26 @@
+package telemetrylog
+
+import (
+	"os"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/metrics"
+)
+
+// fsync syncs f and records how long it took.
+func (tl *TelemetryLog) fsync(f *os.File) error {
+	start := time.Now()
+	err := f.Sync()
+	tl.fsyncs.ObserveSince(start)
+	return err
+}
+
+// RegisterMetrics exposes the bytes written and fsync latency of the log.
+func (tl *TelemetryLog) RegisterMetrics(reg *metrics.Registry) {
+	reg.Register("telemetry_sink_wal_raw_bytes_total", "Payload bytes appended to the log before compression.",
+		metrics.CounterFunc(func() float64 { return float64(tl.Stats().RawBytes) }))
+	reg.Register("telemetry_sink_wal_stored_bytes_total", "Payload bytes written to the log.",
+		metrics.CounterFunc(func() float64 { return float64(tl.Stats().StoredBytes) }))
+	reg.Register("telemetry_sink_wal_fsync_duration_seconds", "Time to fsync the active segment.",
+		tl.fsyncs)
+}
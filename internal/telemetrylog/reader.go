@@ -0,0 +1,239 @@
+package telemetrylog
+
+import (
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// segmentSnapshot is a segment together with its size at reader creation.
+type segmentSnapshot struct {
+	segmentInfo
+	size int64
+}
+
+// BatchReader reads a snapshot of the log at open time.
+// Segments are visited in sequence order.
+// Appends and segments created after the reader are not visible.
+type BatchReader struct {
+	segments []segmentSnapshot
+	idx      int
+	minSeq   uint64 // batches below it are skipped
+
+	f      *os.File
+	offset int64
+	size   int64
+}
+
+func NewBatchReader(dir string) (*BatchReader, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make([]segmentSnapshot, 0, len(segments))
+	for _, s := range segments {
+		info, err := os.Stat(s.path)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = append(snapshot, segmentSnapshot{segmentInfo: s, size: info.Size()})
+	}
+
+	return &BatchReader{segments: snapshot}, nil
+}
+
+// NewBatchReaderFromSeq returns a reader whose first batch is the one with the given seq.
+// If seq was already pruned, reading starts at the oldest retained batch.
+func NewBatchReaderFromSeq(dir string, seq uint64) (*BatchReader, error) {
+	r, err := NewBatchReader(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.segments) == 0 {
+		return r, nil
+	}
+
+	// last segment starting at or before seq
+	i := sort.Search(len(r.segments), func(i int) bool {
+		return r.segments[i].baseSeq > seq
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	seg := r.segments[i]
+	var offset int64
+	if entries, err := readIndex(seg.path, seg.size); err == nil {
+		offset = seekIndexSeq(entries, seq)
+	}
+
+	r.minSeq = seq
+	if err := r.seek(i, offset); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewBatchReaderFromTime returns a reader positioned at the first batch that may
+// hold events at or after from. Batches are not split, so the first batches
+// returned can still contain older events; callers filter by event time.
+func NewBatchReaderFromTime(dir string, from time.Time) (*BatchReader, error) {
+	r, err := NewBatchReader(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := from.UnixNano()
+	for i, seg := range r.segments {
+		entries, err := readIndex(seg.path, seg.size)
+		if err != nil {
+			// no usable index, scan the whole segment
+			if err := r.seek(i, 0); err != nil {
+				return nil, err
+			}
+			return r, nil
+		}
+
+		if offset, ok := seekIndexTime(entries, ts, seg.size); ok {
+			if err := r.seek(i, offset); err != nil {
+				return nil, err
+			}
+			return r, nil
+		}
+	}
+
+	// nothing that recent, the reader is exhausted
+	r.idx = len(r.segments)
+	return r, nil
+}
+
+// seekIndexSeq returns the offset of the span holding seq, or the end of the
+// indexed region if seq lies beyond it.
+func seekIndexSeq(entries []indexEntry, seq uint64) int64 {
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].nextSeq > seq
+	})
+	if i < len(entries) {
+		return entries[i].offset
+	}
+	if len(entries) > 0 {
+		return entries[len(entries)-1].end
+	}
+	return 0
+}
+
+// seekIndexTime returns the offset of the first span with events at or after ts.
+// Records past the indexed region are unknown and always qualify.
+func seekIndexTime(entries []indexEntry, ts int64, segSize int64) (int64, bool) {
+	var covered int64
+	for _, e := range entries {
+		if e.maxTs >= ts {
+			return e.offset, true
+		}
+		covered = e.end
+	}
+	if covered < segSize {
+		return covered, true
+	}
+	return 0, false
+}
+
+// ReadBatch returns the next batch together with its sequence number.
+// It returns io.EOF once the snapshot is exhausted.
+func (r *BatchReader) ReadBatch() (TelemetryBatch, error) {
+	for {
+		hdr, payload, err := r.nextRecord()
+		if err != nil {
+			return TelemetryBatch{}, err
+		}
+		if hdr.seq < r.minSeq {
+			continue
+		}
+
+		batch, err := decodeBatch(hdr, payload)
+		if err != nil {
+			return TelemetryBatch{}, err
+		}
+		return batch, nil
+	}
+}
+
+func (r *BatchReader) Next() ([]domain.Telemetry, error) {
+	batch, err := r.ReadBatch()
+	if err != nil {
+		return nil, err
+	}
+	return batch.Events, nil
+}
+
+func (r *BatchReader) Close() error {
+	return r.closeSegment()
+}
+
+func (r *BatchReader) nextRecord() (recordHeader, []byte, error) {
+	for {
+		if r.f == nil {
+			if r.idx >= len(r.segments) {
+				return recordHeader{}, nil, io.EOF
+			}
+			if err := r.openSegment(r.segments[r.idx]); err != nil {
+				return recordHeader{}, nil, err
+			}
+		}
+
+		if r.offset < r.size {
+			break
+		}
+
+		// current segment exhausted, move on to the next one
+		if err := r.closeSegment(); err != nil {
+			return recordHeader{}, nil, err
+		}
+		r.idx++
+	}
+
+	hdr, payload, err := readRecord(r.f, r.offset, r.size)
+	if err != nil {
+		return recordHeader{}, nil, err
+	}
+
+	r.offset += recordLen(hdr)
+	return hdr, payload, nil
+}
+
+// seek positions the reader at offset within segment i.
+func (r *BatchReader) seek(i int, offset int64) error {
+	if err := r.closeSegment(); err != nil {
+		return err
+	}
+	r.idx = i
+	if err := r.openSegment(r.segments[i]); err != nil {
+		return err
+	}
+	r.offset = offset
+	return nil
+}
+
+func (r *BatchReader) openSegment(s segmentSnapshot) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.offset = 0
+	r.size = s.size
+	return nil
+}
+
+func (r *BatchReader) closeSegment() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
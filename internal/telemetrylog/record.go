@@ -0,0 +1,52 @@
+package telemetrylog
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+func recordLen(hdr recordHeader) int64 {
+	return int64(headerLen) + int64(hdr.payloadLen) + crcLen
+}
+
+// readRecord reads and validates the record at offset.
+// size is the number of readable bytes in r; a record crossing it is partial.
+func readRecord(r io.ReaderAt, offset, size int64) (recordHeader, []byte, error) {
+	if offset+headerLen+crcLen > size {
+		return recordHeader{}, nil, ErrPartialBatch
+	}
+
+	var hdrBuf [headerLen]byte
+	if _, err := r.ReadAt(hdrBuf[:], offset); err != nil {
+		return recordHeader{}, nil, err
+	}
+
+	hdr, err := decodeHeader(hdrBuf[:])
+	if err != nil {
+		return recordHeader{}, nil, err
+	}
+
+	if offset+recordLen(hdr) > size {
+		return recordHeader{}, nil, ErrPartialBatch
+	}
+
+	// payload and CRC are adjacent, read them at once
+	buf := make([]byte, int(hdr.payloadLen)+crcLen)
+	if _, err := r.ReadAt(buf, offset+headerLen); err != nil {
+		return recordHeader{}, nil, err
+	}
+	payload := buf[:hdr.payloadLen]
+	storedCRC := binary.LittleEndian.Uint32(buf[hdr.payloadLen:])
+
+	// streaming CRC check
+	crc := crc32.NewIEEE()
+	crc.Write(hdrBuf[:])
+	crc.Write(payload)
+
+	if crc.Sum32() != storedCRC {
+		return recordHeader{}, nil, ErrCorruptLog
+	}
+
+	return hdr, payload, nil
+}
@@ -0,0 +1,197 @@
+package telemetrylog
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// PruneReason tells which retention rule deleted a segment.
+type PruneReason string
+
+const (
+	PruneAcked PruneReason = "acked"
+	PruneAge   PruneReason = "age"
+	PruneSize  PruneReason = "size"
+)
+
+// RetentionPolicy decides which sealed segments may be deleted.
+// Zero fields disable the corresponding rule.
+// The active segment is never deleted.
+type RetentionPolicy struct {
+	// MaxBytes is the upper bound for the total size of all segments.
+	MaxBytes int64
+	// MaxAge deletes segments whose newest record header timestamp is older than this.
+	MaxAge time.Duration
+	// MinSeq is the lowest sequence number not yet acknowledged by consumers.
+	// Segments holding only records below it are deleted.
+	MinSeq uint64
+}
+
+// PrunedSegment describes a deleted segment.
+// It held records with FirstSeq <= seq < NextSeq.
+type PrunedSegment struct {
+	Path     string
+	FirstSeq uint64
+	NextSeq  uint64
+	Bytes    int64
+	Reason   PruneReason
+}
+
+// PruneReport lists the segments deleted by a single Prune call.
+type PruneReport struct {
+	Segments []PrunedSegment
+}
+
+// Bytes returns the total number of bytes reclaimed.
+func (r PruneReport) Bytes() int64 {
+	var n int64
+	for _, s := range r.Segments {
+		n += s.Bytes
+	}
+	return n
+}
+
+// Prune deletes sealed segments in dir that violate the policy.
+// Segments are removed oldest first and pruning stops at the first segment
+// that must be kept, so the log never has holes.
+//
+// Prune only touches sealed segments and may run concurrently with appends.
+func Prune(dir string, policy RetentionPolicy, now time.Time) (PruneReport, error) {
+	var report PruneReport
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return report, err
+	}
+
+	sizes := make([]int64, len(segments))
+	var total int64
+	for i, s := range segments {
+		info, err := os.Stat(s.path)
+		if err != nil {
+			return report, err
+		}
+		sizes[i] = info.Size()
+		total += sizes[i]
+	}
+
+	// the last segment is the active one
+	for i := 0; i < len(segments)-1; i++ {
+		seg, next := segments[i], segments[i+1]
+
+		reason, err := pruneReason(seg, next.baseSeq, total, policy, now)
+		if err != nil {
+			return report, err
+		}
+		if reason == "" {
+			break
+		}
+
+		if err := os.Remove(seg.path); err != nil {
+			return report, err
+		}
+		if err := os.Remove(indexPath(seg.path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return report, err
+		}
+
+		total -= sizes[i]
+		report.Segments = append(report.Segments, PrunedSegment{
+			Path:     seg.path,
+			FirstSeq: seg.baseSeq,
+			NextSeq:  next.baseSeq,
+			Bytes:    sizes[i],
+			Reason:   reason,
+		})
+	}
+
+	if len(report.Segments) > 0 {
+		if err := syncDir(dir); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// Usage returns the total size of the segments in dir, as Prune counts it against MaxBytes.
+func Usage(dir string) (int64, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, s := range segments {
+		info, err := os.Stat(s.path)
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+func pruneReason(
+	seg segmentInfo,
+	nextSeq uint64,
+	total int64,
+	policy RetentionPolicy,
+	now time.Time,
+) (PruneReason, error) {
+	if policy.MinSeq > 0 && nextSeq <= policy.MinSeq {
+		return PruneAcked, nil
+	}
+
+	if policy.MaxAge > 0 {
+		newest, err := newestTimestamp(seg.path)
+		if err != nil {
+			return "", err
+		}
+		if now.Sub(newest) > policy.MaxAge {
+			return PruneAge, nil
+		}
+	}
+
+	if policy.MaxBytes > 0 && total > policy.MaxBytes {
+		return PruneSize, nil
+	}
+
+	return "", nil
+}
+
+// newestTimestamp returns the latest record header timestamp in a segment.
+// Only headers are read; payloads are skipped.
+func newestTimestamp(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	size := info.Size()
+
+	var (
+		newest int64
+		offset int64
+		hdrBuf [headerLen]byte
+	)
+	for offset+headerLen <= size {
+		if _, err := f.ReadAt(hdrBuf[:], offset); err != nil {
+			return time.Time{}, err
+		}
+		hdr, err := decodeHeader(hdrBuf[:])
+		if err != nil {
+			break
+		}
+
+		newest = max(newest, hdr.timestamp)
+		offset += recordLen(hdr)
+	}
+
+	return time.Unix(0, newest), nil
+}
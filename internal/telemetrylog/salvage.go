@@ -0,0 +1,240 @@
+package telemetrylog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrMidFileCorruption is returned by Open in strict recovery mode when the
+// active segment holds intact records after a corrupt region.
+var ErrMidFileCorruption = errors.New("corruption followed by intact records")
+
+const scanChunkLen = 64 << 10
+
+// findNextRecord returns the offset of the first intact record after from.
+// It looks for the magic value and confirms each candidate with a full record check.
+func findNextRecord(r io.ReaderAt, from, size int64) (int64, bool) {
+	var magic [magicLen]byte
+	binary.LittleEndian.PutUint32(magic[:], magicValue)
+
+	buf := make([]byte, scanChunkLen)
+	pos := from + 1
+
+	for pos+headerLen+crcLen <= size {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), size-pos)], pos)
+		if n == 0 && err != nil {
+			return 0, false
+		}
+		chunk := buf[:n]
+
+		for i := 0; ; {
+			j := bytes.Index(chunk[i:], magic[:])
+			if j < 0 {
+				break
+			}
+			candidate := pos + int64(i+j)
+			if _, _, err := readRecord(r, candidate, size); err == nil {
+				return candidate, true
+			}
+			i += j + 1
+		}
+
+		// overlap chunks so a magic value split across them is not missed
+		pos += int64(max(n-(magicLen-1), 1))
+	}
+
+	return 0, false
+}
+
+// LostRange is a byte range of a segment that could not be salvaged.
+type LostRange struct {
+	Path   string
+	Offset int64
+	End    int64
+}
+
+// SeqGap is a range of sequence numbers missing from the salvaged log.
+type SeqGap struct {
+	From uint64 // first missing seq
+	To   uint64 // first seq present again
+}
+
+// SalvageReport describes the outcome of Salvage.
+type SalvageReport struct {
+	Segments   int
+	Batches    int
+	Duplicates int // batches skipped because their seq was already salvaged
+	Lost       []LostRange
+	SeqGaps    []SeqGap
+}
+
+// LostBytes returns the total size of all lost ranges.
+func (r SalvageReport) LostBytes() int64 {
+	var n int64
+	for _, l := range r.Lost {
+		n += l.End - l.Offset
+	}
+	return n
+}
+
+// Salvage copies every intact record of the log in srcDir into a new log in dstDir.
+// Unlike recovery on Open, which truncates at the first bad record, it skips
+// corrupt regions by scanning for the next record boundary and keeps going.
+// Records are copied verbatim, keeping their seq, so a seq gap starts a new segment.
+// srcDir is only read; dstDir must not contain a log yet.
+func Salvage(srcDir, dstDir string) (SalvageReport, error) {
+	var report SalvageReport
+
+	segments, err := listSegments(srcDir)
+	if err != nil {
+		return report, err
+	}
+
+	if err := os.MkdirAll(dstDir, 0o700); err != nil {
+		return report, err
+	}
+	existing, err := listSegments(dstDir)
+	if err != nil {
+		return report, err
+	}
+	if len(existing) > 0 {
+		return report, fmt.Errorf("salvage target %s already contains a log", dstDir)
+	}
+
+	w := salvageWriter{dir: dstDir, maxBytes: defaultConfig().SegmentMaxBytes}
+	defer w.close()
+
+	var (
+		expected uint64
+		started  bool
+	)
+
+	for _, s := range segments {
+		report.Segments++
+
+		f, err := os.Open(s.path)
+		if err != nil {
+			return report, err
+		}
+
+		err = scanSegment(f, s.path, &report, func(hdr recordHeader, record []byte, payload []byte) error {
+			if !started {
+				expected, started = hdr.seq, true
+			}
+			if hdr.seq < expected {
+				report.Duplicates++
+				return nil
+			}
+			if hdr.seq > expected {
+				report.SeqGaps = append(report.SeqGaps, SeqGap{From: expected, To: hdr.seq})
+			}
+
+			minTs, maxTs := payloadTimeRange(hdr, payload)
+			if err := w.write(hdr, record, minTs, maxTs); err != nil {
+				return err
+			}
+
+			report.Batches++
+			expected = hdr.seq + 1
+			return nil
+		})
+		f.Close()
+
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, w.close()
+}
+
+// scanSegment calls fn for every intact record and adds skipped ranges to the report.
+func scanSegment(
+	f *os.File,
+	path string,
+	report *SalvageReport,
+	fn func(hdr recordHeader, record []byte, payload []byte) error,
+) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	var offset int64
+	for offset < size {
+		hdr, payload, err := readRecord(f, offset, size)
+		if err != nil {
+			if !isDataError(err) {
+				return err
+			}
+
+			next, ok := findNextRecord(f, offset, size)
+			if !ok {
+				next = size
+			}
+			report.Lost = append(report.Lost, LostRange{Path: path, Offset: offset, End: next})
+			offset = next
+			continue
+		}
+
+		record := make([]byte, recordLen(hdr))
+		if _, err := f.ReadAt(record, offset); err != nil {
+			return err
+		}
+		if err := fn(hdr, record, payload); err != nil {
+			return err
+		}
+
+		offset += recordLen(hdr)
+	}
+
+	return nil
+}
+
+// salvageWriter writes verbatim records into a fresh log directory.
+type salvageWriter struct {
+	dir      string
+	maxBytes int64
+	seg      *segment
+	next     uint64
+}
+
+func (w *salvageWriter) write(hdr recordHeader, record []byte, minTs, maxTs int64) error {
+	if w.seg == nil || hdr.seq != w.next || w.seg.size+int64(len(record)) > w.maxBytes {
+		if err := w.close(); err != nil {
+			return err
+		}
+		seg, err := createSegment(w.dir, hdr.seq, defaultIndexInterval)
+		if err != nil {
+			return err
+		}
+		w.seg = seg
+	}
+
+	if _, err := w.seg.f.Write(record); err != nil {
+		return err
+	}
+	w.seg.indexRecord(hdr.seq, w.seg.size, int64(len(record)), minTs, maxTs)
+	w.seg.size += int64(len(record))
+	w.next = hdr.seq + 1
+	return nil
+}
+
+func (w *salvageWriter) close() error {
+	if w.seg == nil {
+		return nil
+	}
+	seg := w.seg
+	w.seg = nil
+
+	if err := seg.f.Sync(); err != nil {
+		seg.close(false)
+		return err
+	}
+	return seg.close(true)
+}
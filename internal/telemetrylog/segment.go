@@ -0,0 +1,174 @@
+package telemetrylog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	segmentExt     = ".wal"
+	segmentNameLen = 20 // zero-padded base sequence number
+)
+
+// segmentInfo describes a segment file on disk.
+// Segments are named after the sequence number of their first record,
+// so lexical and sequence order are the same.
+type segmentInfo struct {
+	baseSeq uint64
+	path    string
+}
+
+// segment is the active (writable) segment of the log.
+type segment struct {
+	f       *os.File
+	index   *indexWriter // nil when the index could not be maintained
+	path    string
+	baseSeq uint64
+	size    int64
+	created time.Time
+}
+
+func segmentName(baseSeq uint64) string {
+	return fmt.Sprintf("%0*d%s", segmentNameLen, baseSeq, segmentExt)
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	base, ok := strings.CutSuffix(name, segmentExt)
+	if !ok || len(base) != segmentNameLen {
+		return 0, false
+	}
+
+	seq, err := strconv.ParseUint(base, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return seq, true
+}
+
+// listSegments returns all segments in dir ordered by base sequence number.
+func listSegments(dir string) ([]segmentInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []segmentInfo
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		seq, ok := parseSegmentName(e.Name())
+		if !ok {
+			continue
+		}
+		segments = append(segments, segmentInfo{
+			baseSeq: seq,
+			path:    filepath.Join(dir, e.Name()),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].baseSeq < segments[j].baseSeq
+	})
+
+	return segments, nil
+}
+
+// createSegment creates a new empty segment starting at baseSeq.
+func createSegment(dir string, baseSeq uint64, indexInterval int64) (*segment, error) {
+	path := filepath.Join(dir, segmentName(baseSeq))
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	// a failed creation removes its files, so creating the segment can be tried again
+	index, err := createIndex(path, indexInterval)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+
+	// make the new directory entries durable
+	if err := syncDir(dir); err != nil {
+		index.close(false)
+		f.Close()
+		os.Remove(indexPath(path))
+		os.Remove(path)
+		return nil, err
+	}
+
+	return &segment{
+		f:       f,
+		index:   index,
+		path:    path,
+		baseSeq: baseSeq,
+		created: time.Now(),
+	}, nil
+}
+
+// openSegment opens an existing segment for recovery and appends.
+func openSegment(info segmentInfo) (*segment, error) {
+	f, err := os.OpenFile(info.path, os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segment{
+		f:       f,
+		path:    info.path,
+		baseSeq: info.baseSeq,
+		created: time.Now(),
+	}, nil
+}
+
+// indexRecord adds a written record to the segment index.
+// The index is only a hint, so on failure it is dropped and rebuilt on the next Open.
+func (s *segment) indexRecord(seq uint64, offset, length int64, minTs, maxTs int64) {
+	if s.index == nil {
+		return
+	}
+
+	if err := s.index.add(seq, offset, length, minTs, maxTs); err != nil {
+		s.dropIndex()
+	}
+}
+
+func (s *segment) dropIndex() {
+	if s.index == nil {
+		return
+	}
+	s.index.close(false)
+	s.index = nil
+	os.Remove(indexPath(s.path))
+}
+
+// close closes the segment and its index.
+// A sealed segment syncs its index so recovery never has to rebuild it.
+func (s *segment) close(seal bool) error {
+	if s.index != nil {
+		if err := s.index.close(seal); err != nil {
+			os.Remove(indexPath(s.path))
+		}
+		s.index = nil
+	}
+	return s.f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
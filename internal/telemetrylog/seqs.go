@@ -0,0 +1,56 @@
+package telemetrylog
+
+import (
+	"encoding/binary"
+
+	"github.com/kvoloboi/telemetry/internal/domain"
+)
+
+// Records flagged with flagSeqs carry the node sequence number of every event,
+// after the metadata and before the events:
+//
+//	uvarint  event count
+//	per event: uvarint seq, 0 if the event has none
+func marshalSeqs(events []domain.Telemetry) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(events)))
+	for _, e := range events {
+		buf = binary.AppendUvarint(buf, e.Seq)
+	}
+	return buf
+}
+
+// hasSeqs reports whether any of events is numbered.
+func hasSeqs(events []domain.Telemetry) bool {
+	for _, e := range events {
+		if e.Seq != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSeqs returns the sequence numbers of a payload stripped of its marks and
+// metadata, and the event payload following them.
+func splitSeqs(hdr recordHeader, raw []byte) ([]uint64, []byte, error) {
+	if hdr.flags&flagSeqs == 0 {
+		return nil, raw, nil
+	}
+
+	count, n := binary.Uvarint(raw)
+	if n <= 0 || count > uint64(len(raw)) {
+		return nil, nil, ErrPartialBatch
+	}
+	raw = raw[n:]
+
+	seqs := make([]uint64, count)
+	for i := range seqs {
+		seq, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return nil, nil, ErrPartialBatch
+		}
+		seqs[i] = seq
+		raw = raw[n:]
+	}
+
+	return seqs, raw, nil
+}
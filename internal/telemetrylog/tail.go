@@ -0,0 +1,177 @@
+package telemetrylog
+
+import (
+	"context"
+	"os"
+	"sort"
+)
+
+// tailPosition is a consistent view of the log end used by TailReader.
+type tailPosition struct {
+	activeBase uint64 // base seq of the active segment
+	activeSize int64  // bytes fully written to the active segment
+	visible    uint64 // batches with seq < visible may be handed to readers
+	changed    <-chan struct{}
+	closed     bool
+}
+
+func (tl *TelemetryLog) tailPosition() tailPosition {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	// Readers only see fsynced batches, so nothing they consume can be lost
+	// and have its seq reused after a crash. Without fsyncs there is no such
+	// guarantee to keep, and batches become visible once written.
+	visible := tl.durable
+	if tl.cfg.SyncMode == SyncNone {
+		visible = tl.seq
+	}
+
+	return tailPosition{
+		activeBase: tl.active.baseSeq,
+		activeSize: tl.active.size,
+		visible:    visible,
+		changed:    tl.changed,
+		closed:     tl.closed,
+	}
+}
+
+// TailReader follows a live log, returning batches as they are appended.
+// It moves across segment rotations and only returns complete, CRC-valid records.
+// A TailReader is not safe for concurrent use.
+type TailReader struct {
+	log  *TelemetryLog
+	next uint64 // seq of the next batch to return
+
+	f       *os.File
+	segBase uint64
+	offset  int64
+}
+
+// NewTailReader returns a reader starting at the batch with seq fromSeq.
+// If that batch was already pruned, reading starts at the oldest retained batch.
+func NewTailReader(log *TelemetryLog, fromSeq uint64) *TailReader {
+	return &TailReader{log: log, next: fromSeq}
+}
+
+// Next blocks until the next batch is available, ctx is done or the log is closed.
+// Batches already visible when the log is closed are still returned before ErrLogClosed.
+func (r *TailReader) Next(ctx context.Context) (TelemetryBatch, error) {
+	for {
+		if r.f == nil {
+			if err := r.openSegment(); err != nil {
+				return TelemetryBatch{}, err
+			}
+		}
+
+		// taken after opening, so a segment newer than the snapshot is never mistaken for sealed
+		pos := r.log.tailPosition()
+
+		limit, sealed, err := r.limit(pos)
+		if err != nil {
+			return TelemetryBatch{}, err
+		}
+
+		if r.offset < limit {
+			hdr, payload, err := readRecord(r.f, r.offset, limit)
+			if err != nil {
+				return TelemetryBatch{}, err
+			}
+
+			if hdr.seq < pos.visible {
+				r.offset += recordLen(hdr)
+				if hdr.seq < r.next {
+					continue
+				}
+
+				batch, err := decodeBatch(hdr, payload)
+				if err != nil {
+					return TelemetryBatch{}, err
+				}
+
+				r.next = hdr.seq + 1
+				return batch, nil
+			}
+		} else if sealed {
+			// segment fully consumed, continue with the one that followed it
+			if err := r.closeSegment(); err != nil {
+				return TelemetryBatch{}, err
+			}
+			continue
+		}
+
+		if pos.closed {
+			return TelemetryBatch{}, ErrLogClosed
+		}
+
+		select {
+		case <-pos.changed:
+		case <-ctx.Done():
+			return TelemetryBatch{}, ctx.Err()
+		}
+	}
+}
+
+// Close releases the open segment.
+func (r *TailReader) Close() error {
+	return r.closeSegment()
+}
+
+// limit returns how far the current segment may be read and whether it is sealed.
+func (r *TailReader) limit(pos tailPosition) (int64, bool, error) {
+	if r.segBase == pos.activeBase {
+		return pos.activeSize, false, nil
+	}
+
+	// sealed segments never change
+	info, err := r.f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	return info.Size(), true, nil
+}
+
+// openSegment opens the segment holding r.next and seeks close to it via the index.
+func (r *TailReader) openSegment() error {
+	segments, err := listSegments(r.log.dir)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return os.ErrNotExist
+	}
+
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].baseSeq > r.next
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+	seg := segments[i]
+
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if info, err := f.Stat(); err == nil {
+		if entries, err := readIndex(seg.path, info.Size()); err == nil {
+			offset = seekIndexSeq(entries, r.next)
+		}
+	}
+
+	r.f = f
+	r.segBase = seg.baseSeq
+	r.offset = offset
+	return nil
+}
+
+func (r *TailReader) closeSegment() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -31,4 +31,10 @@ CREATE INDEX idx_sensors_active ON sensors(room_id)
 WHERE
     deleted_at IS NULL;
 
-CREATE INDEX idx_measurements_sensor_time ON measurements(sensor_id, measured_at);
\ No newline at end of file
+CREATE INDEX idx_measurements_sensor_time ON measurements(sensor_id, measured_at);
+
+-- Progress of WAL exporters: every batch with seq < next_seq is in measurements.
+CREATE TABLE export_checkpoints (
+    name TEXT PRIMARY KEY,
+    next_seq BIGINT NOT NULL
+);